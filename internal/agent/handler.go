@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+// handshakeTimeout bounds how long an agent has to answer the challenge.
+const handshakeTimeout = 10 * time.Second
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{service: s}
+}
+
+// POST /agents/tokens
+func (h *Handler) CreateJoinToken(w http.ResponseWriter, r *http.Request) {
+	var body JoinTokenRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	logging.SetWorkspaceID(r.Context(), body.WorkspaceID)
+	ttl := time.Duration(body.TTLSeconds) * time.Second
+	token, expiresAt, err := h.service.CreateJoinToken(r.Context(), body.WorkspaceID, auth.GetUserID(r), ttl)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, JoinTokenResponse{
+		Token:       token,
+		WorkspaceID: body.WorkspaceID,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// GET /agents?workspace_id=N&limit=&cursor=&sort=&name=
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wsID, err := strconv.Atoi(r.URL.Query().Get("workspace_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Field("workspace_id", "query parameter is required"))
+		return
+	}
+	logging.SetWorkspaceID(r.Context(), wsID)
+	p, err := pagination.Parse(r, Sorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.List(r.Context(), wsID, auth.GetUserID(r), p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// DELETE /agents/{id}
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	agentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid agent id"))
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), agentID, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "agent revoked"})
+}
+
+// POST /agents/enroll exchanges a join token for an agent identity.
+func (h *Handler) Enroll(w http.ResponseWriter, r *http.Request) {
+	var body EnrollRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	a, err := h.service.Enroll(body.Token, body.Name, body.PublicKey)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, EnrollResponse{
+		Agent:           *a,
+		ServerPublicKey: ServerPublicKey(),
+	})
+}
+
+// GET /agents/connect (WebSocket upgrade, authenticated by challenge)
+func (h *Handler) Connect(w http.ResponseWriter, r *http.Request) {
+	// The connection outlives the server's request timeouts; clear the
+	// deadlines before it is hijacked.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+
+	a, err := h.handshake(r.Context(), conn)
+	if err != nil {
+		slog.WarnContext(r.Context(), "agent handshake failed", "err", err)
+		conn.Close(websocket.StatusPolicyViolation, ErrAuthFailed.Error())
+		return
+	}
+
+	session := h.service.Hub().Register(a, conn)
+	defer h.service.Hub().Unregister(session)
+
+	// A revoke may have landed between authentication and registration.
+	if revoked, err := h.service.IsRevoked(a.ID); err != nil || revoked {
+		conn.Close(websocket.StatusPolicyViolation, ErrRevoked.Error())
+		return
+	}
+
+	logging.SetWorkspaceID(r.Context(), a.WorkspaceID)
+	slog.InfoContext(r.Context(), "agent connected", "agent_id", a.ID)
+	defer slog.InfoContext(r.Context(), "agent disconnected", "agent_id", a.ID)
+
+	for {
+		var msg Message
+		if err := wsjson.Read(r.Context(), conn, &msg); err != nil {
+			return
+		}
+
+		switch msg.Type {
+		case MsgFetch:
+			reply := Message{Type: MsgSecrets}
+			secrets, err := h.service.SecretsFor(a)
+			if errors.Is(err, ErrRevoked) {
+				conn.Close(websocket.StatusPolicyViolation, err.Error())
+				return
+			}
+			if err != nil {
+				reply = Message{Type: MsgError, Reason: err.Error()}
+			} else {
+				reply.Secrets = secrets
+			}
+			if err := wsjson.Write(r.Context(), conn, reply); err != nil {
+				return
+			}
+		default:
+			wsjson.Write(r.Context(), conn, Message{Type: MsgError, Reason: "unknown message type"})
+		}
+	}
+}
+
+func (h *Handler) handshake(ctx context.Context, conn *websocket.Conn) (*Agent, error) {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	serverNonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	challenge := Message{Type: MsgChallenge, Nonce: base64.StdEncoding.EncodeToString(serverNonce)}
+	if err := wsjson.Write(ctx, conn, challenge); err != nil {
+		return nil, err
+	}
+
+	var hello Message
+	if err := wsjson.Read(ctx, conn, &hello); err != nil {
+		return nil, err
+	}
+	if hello.Type != MsgHello {
+		return nil, errors.New("expected hello message")
+	}
+	sig, err := base64.StdEncoding.DecodeString(hello.Signature)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	agentNonce, err := base64.StdEncoding.DecodeString(hello.Nonce)
+	if err != nil || len(agentNonce) < 16 {
+		return nil, errors.New("agent nonce missing or too short")
+	}
+
+	a, err := h.service.Authenticate(ctx, hello.AgentID, serverNonce, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span := tracing.Start(ctx, "agent.sign_welcome", tracing.KindInternal)
+	welcomeSig := ed25519.Sign(serverKey, ServerAuthPayload(a.ID, agentNonce))
+	span.End()
+
+	welcome := Message{
+		Type:      MsgWelcome,
+		AgentID:   a.ID,
+		Signature: base64.StdEncoding.EncodeToString(welcomeSig),
+	}
+	if err := wsjson.Write(ctx, conn, welcome); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// notifyTimeout bounds how long a push to a single agent may block.
+const notifyTimeout = 5 * time.Second
+
+// Session is one authenticated agent connection.
+type Session struct {
+	AgentID     int
+	WorkspaceID int
+	conn        *websocket.Conn
+}
+
+// Hub tracks live agent connections so they can be addressed or dropped.
+type Hub struct {
+	mu       sync.Mutex
+	sessions map[int]map[*Session]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{sessions: make(map[int]map[*Session]struct{})}
+}
+
+// Register adds an authenticated connection to the hub.
+func (h *Hub) Register(a *Agent, conn *websocket.Conn) *Session {
+	s := &Session{AgentID: a.ID, WorkspaceID: a.WorkspaceID, conn: conn}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions[a.ID] == nil {
+		h.sessions[a.ID] = make(map[*Session]struct{})
+	}
+	h.sessions[a.ID][s] = struct{}{}
+	return s
+}
+
+// Unregister removes a connection from the hub.
+func (h *Hub) Unregister(s *Session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.sessions[s.AgentID], s)
+	if len(h.sessions[s.AgentID]) == 0 {
+		delete(h.sessions, s.AgentID)
+	}
+}
+
+// Count returns the number of live agent connections.
+func (h *Hub) Count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, conns := range h.sessions {
+		n += len(conns)
+	}
+	return n
+}
+
+// Connected reports whether the agent has at least one live connection.
+func (h *Hub) Connected(agentID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sessions[agentID]) > 0
+}
+
+// Disconnect closes every live connection of the agent with a policy
+// violation status and the given reason.
+func (h *Hub) Disconnect(agentID int, reason string) {
+	h.mu.Lock()
+	var conns []*websocket.Conn
+	for s := range h.sessions[agentID] {
+		conns = append(conns, s.conn)
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		go c.Close(websocket.StatusPolicyViolation, reason)
+	}
+}
+
+// DisconnectWorkspace closes every live connection of the workspace's
+// agents like Disconnect.
+func (h *Hub) DisconnectWorkspace(workspaceID int, reason string) {
+	h.mu.Lock()
+	var conns []*websocket.Conn
+	for _, set := range h.sessions {
+		for s := range set {
+			if s.WorkspaceID == workspaceID {
+				conns = append(conns, s.conn)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		go c.Close(websocket.StatusPolicyViolation, reason)
+	}
+}
+
+// CloseAll closes every live connection with a going-away status and the
+// given reason, e.g. when the server shuts down. Agents reconnect on their own.
+func (h *Hub) CloseAll(reason string) {
+	h.mu.Lock()
+	var conns []*websocket.Conn
+	for _, set := range h.sessions {
+		for s := range set {
+			conns = append(conns, s.conn)
+		}
+	}
+	h.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *websocket.Conn) {
+			defer wg.Done()
+			c.Close(websocket.StatusGoingAway, reason)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// NotifyWorkspace pushes a changed message to every agent of the workspace
+// so they fetch and re-render.
+func (h *Hub) NotifyWorkspace(workspaceID int) {
+	h.mu.Lock()
+	var conns []*websocket.Conn
+	for _, set := range h.sessions {
+		for s := range set {
+			if s.WorkspaceID == workspaceID {
+				conns = append(conns, s.conn)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		go func(c *websocket.Conn) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			wsjson.Write(ctx, c, Message{Type: MsgChanged})
+		}(c)
+	}
+}
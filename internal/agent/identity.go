@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// serverKey is the server's long-lived identity. Agents pin its public half.
+var serverKey ed25519.PrivateKey
+
+// InitIdentity loads the server identity key from config.Agent.IdentityKeyFile,
+// generating and persisting a new one on first start.
+func InitIdentity() error {
+	key, err := LoadOrCreateKey(config.Agent.IdentityKeyFile)
+	if err != nil {
+		return err
+	}
+	serverKey = key
+	return nil
+}
+
+// CheckIdentity reports whether the identity key is loaded and still on
+// disk. A lost key file would make the next start mint a new identity that
+// no enrolled agent trusts.
+func CheckIdentity(ctx context.Context) error {
+	if serverKey == nil {
+		return errors.New("identity key not loaded")
+	}
+	data, err := os.ReadFile(config.Agent.IdentityKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read identity key: %w", err)
+	}
+	key, err := parseKey(data, config.Agent.IdentityKeyFile)
+	if err != nil {
+		return err
+	}
+	if !key.Equal(serverKey) {
+		return errors.New("identity key file changed since start")
+	}
+	return nil
+}
+
+// ServerPublicKey returns the base64-encoded public half of the server identity.
+func ServerPublicKey() string {
+	return EncodeKey(serverKey.Public().(ed25519.PublicKey))
+}
+
+// LoadOrCreateKey reads a PKCS#8 PEM ed25519 private key from path. If the
+// file does not exist a new key is generated and written with mode 0600.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		if dir := filepath.Dir(path); dir != "" {
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return nil, err
+			}
+		}
+		out := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, out, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write identity key: %w", err)
+		}
+		return priv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity key: %w", err)
+	}
+	return parseKey(data, path)
+}
+
+func parseKey(data []byte, path string) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("identity key %s is not PEM encoded", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity key: %w", err)
+	}
+	priv, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("identity key %s is not an ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// EncodeKey encodes a public key the way it travels over the API.
+func EncodeKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+// DecodeKey parses a base64-encoded ed25519 public key.
+func DecodeKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// AgentAuthPayload is what an agent signs to answer a server challenge.
+func AgentAuthPayload(agentID int, serverNonce []byte) []byte {
+	return authPayload("secretlane-agent-auth:v1:", agentID, serverNonce)
+}
+
+// ServerAuthPayload is what the server signs to prove its identity to an agent.
+func ServerAuthPayload(agentID int, agentNonce []byte) []byte {
+	return authPayload("secretlane-server-auth:v1:", agentID, agentNonce)
+}
+
+func authPayload(prefix string, agentID int, nonce []byte) []byte {
+	b := []byte(prefix)
+	b = strconv.AppendInt(b, int64(agentID), 10)
+	b = append(b, ':')
+	return append(b, nonce...)
+}
+
+// NewNonce returns 32 random bytes for use in a challenge.
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
@@ -0,0 +1,88 @@
+package agent
+
+import "time"
+
+// Agent is a host enrolled into a workspace. It authenticates with the
+// ed25519 key it registered during enrollment.
+type Agent struct {
+	ID          int        `json:"id"`
+	WorkspaceID int        `json:"workspace_id"`
+	Name        string     `json:"name"`
+	PublicKey   string     `json:"public_key"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	Connected   bool       `json:"connected"`
+}
+
+// JoinToken is a single-use enrollment token scoped to a workspace.
+// Only the SHA-256 hash of the token is stored.
+type JoinToken struct {
+	ID          int        `json:"id"`
+	WorkspaceID int        `json:"workspace_id"`
+	CreatedBy   int        `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+}
+
+// Message types exchanged over the agent WebSocket channel.
+const (
+	MsgChallenge = "challenge"
+	MsgHello     = "hello"
+	MsgWelcome   = "welcome"
+	MsgError     = "error"
+
+	// MsgFetch asks the server for the workspace's secrets; it answers with MsgSecrets.
+	MsgFetch   = "fetch"
+	MsgSecrets = "secrets"
+	// MsgChanged is pushed by the server when the workspace's secrets change.
+	MsgChanged = "changed"
+)
+
+// Message is the envelope for every frame on the agent WebSocket channel.
+//
+// Handshake:
+//  1. server -> agent: {type: challenge, nonce}
+//  2. agent -> server: {type: hello, agent_id, nonce, signature}
+//     where signature = ed25519(agentKey, AgentAuthPayload(agent_id, server nonce))
+//  3. server -> agent: {type: welcome, signature}
+//     where signature = ed25519(serverKey, ServerAuthPayload(agent_id, agent nonce))
+//
+// The agent verifies step 3 against the server key it pinned at enrollment.
+// After the handshake the agent sends fetch and the server answers with
+// secrets; the server pushes changed whenever the agent should fetch again.
+type Message struct {
+	Type      string            `json:"type"`
+	AgentID   int               `json:"agent_id,omitempty"`
+	Nonce     string            `json:"nonce,omitempty"`
+	Signature string            `json:"signature,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Secrets   map[string]string `json:"secrets,omitempty"`
+}
+
+// EnrollRequest is the body an agent posts to exchange a join token for an identity.
+type EnrollRequest struct {
+	Token     string `json:"token"`
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// EnrollResponse is returned after a successful enrollment.
+type EnrollResponse struct {
+	Agent           Agent  `json:"agent"`
+	ServerPublicKey string `json:"server_public_key"`
+}
+
+// JoinTokenRequest asks for a join token; TTLSeconds 0 means the default.
+type JoinTokenRequest struct {
+	WorkspaceID int `json:"workspace_id"`
+	TTLSeconds  int `json:"ttl_seconds"`
+}
+
+// JoinTokenResponse carries the plaintext token, shown only once.
+type JoinTokenResponse struct {
+	Token       string    `json:"token"`
+	WorkspaceID int       `json:"workspace_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
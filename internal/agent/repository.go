@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+// Repository encapsulates all DB operations for agents and join tokens.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+type Repository struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+}
+
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
+}
+
+func NewDefaultRepository() *Repository {
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
+}
+
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const agentColumns = `id, workspace_id, name, public_key, created_at, last_seen_at, revoked_at`
+
+func scanAgent(row rowScanner) (*Agent, error) {
+	a := &Agent{}
+	if err := row.Scan(&a.ID, &a.WorkspaceID, &a.Name, &a.PublicKey, &a.CreatedAt, &a.LastSeenAt, &a.RevokedAt); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *Repository) CreateJoinToken(workspaceID int, tokenHash string, createdBy int, createdAt, expiresAt time.Time) (int, error) {
+	defer metrics.ObserveDB("agent", "CreateJoinToken")()
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			INSERT INTO agent_join_tokens (workspace_id, token_hash, created_by, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, workspaceID, tokenHash, createdBy, createdAt, expiresAt)
+		var id int
+		if err := row.Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	res, err := r.sqlDB.Exec(`
+		INSERT INTO agent_join_tokens (workspace_id, token_hash, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, workspaceID, tokenHash, createdBy, createdAt, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// ConsumeJoinToken atomically marks an unused, unexpired token as used and
+// returns its workspace. ok is false if no such token exists.
+func (r *Repository) ConsumeJoinToken(tokenHash string, now time.Time) (workspaceID int, ok bool, err error) {
+	defer metrics.ObserveDB("agent", "ConsumeJoinToken")()
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			UPDATE agent_join_tokens
+			SET used_at = $1
+			WHERE token_hash = $2 AND used_at IS NULL AND expires_at > $1
+			RETURNING workspace_id
+		`, now, tokenHash)
+		err := row.Scan(&workspaceID)
+		if err == pgx.ErrNoRows {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		return workspaceID, true, nil
+	}
+
+	row := r.sqlDB.QueryRow(`
+		UPDATE agent_join_tokens
+		SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING workspace_id
+	`, now, tokenHash, now)
+	err = row.Scan(&workspaceID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return workspaceID, true, nil
+}
+
+func (r *Repository) CreateAgent(workspaceID int, name, publicKey string, createdAt time.Time) (*Agent, error) {
+	defer metrics.ObserveDB("agent", "CreateAgent")()
+	a := &Agent{
+		WorkspaceID: workspaceID,
+		Name:        name,
+		PublicKey:   publicKey,
+		CreatedAt:   createdAt,
+	}
+
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			INSERT INTO agents (workspace_id, name, public_key, created_at)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, workspaceID, name, publicKey, createdAt)
+		if err := row.Scan(&a.ID); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+
+	res, err := r.sqlDB.Exec(`
+		INSERT INTO agents (workspace_id, name, public_key, created_at)
+		VALUES (?, ?, ?, ?)
+	`, workspaceID, name, publicKey, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	a.ID = int(id)
+	return a, nil
+}
+
+// FindByID returns the agent with the given ID, or nil if it does not exist.
+func (r *Repository) FindByID(id int) (*Agent, error) {
+	defer metrics.ObserveDB("agent", "FindByID")()
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(),
+			`SELECT `+agentColumns+` FROM agents WHERE id = $1`, id)
+		a, err := scanAgent(row)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return a, err
+	}
+
+	row := r.sqlDB.QueryRow(`SELECT `+agentColumns+` FROM agents WHERE id = ?`, id)
+	a, err := scanAgent(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return a, err
+}
+
+// ListForWorkspace returns one page of a workspace's agents, plus one extra
+// row if there are more (see pagination.NewPage).
+func (r *Repository) ListForWorkspace(workspaceID int, p pagination.Params) ([]Agent, error) {
+	defer metrics.ObserveDB("agent", "ListForWorkspace")()
+	where, tail, args := p.Query([]any{workspaceID}, "name")
+	query := `SELECT ` + agentColumns + ` FROM agents WHERE workspace_id = $1` + where + tail
+
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Agent
+		for rows.Next() {
+			a, err := scanAgent(rows)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *a)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Agent
+	for rows.Next() {
+		a, err := scanAgent(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) Revoke(id int, now time.Time) error {
+	defer metrics.ObserveDB("agent", "Revoke")()
+	if config.DBDriver == "postgres" {
+		_, err := r.pgxPool.Exec(context.Background(), `
+		UPDATE agents SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL
+		`, now, id)
+		return err
+	}
+
+	_, err := r.sqlDB.Exec(`
+		UPDATE agents SET revoked_at = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`, now, id)
+	return err
+}
+
+func (r *Repository) TouchLastSeen(id int, now time.Time) error {
+	defer metrics.ObserveDB("agent", "TouchLastSeen")()
+	if config.DBDriver == "postgres" {
+		_, err := r.pgxPool.Exec(context.Background(),
+			`UPDATE agents SET last_seen_at = $1 WHERE id = $2`, now, id)
+		return err
+	}
+
+	_, err := r.sqlDB.Exec(`UPDATE agents SET last_seen_at = ? WHERE id = ?`, now, id)
+	return err
+}
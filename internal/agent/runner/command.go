@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/amartya2002/secretlane/internal/logging"
+)
+
+const usage = `usage:
+  secretlane agent enroll -server URL -token TOKEN -name NAME [-state-dir DIR]
+  secretlane agent run [-config agent.yaml]`
+
+// Main is the entry point for `secretlane agent`. It returns the process exit code.
+func Main(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	// Reload command output and errors can carry secret values, so the
+	// agent logs through the server's redaction too.
+	slog.SetDefault(slog.New(logging.New(slog.NewTextHandler(os.Stderr, nil))))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "enroll":
+		return enrollCmd(ctx, args[1:])
+	case "run":
+		return runCmd(ctx, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+func enrollCmd(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("agent enroll", flag.ContinueOnError)
+	server := fs.String("server", "", "secretlane server URL, e.g. https://secretlane.example.com")
+	token := fs.String("token", "", "single-use join token")
+	name := fs.String("name", hostname(), "agent name")
+	stateDir := fs.String("state-dir", defaultStateDir, "directory for the agent key and state")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *server == "" || *token == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	st, err := Enroll(ctx, *server, *token, *name, *stateDir)
+	if err != nil {
+		slog.Error("enrollment failed", "err", err)
+		return 1
+	}
+	slog.Info("agent enrolled", "agent_id", st.AgentID, "workspace_id", st.WorkspaceID)
+	return 0
+}
+
+func runCmd(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("agent run", flag.ContinueOnError)
+	configPath := fs.String("config", "agent.yaml", "agent config file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		slog.Error("failed to load agent config", "path", *configPath, "err", err)
+		return 1
+	}
+	r, err := New(cfg)
+	if err != nil {
+		slog.Error("failed to start agent", "err", err)
+		return 1
+	}
+	if err := r.Run(ctx); err != nil {
+		slog.Error("agent stopped", "err", err)
+		return 1
+	}
+	return 0
+}
+
+func hostname() string {
+	h, _ := os.Hostname()
+	return h
+}
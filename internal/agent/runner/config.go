@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the agent-mode configuration file (agent.yaml).
+type Config struct {
+	// StateDir holds the agent key and enrollment state.
+	StateDir string `yaml:"state_dir"`
+	// CommandTimeout bounds each reload command, e.g. "30s".
+	CommandTimeout string `yaml:"command_timeout"`
+	// Templates lists the files rendered from secrets.
+	Templates []TemplateConfig `yaml:"templates"`
+}
+
+// TemplateConfig describes one rendered file.
+type TemplateConfig struct {
+	// Source is a Go text/template file; use {{ secret "KEY" }} to reference a secret.
+	Source string `yaml:"source"`
+	// Destination is written atomically (temp file + rename).
+	Destination string `yaml:"destination"`
+	// Mode is an octal file mode such as "0640"; defaults to 0600.
+	Mode string `yaml:"mode"`
+	// Owner and Group accept names or numeric IDs; empty keeps the process user.
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+	// Command is run through /bin/sh after the destination changes.
+	Command string `yaml:"command"`
+}
+
+// LoadConfig reads and validates an agent config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent config: %w", err)
+	}
+
+	cfg := &Config{
+		StateDir:       defaultStateDir,
+		CommandTimeout: "60s",
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse agent config: %w", err)
+	}
+
+	if _, err := cfg.commandTimeout(); err != nil {
+		return nil, err
+	}
+	for i, t := range cfg.Templates {
+		if t.Source == "" || t.Destination == "" {
+			return nil, fmt.Errorf("template %d: source and destination are required", i)
+		}
+		if _, err := t.fileMode(); err != nil {
+			return nil, fmt.Errorf("template %d: %w", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+func (c *Config) commandTimeout() (time.Duration, error) {
+	d, err := time.ParseDuration(c.CommandTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid command_timeout: %w", err)
+	}
+	return d, nil
+}
+
+func (t TemplateConfig) fileMode() (os.FileMode, error) {
+	if t.Mode == "" {
+		return 0o600, nil
+	}
+	m, err := strconv.ParseUint(t.Mode, 8, 32)
+	if err != nil || m > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q", t.Mode)
+	}
+	return os.FileMode(m), nil
+}
+
+const (
+	defaultStateDir = "/var/lib/secretlane-agent"
+	stateFile       = "agent.json"
+	keyFile         = "agent.pem"
+)
+
+// State is what enrollment leaves behind in the state directory.
+type State struct {
+	ServerURL       string `json:"server_url"`
+	AgentID         int    `json:"agent_id"`
+	WorkspaceID     int    `json:"workspace_id"`
+	ServerPublicKey string `json:"server_public_key"`
+}
+
+func loadState(dir string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New("agent is not enrolled; run `secretlane agent enroll` first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("corrupt agent state: %w", err)
+	}
+	return &st, nil
+}
+
+func saveState(dir string, st *State) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, stateFile), data, 0o600, -1, -1)
+}
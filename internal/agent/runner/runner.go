@@ -0,0 +1,217 @@
+// Package runner implements `secretlane agent`: it enrolls a host, keeps an
+// authenticated WebSocket channel to the server and renders secret templates.
+package runner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/amartya2002/secretlane/internal/agent"
+	"github.com/amartya2002/secretlane/pkg/client"
+)
+
+const (
+	minBackoff       = time.Second
+	maxBackoff       = time.Minute
+	handshakeTimeout = 15 * time.Second
+)
+
+// Enroll generates the agent key, exchanges the join token for an agent
+// identity and pins the server's public key in the state directory.
+func Enroll(ctx context.Context, serverURL, token, name, stateDir string) (*State, error) {
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, err
+	}
+	key, err := agent.LoadOrCreateKey(filepath.Join(stateDir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := client.New(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	out, err := api.Enroll(ctx, token, name, agent.EncodeKey(key.Public().(ed25519.PublicKey)))
+	if err != nil {
+		return nil, fmt.Errorf("enroll failed: %w", err)
+	}
+	if _, err := agent.DecodeKey(out.ServerPublicKey); err != nil {
+		return nil, fmt.Errorf("server returned an invalid public key: %w", err)
+	}
+
+	st := &State{
+		ServerURL:       strings.TrimRight(serverURL, "/"),
+		AgentID:         out.Agent.ID,
+		WorkspaceID:     out.Agent.WorkspaceID,
+		ServerPublicKey: out.ServerPublicKey,
+	}
+	if err := saveState(stateDir, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Runner keeps the agent connected and the templates rendered.
+type Runner struct {
+	cfg       *Config
+	state     *State
+	key       ed25519.PrivateKey
+	serverKey ed25519.PublicKey
+}
+
+// New loads the enrollment state referenced by cfg.
+func New(cfg *Config) (*Runner, error) {
+	st, err := loadState(cfg.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	key, err := agent.LoadOrCreateKey(filepath.Join(cfg.StateDir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+	serverKey, err := agent.DecodeKey(st.ServerPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("pinned server key: %w", err)
+	}
+	return &Runner{cfg: cfg, state: st, key: key, serverKey: serverKey}, nil
+}
+
+// Run connects and re-connects until ctx is cancelled.
+func (r *Runner) Run(ctx context.Context) error {
+	backoff := minBackoff
+	for {
+		connected, err := r.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			backoff = minBackoff
+		}
+		slog.Warn("connection lost", "err", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session runs one connection. connected reports whether the handshake succeeded.
+func (r *Runner) session(ctx context.Context) (connected bool, err error) {
+	wsURL, err := connectURL(r.state.ServerURL)
+	if err != nil {
+		return false, err
+	}
+
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(4 << 20)
+
+	if err := r.handshake(ctx, conn); err != nil {
+		return false, err
+	}
+	slog.Info("connected", "agent_id", r.state.AgentID, "workspace_id", r.state.WorkspaceID)
+
+	if err := wsjson.Write(ctx, conn, agent.Message{Type: agent.MsgFetch}); err != nil {
+		return true, err
+	}
+
+	for {
+		var msg agent.Message
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			return true, err
+		}
+
+		switch msg.Type {
+		case agent.MsgSecrets:
+			if err := render(r.cfg, msg.Secrets); err != nil {
+				slog.Error("render finished with errors", "err", err)
+			}
+		case agent.MsgChanged:
+			if err := wsjson.Write(ctx, conn, agent.Message{Type: agent.MsgFetch}); err != nil {
+				return true, err
+			}
+		case agent.MsgError:
+			slog.Error("server error", "reason", msg.Reason)
+		}
+	}
+}
+
+func (r *Runner) handshake(ctx context.Context, conn *websocket.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	var challenge agent.Message
+	if err := wsjson.Read(ctx, conn, &challenge); err != nil {
+		return err
+	}
+	if challenge.Type != agent.MsgChallenge {
+		return errors.New("expected challenge from server")
+	}
+	serverNonce, err := base64.StdEncoding.DecodeString(challenge.Nonce)
+	if err != nil {
+		return errors.New("malformed server challenge")
+	}
+
+	agentNonce, err := agent.NewNonce()
+	if err != nil {
+		return err
+	}
+	hello := agent.Message{
+		Type:      agent.MsgHello,
+		AgentID:   r.state.AgentID,
+		Nonce:     base64.StdEncoding.EncodeToString(agentNonce),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(r.key, agent.AgentAuthPayload(r.state.AgentID, serverNonce))),
+	}
+	if err := wsjson.Write(ctx, conn, hello); err != nil {
+		return err
+	}
+
+	var welcome agent.Message
+	if err := wsjson.Read(ctx, conn, &welcome); err != nil {
+		return err
+	}
+	if welcome.Type != agent.MsgWelcome {
+		return errors.New("expected welcome from server")
+	}
+	sig, err := base64.StdEncoding.DecodeString(welcome.Signature)
+	if err != nil || !ed25519.Verify(r.serverKey, agent.ServerAuthPayload(r.state.AgentID, agentNonce), sig) {
+		conn.Close(websocket.StatusPolicyViolation, "server identity mismatch")
+		return errors.New("server failed to prove its pinned identity")
+	}
+	return nil
+}
+
+func connectURL(serverURL string) (string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported server URL scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api/v1/agents/connect"
+	return u.String(), nil
+}
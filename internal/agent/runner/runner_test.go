@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/agent"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/secret"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+// startServer runs the agent endpoints on a fresh sqlite database and
+// returns them with a workspace, its owner and the secret store.
+func startServer(t *testing.T) (srv *httptest.Server, agents *agent.Service, secrets *secret.Service, workspaceID, ownerID int) {
+	t.Helper()
+	dir := t.TempDir()
+	configtest.SQLite(t)
+
+	config.Agent.IdentityKeyFile = filepath.Join(dir, "identity.pem")
+	if err := agent.InitIdentity(); err != nil {
+		t.Fatal(err)
+	}
+	config.Secrets.KeyFile = filepath.Join(dir, "secrets.key")
+	if err := secret.InitKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus(nil)
+	workspaces := workspace.NewService(org.NewService(), bus)
+	secrets = secret.NewService(workspaces, bus)
+	agents = agent.NewService(workspaces, bus)
+	agents.SetSecretSource(secrets)
+	bus.Subscribe(agents.HandleEvent)
+
+	ctx := context.Background()
+	u, err := auth.NewDefaultRepository().CreateUser(ctx, "owner@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerID = u.ID
+	if workspaceID, err = workspaces.Create(ctx, 0, "prod", "", ownerID); err != nil {
+		t.Fatal(err)
+	}
+
+	h := agent.NewHandler(agents)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/agents/enroll", h.Enroll)
+	mux.HandleFunc("GET /api/v1/agents/connect", h.Connect)
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, agents, secrets, workspaceID, ownerID
+}
+
+// waitForFile polls path until it holds want.
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, err := os.ReadFile(path)
+		if err == nil && string(got) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q, %v; want %q", path, got, err, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRunnerRendersSecretTemplate(t *testing.T) {
+	srv, agents, secrets, workspaceID, ownerID := startServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if _, _, err := secrets.Set(ctx, workspaceID, "DB_PASSWORD", "hunter2", ownerID); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := agents.CreateJoinToken(ctx, workspaceID, ownerID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	stateDir := filepath.Join(dir, "state")
+	if _, err := Enroll(ctx, srv.URL, token, "web-01", stateDir); err != nil {
+		t.Fatal(err)
+	}
+
+	source := filepath.Join(dir, "app.conf.tmpl")
+	if err := os.WriteFile(source, []byte(`password = {{ secret "DB_PASSWORD" }}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "app.conf")
+	reloads := filepath.Join(dir, "reloads")
+	cfg := &Config{
+		StateDir:       stateDir,
+		CommandTimeout: "5s",
+		Templates: []TemplateConfig{{
+			Source:      source,
+			Destination: dest,
+			Mode:        "0640",
+			Command:     "echo reload >> " + reloads,
+		}},
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitForFile(t, dest, "password = hunter2\n")
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Fatalf("mode = %o, want 640", info.Mode().Perm())
+	}
+
+	// A rotation on the server is pushed to the agent, which re-renders
+	// and reloads again.
+	if _, err := secrets.Rotate(ctx, workspaceID, "DB_PASSWORD", "correct-horse", ownerID); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, dest, "password = correct-horse\n")
+	waitForFile(t, reloads, "reload\nreload\n")
+}
+
+func TestRenderMissingSecretLeavesDestination(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.conf.tmpl")
+	if err := os.WriteFile(source, []byte(`{{ secret "MISSING" }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(dest, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{CommandTimeout: "5s", Templates: []TemplateConfig{{Source: source, Destination: dest}}}
+	err := render(cfg, map[string]string{"OTHER": "x"})
+	if err == nil || !strings.Contains(err.Error(), `secret "MISSING" not found`) {
+		t.Fatalf("render err = %v, want missing secret", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "old" {
+		t.Fatalf("destination = %q, want it untouched", got)
+	}
+}
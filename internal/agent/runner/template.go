@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// render executes every configured template against secrets, writes changed
+// destinations and runs their reload commands once each.
+func render(cfg *Config, secrets map[string]string) error {
+	timeout, err := cfg.commandTimeout()
+	if err != nil {
+		return err
+	}
+
+	var commands []string
+	seen := make(map[string]bool)
+	var firstErr error
+
+	for _, t := range cfg.Templates {
+		changed, err := renderOne(t, secrets)
+		if err != nil {
+			slog.Error("failed to render template", "destination", t.Destination, "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !changed {
+			continue
+		}
+		slog.Info("template written", "destination", t.Destination)
+		if t.Command != "" && !seen[t.Command] {
+			seen[t.Command] = true
+			commands = append(commands, t.Command)
+		}
+	}
+
+	for _, c := range commands {
+		if err := runCommand(c, timeout); err != nil {
+			slog.Error("reload command failed", "command", c, "err", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// renderOne renders a single template and reports whether the destination changed.
+func renderOne(t TemplateConfig, secrets map[string]string) (bool, error) {
+	src, err := os.ReadFile(t.Source)
+	if err != nil {
+		return false, err
+	}
+
+	tmpl, err := template.New(filepath.Base(t.Source)).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"secret": func(key string) (string, error) {
+				v, ok := secrets[key]
+				if !ok {
+					return "", fmt.Errorf("secret %q not found", key)
+				}
+				return v, nil
+			},
+		}).
+		Parse(string(src))
+	if err != nil {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return false, err
+	}
+
+	mode, err := t.fileMode()
+	if err != nil {
+		return false, err
+	}
+	uid, gid, err := lookupOwner(t.Owner, t.Group)
+	if err != nil {
+		return false, err
+	}
+
+	if unchanged(t.Destination, buf.Bytes(), mode) {
+		return false, nil
+	}
+	if err := writeFileAtomic(t.Destination, buf.Bytes(), mode, uid, gid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func unchanged(path string, content []byte, mode os.FileMode) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != mode.Perm() {
+		return false
+	}
+	existing, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(existing, content)
+}
+
+// writeFileAtomic writes data to a temp file next to path, applies mode and
+// ownership, syncs it and renames it into place. uid/gid of -1 are left alone.
+func writeFileAtomic(path string, data []byte, mode os.FileMode, uid, gid int) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if uid >= 0 || gid >= 0 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+func lookupOwner(owner, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			u, err = user.LookupId(owner)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown owner %q", owner)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown group %q", group)
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
+
+func runCommand(command string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		slog.Info("reload command output", "command", command, "output", string(bytes.TrimSpace(out)))
+	}
+	return err
+}
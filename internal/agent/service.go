@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/tracing"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+const (
+	joinTokenPrefix     = "slj_"
+	defaultJoinTokenTTL = time.Hour
+	maxJoinTokenTTL     = 7 * 24 * time.Hour
+)
+
+var (
+	ErrForbidden    = apierror.Forbidden("not allowed to manage agents in this workspace")
+	ErrNotOwner     = apierror.Forbidden("only owners of the workspace's organization may enroll or revoke agents")
+	ErrNotFound     = apierror.NotFound("agent not found")
+	ErrInvalidToken = apierror.Unauthorized("join token is invalid, expired or already used")
+	ErrAuthFailed   = errors.New("agent authentication failed")
+	ErrRevoked      = errors.New("agent revoked")
+	ErrNoSecrets    = errors.New("no secret source is configured on this server")
+)
+
+// SecretSource supplies the secret values delivered to agents.
+type SecretSource interface {
+	Secrets(workspaceID int) (map[string]string, error)
+}
+
+type Service struct {
+	repo       *Repository
+	workspaces *workspace.Service
+	hub        *Hub
+	secrets    SecretSource
+	events     *events.Bus
+}
+
+func NewService(workspaces *workspace.Service, bus *events.Bus) *Service {
+	return &Service{repo: NewDefaultRepository(), workspaces: workspaces, hub: NewHub(), events: bus}
+}
+
+// Hub returns the registry of live agent connections.
+func (s *Service) Hub() *Hub {
+	return s.hub
+}
+
+// SetSecretSource wires the store agents fetch secret values from.
+func (s *Service) SetSecretSource(src SecretSource) {
+	s.secrets = src
+}
+
+// SecretsFor returns the secrets an authenticated agent may render. The
+// revocation state is read again on every fetch, so a connection that missed
+// the agent.revoked event still gets nothing once the agent is revoked.
+func (s *Service) SecretsFor(a *Agent) (map[string]string, error) {
+	if s.secrets == nil {
+		return nil, ErrNoSecrets
+	}
+	revoked, err := s.IsRevoked(a.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevoked
+	}
+	secrets, err := s.secrets.Secrets(a.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	metrics.SecretRead(a.WorkspaceID, len(secrets))
+	return secrets, nil
+}
+
+// HandleEvent tells a workspace's connected agents to re-fetch when its
+// secrets change, and drops the connections of revoked agents and of
+// workspaces moved to the trash. It is registered on the event bus.
+func (s *Service) HandleEvent(e events.Event) {
+	switch {
+	case strings.HasPrefix(e.Type, "secret."):
+		s.hub.NotifyWorkspace(e.WorkspaceID)
+	case e.Type == events.WorkspaceDeleted || e.Type == events.WorkspacePurged:
+		s.hub.DisconnectWorkspace(e.WorkspaceID, "workspace deleted")
+	case e.Type == events.AgentRevoked:
+		if agentID, ok := eventAgentID(e); ok {
+			s.hub.Disconnect(agentID, ErrRevoked.Error())
+		}
+	}
+}
+
+// CreateJoinToken issues a single-use join token for the workspace. Only
+// owners of its organization may, since an agent can read every secret. The
+// plaintext token is only returned here; the DB keeps its hash.
+func (s *Service) CreateJoinToken(ctx context.Context, workspaceID, userID int, ttl time.Duration) (string, time.Time, error) {
+	if err := s.requireOwner(ctx, workspaceID, userID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if ttl <= 0 {
+		ttl = defaultJoinTokenTTL
+	}
+	if ttl > maxJoinTokenTTL {
+		return "", time.Time{}, apierror.Field("ttl_seconds", "must not exceed 7 days")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := joinTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+	if _, err := s.repo.CreateJoinToken(workspaceID, hashToken(token), userID, now, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Enroll exchanges a join token for a registered agent identity.
+func (s *Service) Enroll(token, name, publicKey string) (*Agent, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, apierror.Field("name", "is required")
+	}
+	pub, err := DecodeKey(publicKey)
+	if err != nil {
+		return nil, apierror.Field("public_key", err.Error())
+	}
+
+	now := time.Now().UTC()
+	workspaceID, ok, err := s.repo.ConsumeJoinToken(hashToken(token), now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return s.repo.CreateAgent(workspaceID, name, EncodeKey(pub), now)
+}
+
+// Sorts are the sort fields of the agent list; created_at sorts by id.
+var Sorts = pagination.Sorts{
+	Columns: map[string]string{"name": "name", "created_at": "id"},
+	Default: "-created_at",
+}
+
+// List returns a page of the agents of a workspace the user belongs to.
+func (s *Service) List(ctx context.Context, workspaceID, userID int, p pagination.Params) (pagination.Page[Agent], error) {
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return pagination.Page[Agent]{}, err
+	}
+
+	rows, err := s.repo.ListForWorkspace(workspaceID, p)
+	if err != nil {
+		return pagination.Page[Agent]{}, err
+	}
+	page := pagination.NewPage(rows, p, func(a Agent) (string, int64) { return a.Name, int64(a.ID) })
+	for i := range page.Items {
+		page.Items[i].Connected = s.hub.Connected(page.Items[i].ID)
+	}
+	return page, nil
+}
+
+// Revoke permanently disables an agent and publishes agent.revoked, on which
+// its live connections are dropped. Only owners of the workspace's
+// organization may.
+func (s *Service) Revoke(ctx context.Context, agentID, userID int) error {
+	a, err := s.repo.FindByID(agentID)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return ErrNotFound
+	}
+	if err := s.requireOwner(ctx, a.WorkspaceID, userID); err != nil {
+		return err
+	}
+
+	if err := s.repo.Revoke(agentID, time.Now().UTC()); err != nil {
+		return err
+	}
+	s.events.Publish(events.Event{
+		Type:        events.AgentRevoked,
+		WorkspaceID: a.WorkspaceID,
+		ActorID:     userID,
+		Data:        map[string]any{"agent_id": a.ID, "name": a.Name},
+	})
+	return nil
+}
+
+// Authenticate verifies an agent's answer to a server challenge.
+func (s *Service) Authenticate(ctx context.Context, agentID int, serverNonce, signature []byte) (*Agent, error) {
+	a, err := s.repo.FindByID(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil || a.RevokedAt != nil {
+		return nil, ErrAuthFailed
+	}
+	// Agents of a trashed workspace stay enrolled, so they are back once it
+	// is restored, but may not connect until then.
+	active, err := s.workspaces.IsActive(ctx, a.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrAuthFailed
+	}
+
+	pub, err := DecodeKey(a.PublicKey)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	_, span := tracing.Start(ctx, "agent.verify_signature", tracing.KindInternal)
+	valid := ed25519.Verify(pub, AgentAuthPayload(agentID, serverNonce), signature)
+	span.End()
+	if !valid {
+		return nil, ErrAuthFailed
+	}
+
+	if err := s.repo.TouchLastSeen(agentID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// IsRevoked re-reads the agent's revocation state.
+func (s *Service) IsRevoked(agentID int) (bool, error) {
+	a, err := s.repo.FindByID(agentID)
+	if err != nil {
+		return false, err
+	}
+	return a == nil || a.RevokedAt != nil, nil
+}
+
+func (s *Service) requireMember(ctx context.Context, workspaceID, userID int) error {
+	ok, err := s.workspaces.IsMember(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (s *Service) requireOwner(ctx context.Context, workspaceID, userID int) error {
+	role, err := s.workspaces.Role(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	switch role {
+	case "":
+		return ErrForbidden
+	case org.RoleOwner:
+		return nil
+	default:
+		return ErrNotOwner
+	}
+}
+
+// eventAgentID reads the agent_id of an agent event: an int when published
+// in this process, a float64 once it has been through JSON.
+func eventAgentID(e events.Event) (int, bool) {
+	switch id := e.Data["agent_id"].(type) {
+	case int:
+		return id, true
+	case float64:
+		return int(id), true
+	}
+	return 0, false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
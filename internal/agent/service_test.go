@@ -0,0 +1,324 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/secret"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+// testEnv is a server wired as main wires it, on a fresh sqlite database.
+type testEnv struct {
+	orgs       *org.Service
+	workspaces *workspace.Service
+	secrets    *secret.Service
+	agents     *Service
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	dir := t.TempDir()
+	configtest.SQLite(t)
+
+	config.Agent.IdentityKeyFile = filepath.Join(dir, "identity.pem")
+	if err := InitIdentity(); err != nil {
+		t.Fatal(err)
+	}
+	config.Secrets.KeyFile = filepath.Join(dir, "secrets.key")
+	if err := secret.InitKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus(nil)
+	env := &testEnv{orgs: org.NewService()}
+	env.workspaces = workspace.NewService(env.orgs, bus)
+	env.secrets = secret.NewService(env.workspaces, bus)
+	env.agents = NewService(env.workspaces, bus)
+	env.agents.SetSecretSource(env.secrets)
+	bus.Subscribe(env.agents.HandleEvent)
+	return env
+}
+
+func createUser(t *testing.T, username string) int {
+	t.Helper()
+	u, err := auth.NewDefaultRepository().CreateUser(context.Background(), username, "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.ID
+}
+
+// enroll creates a workspace owned by a new user and enrolls an agent in
+// it, returning the workspace, owner and the agent with its key.
+func (env *testEnv) enroll(t *testing.T) (workspaceID, ownerID int, a *Agent, key ed25519.PrivateKey) {
+	t.Helper()
+	ctx := context.Background()
+	ownerID = createUser(t, "owner@example.com")
+	workspaceID, err := env.workspaces.Create(ctx, 0, "prod", "", ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := env.agents.CreateJoinToken(ctx, workspaceID, ownerID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = env.agents.Enroll(token, "web-01", EncodeKey(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return workspaceID, ownerID, a, key
+}
+
+// connect dials the agent endpoint and completes the handshake.
+func connect(t *testing.T, ctx context.Context, srv *httptest.Server, a *Agent, key ed25519.PrivateKey) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+
+	var challenge Message
+	if err := wsjson.Read(ctx, conn, &challenge); err != nil || challenge.Type != MsgChallenge {
+		t.Fatalf("challenge = %+v, %v", challenge, err)
+	}
+	serverNonce, err := base64.StdEncoding.DecodeString(challenge.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentNonce, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := Message{
+		Type:      MsgHello,
+		AgentID:   a.ID,
+		Nonce:     base64.StdEncoding.EncodeToString(agentNonce),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, AgentAuthPayload(a.ID, serverNonce))),
+	}
+	if err := wsjson.Write(ctx, conn, hello); err != nil {
+		t.Fatal(err)
+	}
+
+	var welcome Message
+	if err := wsjson.Read(ctx, conn, &welcome); err != nil || welcome.Type != MsgWelcome {
+		t.Fatalf("welcome = %+v, %v", welcome, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(welcome.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverPub, err := DecodeKey(ServerPublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(serverPub, ServerAuthPayload(a.ID, agentNonce), sig) {
+		t.Fatal("welcome signature does not verify against the server key")
+	}
+	return conn
+}
+
+func fetch(t *testing.T, ctx context.Context, conn *websocket.Conn) map[string]string {
+	t.Helper()
+	if err := wsjson.Write(ctx, conn, Message{Type: MsgFetch}); err != nil {
+		t.Fatal(err)
+	}
+	var reply Message
+	if err := wsjson.Read(ctx, conn, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type != MsgSecrets {
+		t.Fatalf("fetch reply = %+v, want secrets", reply)
+	}
+	return reply.Secrets
+}
+
+func TestAgentFetchesSecretsThroughHub(t *testing.T) {
+	env := newTestEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	workspaceID, ownerID, a, key := env.enroll(t)
+	if _, _, err := env.secrets.Set(ctx, workspaceID, "DB_PASSWORD", "hunter2", ownerID); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(NewHandler(env.agents).Connect))
+	defer srv.Close()
+	conn := connect(t, ctx, srv, a, key)
+
+	got := fetch(t, ctx, conn)
+	if len(got) != 1 || got["DB_PASSWORD"] != "hunter2" {
+		t.Fatalf("secrets = %v, want DB_PASSWORD=hunter2", got)
+	}
+	if !env.agents.Hub().Connected(a.ID) {
+		t.Fatal("agent is not registered on the hub")
+	}
+
+	// A rotation is pushed to the agent, which fetches the new value.
+	if _, err := env.secrets.Rotate(ctx, workspaceID, "DB_PASSWORD", "correct-horse", ownerID); err != nil {
+		t.Fatal(err)
+	}
+	var changed Message
+	if err := wsjson.Read(ctx, conn, &changed); err != nil || changed.Type != MsgChanged {
+		t.Fatalf("push = %+v, %v; want changed", changed, err)
+	}
+	if got := fetch(t, ctx, conn); got["DB_PASSWORD"] != "correct-horse" {
+		t.Fatalf("secrets after rotation = %v", got)
+	}
+}
+
+func TestJoinTokensAndRevocationRequireOwner(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	ownerID := createUser(t, "owner@example.com")
+	memberID := createUser(t, "member@example.com")
+	o, err := env.orgs.Create("acme", ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.orgs.AddMember(o.ID, "member@example.com", org.RoleMember, ownerID); err != nil {
+		t.Fatal(err)
+	}
+	workspaceID, err := env.workspaces.Create(ctx, o.ID, "prod", "", ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := env.agents.CreateJoinToken(ctx, workspaceID, memberID, 0); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("member CreateJoinToken err = %v, want ErrNotOwner", err)
+	}
+	outsiderID := createUser(t, "outsider@example.com")
+	if _, _, err := env.agents.CreateJoinToken(ctx, workspaceID, outsiderID, 0); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("outsider CreateJoinToken err = %v, want ErrForbidden", err)
+	}
+
+	token, _, err := env.agents.CreateJoinToken(ctx, workspaceID, ownerID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := env.agents.Enroll(token, "web-01", EncodeKey(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.agents.Revoke(ctx, a.ID, memberID); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("member Revoke err = %v, want ErrNotOwner", err)
+	}
+	if err := env.agents.Revoke(ctx, a.ID, ownerID); err != nil {
+		t.Fatalf("owner Revoke: %v", err)
+	}
+}
+
+func TestRevokeDisconnectsAndFetchRechecks(t *testing.T) {
+	env := newTestEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	workspaceID, ownerID, a, key := env.enroll(t)
+	srv := httptest.NewServer(http.HandlerFunc(NewHandler(env.agents).Connect))
+	defer srv.Close()
+
+	// Revoked by another instance: no event reaches this hub, so the next
+	// fetch must notice on its own.
+	conn := connect(t, ctx, srv, a, key)
+	fetch(t, ctx, conn)
+	if err := env.agents.repo.Revoke(a.ID, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if err := wsjson.Write(ctx, conn, Message{Type: MsgFetch}); err != nil {
+		t.Fatal(err)
+	}
+	var reply Message
+	err := wsjson.Read(ctx, conn, &reply)
+	if websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Fatalf("fetch after revoke = %+v, %v; want policy violation close", reply, err)
+	}
+
+	// Revoked here: the agent.revoked event drops the open connection.
+	token, _, err := env.agents.CreateJoinToken(ctx, workspaceID, ownerID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, bKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := env.agents.Enroll(token, "web-02", EncodeKey(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn = connect(t, ctx, srv, b, bKey)
+	fetch(t, ctx, conn)
+	if err := env.agents.Revoke(ctx, b.ID, ownerID); err != nil {
+		t.Fatal(err)
+	}
+	if err := wsjson.Read(ctx, conn, &reply); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Fatalf("read after revoke = %+v, %v; want policy violation close", reply, err)
+	}
+}
+
+func TestTrashedWorkspaceServesNoSecrets(t *testing.T) {
+	env := newTestEnv(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	workspaceID, ownerID, a, key := env.enroll(t)
+	if _, _, err := env.secrets.Set(ctx, workspaceID, "DB_PASSWORD", "hunter2", ownerID); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(NewHandler(env.agents).Connect))
+	defer srv.Close()
+	conn := connect(t, ctx, srv, a, key)
+	fetch(t, ctx, conn)
+
+	if err := env.workspaces.Delete(ctx, workspaceID, ownerID); err != nil {
+		t.Fatal(err)
+	}
+	var reply Message
+	if err := wsjson.Read(ctx, conn, &reply); websocket.CloseStatus(err) != websocket.StatusPolicyViolation {
+		t.Fatalf("read after delete = %+v, %v; want policy violation close", reply, err)
+	}
+	if _, err := env.agents.SecretsFor(a); !errors.Is(err, secret.ErrWorkspaceInactive) {
+		t.Fatalf("SecretsFor trashed workspace err = %v, want ErrWorkspaceInactive", err)
+	}
+	if _, err := env.agents.Authenticate(ctx, a.ID, nil, nil); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("Authenticate in trashed workspace err = %v, want ErrAuthFailed", err)
+	}
+
+	if err := env.workspaces.Restore(ctx, workspaceID, ownerID); err != nil {
+		t.Fatal(err)
+	}
+	got := fetch(t, ctx, connect(t, ctx, srv, a, key))
+	if got["DB_PASSWORD"] != "hunter2" {
+		t.Fatalf("secrets after restore = %v", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Package apierror defines the JSON error envelope returned by every API
+// endpoint:
+//
+//	{"error": {"code": "conflict", "message": "...", "request_id": "...", "fields": [...]}}
+//
+// Code is stable and meant for clients to branch on; Message is for humans.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/requestid"
+)
+
+// Machine-readable error codes.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeBadGateway       = "bad_gateway"
+)
+
+// FieldError points at one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error with an HTTP status and a stable code. Services may
+// return it directly (often as a package-level sentinel); anything else that
+// reaches Write is treated as an internal error.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	// Allow is sent as the Allow header with 405 responses.
+	Allow []string
+	// RetryAfter is sent as the Retry-After header, in whole seconds.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Validation reports one or more invalid fields with 422.
+func Validation(fields ...FieldError) *Error {
+	msg := "request validation failed"
+	if len(fields) == 1 {
+		msg = fields[0].Field + ": " + fields[0].Message
+	}
+	return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Message: msg, Fields: fields}
+}
+
+// Field is shorthand for a single-field validation error.
+func Field(field, message string) *Error {
+	return Validation(FieldError{Field: field, Message: message})
+}
+
+func MethodNotAllowed(allow ...string) *Error {
+	return &Error{
+		Status:  http.StatusMethodNotAllowed,
+		Code:    CodeMethodNotAllowed,
+		Message: "method not allowed",
+		Allow:   allow,
+	}
+}
+
+// TooManyRequests reports a throttled request with 429; the client may
+// retry after retryAfter.
+func TooManyRequests(message string, retryAfter time.Duration) *Error {
+	return &Error{
+		Status:     http.StatusTooManyRequests,
+		Code:       CodeRateLimited,
+		Message:    message,
+		RetryAfter: retryAfter,
+	}
+}
+
+// BadGateway reports with 502 that a service the request depends on, such
+// as an identity provider, failed.
+func BadGateway(message string) *Error {
+	return New(http.StatusBadGateway, CodeBadGateway, message)
+}
+
+// Envelope is the wire format of an error response.
+type Envelope struct {
+	Error Detail `json:"error"`
+}
+
+// Detail is the content of an error response.
+type Detail struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// Write sends err as the JSON envelope. Errors that are not *Error become a
+// 500 with a generic message; the cause is logged with the request ID.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	reqID := requestid.FromContext(r.Context())
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		slog.ErrorContext(r.Context(), "internal error", "method", r.Method, "path", r.URL.Path, "err", err)
+		apiErr = New(http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+
+	if len(apiErr.Allow) > 0 {
+		w.Header().Set("Allow", strings.Join(apiErr.Allow, ", "))
+	}
+	if apiErr.RetryAfter > 0 {
+		secs := int((apiErr.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(Envelope{Error: Detail{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		RequestID: reqID,
+		Fields:    apiErr.Fields,
+	}})
+}
+
+// DecodeJSON decodes the request body into v, reporting malformed JSON as a
+// bad_request error.
+func DecodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return BadRequest(fmt.Sprintf("invalid request body: %v", err))
+	}
+	return nil
+}
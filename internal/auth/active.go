@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// activeTTL is how long RequireAuth trusts that a user is still active
+// before asking the database again. It bounds how long a user deactivated
+// on another instance keeps access; on this instance ForgetActive ends it
+// at once.
+const activeTTL = 5 * time.Second
+
+// activeUsers remembers which users were recently found active, so that a
+// burst of requests with one session costs a single query. Inactive users
+// are not remembered, so reactivation takes effect on the next request.
+type activeUsers struct {
+	mu     sync.Mutex
+	expiry map[int]time.Time
+	pruned time.Time
+}
+
+// IsActive reports whether the user exists and has not been deactivated,
+// trusting a recent positive answer for activeTTL.
+func (s *AuthService) IsActive(ctx context.Context, userID int) (bool, error) {
+	now := time.Now()
+	s.active.mu.Lock()
+	expires, ok := s.active.expiry[userID]
+	s.active.mu.Unlock()
+	if ok && now.Before(expires) {
+		return true, nil
+	}
+
+	active, err := s.repo.IsActive(ctx, userID)
+	if err != nil || !active {
+		s.ForgetActive(userID)
+		return active, err
+	}
+
+	s.active.mu.Lock()
+	defer s.active.mu.Unlock()
+	if now.Sub(s.active.pruned) >= pruneInterval {
+		for id, expires := range s.active.expiry {
+			if now.After(expires) {
+				delete(s.active.expiry, id)
+			}
+		}
+		s.active.pruned = now
+	}
+	s.active.expiry[userID] = now.Add(activeTTL)
+	return true, nil
+}
+
+// ForgetActive makes the next request of the user check the database again.
+// Call it when the user is deactivated or deleted.
+func (s *AuthService) ForgetActive(userID int) {
+	s.active.mu.Lock()
+	defer s.active.mu.Unlock()
+	delete(s.active.expiry, userID)
+}
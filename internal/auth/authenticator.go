@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// Authenticator checks a username and password against one source of
+// users. AuthService.Authenticate tries its authenticators in order.
+type Authenticator interface {
+	// Name identifies the backend in config and logs, e.g. "local".
+	Name() string
+	// Authenticate returns the identity for valid credentials. Wrong
+	// credentials and unknown users are ErrInvalidCredentials, so that the
+	// next backend is tried; any other error means the backend failed.
+	// A backend whose server cannot be reached wraps ErrBackendUnavailable.
+	Authenticate(ctx context.Context, username, password string) (*Identity, error)
+}
+
+// Identity is who an Authenticator found. Backends that keep users in the
+// users table set User; external ones leave it nil, and the user is looked
+// up, or provisioned, by Source and Subject.
+type Identity struct {
+	Username string
+	User     *User
+	// Source names the external backend and Subject is the user's stable
+	// identifier there. Accounts are linked by the pair, never by Username
+	// alone.
+	Source  string
+	Subject string
+	// Groups are an external user's directory groups, which GroupRoles
+	// map to organization roles.
+	Groups     []string
+	GroupRoles []config.GroupRole
+	// Provision creates an external user on their first login.
+	Provision bool
+}
+
+// localAuthenticator checks passwords stored in the users table.
+type localAuthenticator struct {
+	repo *Repository
+}
+
+// NewLocalAuthenticator returns the "local" backend.
+func NewLocalAuthenticator() Authenticator {
+	return &localAuthenticator{repo: NewDefaultRepository()}
+}
+
+func (a *localAuthenticator) Name() string {
+	return "local"
+}
+
+func (a *localAuthenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	// Users created by single sign-on or LDAP have no password and cannot
+	// log in here.
+	u, err := a.repo.FindByUsername(ctx, username)
+	if isNoRows(err) {
+		// Spend as long as a real check, so timing does not reveal
+		// which usernames exist.
+		checkPassword(dummyHash(), password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	ok, rehash := checkPassword(u.Password, password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if rehash {
+		// Stored before passwords were hashed; hash it now that we have it.
+		if hash, err := HashPassword(password); err == nil {
+			if err := a.repo.SetPasswordHash(ctx, u.ID, hash); err != nil {
+				slog.WarnContext(ctx, "failed to hash stored password", "user_id", u.ID, "err", err)
+			}
+		}
+	}
+	return &Identity{Username: u.Username, User: u}, nil
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+const (
+	sessionCookieBase = "token"
+	csrfCookieBase    = "csrf_token"
+)
+
+// cookieName prefixes base so that browsers enforce how the cookie was set:
+// "__Host-" for Secure host-only cookies, "__Secure-" for Secure cookies
+// shared with a Domain.
+func cookieName(base string) string {
+	switch {
+	case !cookieSecure():
+		return base
+	case config.Cookie.Domain == "":
+		return "__Host-" + base
+	default:
+		return "__Secure-" + base
+	}
+}
+
+func cookieSecure() bool {
+	return config.TLS.Enabled() || config.Cookie.Secure
+}
+
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(config.Cookie.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// sessionLifetime is how long both the session cookie and its JWT last.
+func sessionLifetime() time.Duration {
+	if config.Cookie.LifetimeHours <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(config.Cookie.LifetimeHours) * time.Hour
+}
+
+// newCookie builds a cookie with the configured attributes. maxAge -1
+// deletes it.
+func newCookie(base, value string, httpOnly bool, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     cookieName(base),
+		Value:    value,
+		Path:     "/", // sent to all routes; required by __Host-
+		Domain:   config.Cookie.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   cookieSecure(),
+		SameSite: cookieSameSite(),
+	}
+}
+
+// setSession sets the HttpOnly session cookie and the script-readable CSRF
+// cookie, and returns the CSRF token.
+func setSession(w http.ResponseWriter, token string) string {
+	maxAge := int(sessionLifetime().Seconds())
+	csrf := CSRFToken(token)
+	http.SetCookie(w, newCookie(sessionCookieBase, token, true, maxAge))
+	http.SetCookie(w, newCookie(csrfCookieBase, csrf, false, maxAge))
+	sessions.start(token, time.Now().Add(sessionLifetime()))
+	return csrf
+}
+
+func clearSession(w http.ResponseWriter) {
+	http.SetCookie(w, newCookie(sessionCookieBase, "", true, -1))
+	http.SetCookie(w, newCookie(csrfCookieBase, "", false, -1))
+}
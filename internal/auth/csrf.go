@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/middleware"
+)
+
+// Cookie sessions must echo their CSRF token in CSRFHeader on every
+// state-changing request. The token is also set in a script-readable cookie
+// (csrf_token, prefixed like the session cookie) so that the frontend can
+// pick it up after a reload.
+const CSRFHeader = "X-CSRF-Token"
+
+var (
+	ErrCSRFToken  = apierror.Forbidden("missing or invalid CSRF token")
+	ErrCSRFOrigin = apierror.Forbidden("cross-site request refused")
+)
+
+// CSRFToken derives the CSRF token of a session token. Being an HMAC under
+// the JWT secret, it needs no storage, cannot be computed by another site
+// and changes with every login.
+func CSRFToken(session string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("csrf:" + session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF guards a state-changing request authenticated by the session
+// cookie. A cross-site Origin (or Referer) is refused outright; otherwise
+// the request must carry the session's CSRF token.
+func checkCSRF(r *http.Request, session string) error {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source != "" && !sameSite(r, source) {
+		return ErrCSRFOrigin
+	}
+
+	want := CSRFToken(session)
+	got := r.Header.Get(CSRFHeader)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return ErrCSRFToken
+	}
+	return nil
+}
+
+// sameSite reports whether source, an Origin or Referer, is this server or
+// a frontend origin named by the CORS policy. A "*" entry opens the API to
+// scripts on any site but is not a list of trusted frontends, so it does not
+// count here.
+func sameSite(r *http.Request, source string) bool {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	trusted := slices.DeleteFunc(slices.Clone(config.CORS.AllowedOrigins), func(p string) bool { return p == "*" })
+	return middleware.OriginAllowed(trusted, u.Scheme+"://"+u.Host)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
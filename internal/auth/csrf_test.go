@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+func TestCheckCSRFOrigins(t *testing.T) {
+	jwtSecret = []byte("test-secret")
+	defer func(origins []string) { config.CORS.AllowedOrigins = origins }(config.CORS.AllowedOrigins)
+
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    error
+	}{
+		{"same host", nil, "http://api.example.com", nil},
+		{"listed frontend", []string{"https://app.example.com"}, "https://app.example.com", nil},
+		{"subdomain pattern", []string{"https://*.example.com"}, "https://ui.example.com", nil},
+		{"other site", []string{"https://app.example.com"}, "https://evil.example.net", ErrCSRFOrigin},
+		{"wildcard is not a trusted frontend", []string{"*"}, "https://evil.example.net", ErrCSRFOrigin},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config.CORS.AllowedOrigins = tc.allowed
+			r := httptest.NewRequest(http.MethodPost, "http://api.example.com/api/v1/workspaces", nil)
+			r.Header.Set("Origin", tc.origin)
+			r.Header.Set(CSRFHeader, CSRFToken("session"))
+			if err := checkCSRF(r, "session"); !errors.Is(err, tc.want) {
+				t.Fatalf("checkCSRF = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,19 @@
 package auth
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
 )
 
+// maxCredentialsBody bounds how much of a login body LoginKeys reads.
+const maxCredentialsBody = 64 << 10
+
 type LoginHandler struct {
 	service *AuthService
 }
@@ -13,107 +22,137 @@ func NewLoginHandler(s *AuthService) *LoginHandler {
 	return &LoginHandler{service: s}
 }
 
+// Credentials is the request body for signup and login.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Session is returned by signup and login alongside the cookie. Token is the
+// same JWT, for clients that authenticate with a bearer header instead; it is
+// only included when they ask for it with ?token=true, so that a page script
+// never sees the HttpOnly cookie's value. Cookie sessions send CSRFToken back
+// in the X-CSRF-Token header.
+type Session struct {
+	Message   string `json:"message"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Token     string `json:"token,omitempty"`
+	CSRFToken string `json:"csrf_token"`
+}
+
+// requestedToken returns token if the client asked for it with ?token=true.
+func requestedToken(r *http.Request, token string) string {
+	if want, _ := strconv.ParseBool(r.URL.Query().Get("token")); want {
+		return token
+	}
+	return ""
+}
+
 // Login authenticates user and returns a JWT token + sets HttpOnly cookie
 func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+	var body Credentials
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-	}
-	_ = json.NewDecoder(r.Body).Decode(&body)
-
 	// Validate credentials from DB
-	user, err := h.service.Authenticate(body.Username, body.Password)
+	user, err := h.service.Authenticate(r.Context(), body.Username, body.Password)
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Generate JWT
-	token, err := GenerateToken(user.ID, user.Username)
+	token, err := GenerateToken(r.Context(), user.ID, user.Username)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// -------------------------------------------------------------------------
-	// NEW: Set JWT as HttpOnly Cookie
-	// -------------------------------------------------------------------------
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",              // cookie sent to all routes
-		HttpOnly: true,             // JS cannot read it
-		Secure:   false,            // ❗ change to true in HTTPS/production
-		SameSite: http.SameSiteLaxMode,
-	})
+	// Set the JWT as an HttpOnly cookie, with its CSRF token beside it.
+	csrf := setSession(w, token)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":  "logged in successfully",
-		"user_id":  user.ID,
-		"username": user.Username,
+	json.NewEncoder(w).Encode(Session{
+		Message:   "logged in successfully",
+		UserID:    user.ID,
+		Username:  user.Username,
+		Token:     requestedToken(r, token),
+		CSRFToken: csrf,
 	})
 }
 
-// Signup creates a new user account.
-func (h *LoginHandler) Signup(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
-		return
+// LoginKeys draws login attempts from a bucket per client IP and one per
+// username, so that neither many passwords against one account nor one
+// password against many accounts gets far. The body is put back for Login.
+func LoginKeys(r *http.Request) []string {
+	keys := []string{"login:ip:" + ratelimit.ClientIP(r)}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCredentialsBody))
+	if err != nil {
+		return keys
 	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
 
-	var body struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+	var creds Credentials
+	if json.Unmarshal(body, &creds) == nil && creds.Username != "" {
+		keys = append(keys, "login:user:"+creds.Username)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	return keys
+}
+
+// UnlockAccount clears a username's failed logins and lockout.
+func (h *LoginHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.Unlock(r.PathValue("username"), GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "account unlocked",
+	})
+}
 
-	user, err := h.service.Signup(body.Username, body.Password)
+// Signup creates a new user account.
+func (h *LoginHandler) Signup(w http.ResponseWriter, r *http.Request) {
+	var body Credentials
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	user, err := h.service.Signup(r.Context(), body.Username, body.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Optionally log the user in immediately by issuing a token.
-	token, err := GenerateToken(user.ID, user.Username)
+	token, err := GenerateToken(r.Context(), user.ID, user.Username)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
-	})
+	csrf := setSession(w, token)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":  "signed up successfully",
-		"user_id":  user.ID,
-		"username": user.Username,
+	json.NewEncoder(w).Encode(Session{
+		Message:   "signed up successfully",
+		UserID:    user.ID,
+		Username:  user.Username,
+		Token:     requestedToken(r, token),
+		CSRFToken: csrf,
 	})
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,  // delete immediately
-	})
+	if token, _, ok := requestToken(r); ok {
+		sessions.end(token)
+	}
+	clearSession(w)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "logged out",
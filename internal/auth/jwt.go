@@ -1,11 +1,14 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amartya2002/secretlane/internal/tracing"
 )
 
 var jwtSecret []byte
@@ -25,13 +28,15 @@ type Claims struct {
 }
 
 // GenerateToken creates a signed JWT token for a user
-func GenerateToken(userID int, username string) (string, error) {
+func GenerateToken(ctx context.Context, userID int, username string) (string, error) {
+	_, span := tracing.Start(ctx, "jwt.sign", tracing.KindInternal)
+	defer span.End()
 
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(sessionLifetime())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   username,
 		},
@@ -42,7 +47,9 @@ func GenerateToken(userID int, username string) (string, error) {
 }
 
 // ValidateToken parses and validates the JWT
-func ValidateToken(tokenString string) (*Claims, error) {
+func ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	_, span := tracing.Start(ctx, "jwt.verify", tracing.KindInternal)
+	defer span.End()
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
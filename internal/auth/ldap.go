@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+// ldapAuthenticator finds the user with the service account, then binds as
+// them to check the password.
+type ldapAuthenticator struct {
+	cfg        config.LDAPConfig
+	tls        *tls.Config
+	groupRoles []config.GroupRole
+	provision  bool
+}
+
+// NewLDAPAuthenticator checks cfg and returns the "ldap" backend. The
+// server is not contacted until the first login.
+func NewLDAPAuthenticator(cfg config.LDAPConfig) (Authenticator, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("ldap.url %q must be ldap://host or ldaps://host", cfg.URL)
+	}
+	if cfg.StartTLS && u.Scheme == "ldaps" {
+		return nil, errors.New("ldap.start_tls cannot be used with an ldaps:// url")
+	}
+	if cfg.BaseDN == "" {
+		return nil, errors.New("ldap.base_dn is required")
+	}
+	if !strings.Contains(cfg.UserFilter, "{username}") {
+		return nil, errors.New("ldap.user_filter must contain {username}")
+	}
+	if _, err := ldap.CompileFilter(strings.ReplaceAll(cfg.UserFilter, "{username}", "x")); err != nil {
+		return nil, fmt.Errorf("ldap.user_filter: %w", err)
+	}
+	if err := ValidateGroupRoles("ldap.group_roles", cfg.GroupRoles); err != nil {
+		return nil, err
+	}
+
+	// StartTLS does not take the server name from the URL itself.
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname()}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ldap CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	// Directory names are case-insensitive, so groups are compared in
+	// lower case.
+	groupRoles := make([]config.GroupRole, len(cfg.GroupRoles))
+	for i, m := range cfg.GroupRoles {
+		m.Group = strings.ToLower(m.Group)
+		groupRoles[i] = m
+	}
+
+	return &ldapAuthenticator{
+		cfg:        cfg,
+		tls:        tlsCfg,
+		groupRoles: groupRoles,
+		provision:  cfg.Provision == nil || *cfg.Provision,
+	}, nil
+}
+
+func (a *ldapAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a *ldapAuthenticator) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which succeeds.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	ctx, span := tracing.Start(ctx, "ldap.authenticate", tracing.KindClient)
+	defer span.End()
+	timeout := time.Duration(a.cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithTLSConfig(a.tls),
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, unavailable(err)
+	}
+	defer conn.Close()
+	// Closing the connection fails whatever request is waiting on it.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(a.tls); err != nil {
+			tracing.SetError(span, err)
+			return nil, unavailable(fmt.Errorf("ldap starttls: %w", err))
+		}
+	}
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			tracing.SetError(span, err)
+			return nil, unavailable(fmt.Errorf("ldap service account bind: %w", err))
+		}
+	}
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(timeout/time.Second), false, filter, []string{a.cfg.GroupAttribute}, nil,
+	))
+	// A size limit of two is only exceeded when the filter is ambiguous.
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		tracing.SetError(span, err)
+		return nil, unavailable(fmt.Errorf("ldap user search: %w", err))
+	}
+	switch {
+	case err != nil || len(res.Entries) > 1:
+		slog.WarnContext(ctx, "ldap user filter matches several entries", "username", username)
+		return nil, ErrInvalidCredentials
+	case len(res.Entries) == 0:
+		return nil, ErrInvalidCredentials
+	}
+
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		tracing.SetError(span, err)
+		return nil, unavailable(fmt.Errorf("ldap user bind: %w", err))
+	}
+
+	return &Identity{
+		Username: username,
+		// DNs compare case-insensitively. An entry that is renamed or moved
+		// gets a new DN and no longer matches its account.
+		Source:     "ldap",
+		Subject:    strings.ToLower(entry.DN),
+		Groups:     ldapGroups(entry.GetEqualFoldAttributeValues(a.cfg.GroupAttribute)),
+		GroupRoles: a.groupRoles,
+		Provision:  a.provision,
+	}, nil
+}
+
+// unavailable marks err as the directory failing rather than the
+// credentials being wrong.
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+}
+
+// ldapGroups lists each group by its DN and by its first RDN value, e.g.
+// "cn=admins,ou=groups,dc=example,dc=com" and "admins", in lower case.
+func ldapGroups(values []string) []string {
+	groups := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		groups = append(groups, v)
+		rdn, _, _ := strings.Cut(v, ",")
+		if _, name, ok := strings.Cut(rdn, "="); ok && name != v {
+			groups = append(groups, strings.TrimSpace(name))
+		}
+	}
+	return groups
+}
@@ -3,6 +3,12 @@ package auth
 import (
 	"context"
 	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/logging"
 )
 
 // Keys for storing values inside context
@@ -13,34 +19,48 @@ const (
 	ContextUsernameKey contextKey = "username"
 )
 
-// RequireJWT protects routes and extracts claims into context
-func RequireAuth(next http.Handler) http.Handler {
+// RequireAuth protects routes and extracts claims into context.
+func (s *AuthService) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		// Extract token from Authorization header
-		// authHeader := r.Header.Get("Authorization")
-		// if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		// 	http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
-		// 	return
-		// }
-		// tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// API clients send the token as a bearer credential; browsers use
+		// the HttpOnly cookie set at login.
+		tokenString, bearer, ok := requestToken(r)
+		if !ok {
+			apierror.Write(w, r, apierror.Unauthorized("missing auth cookie or bearer token"))
+			return
+		}
 
-		cookie, err := r.Cookie("token")
+		// Validate JWT
+		claims, err := ValidateToken(r.Context(), tokenString)
 		if err != nil {
-			http.Error(w, "Missing auth cookie", http.StatusUnauthorized)
+			apierror.Write(w, r, apierror.Unauthorized("invalid or expired token"))
 			return
 		}
 
-		tokenString := cookie.Value
-
-		// Validate JWT
-		claims, err := ValidateToken(tokenString)
+		// Tokens are stateless, so a deactivated or deleted user is caught
+		// here rather than when their token expires.
+		active, err := s.IsActive(r.Context(), claims.UserID)
 		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			apierror.Write(w, r, err)
 			return
 		}
+		if !active {
+			apierror.Write(w, r, ErrDeactivated)
+			return
+		}
+
+		// Browsers attach the cookie to cross-site requests too; bearer
+		// tokens are never sent implicitly and need no CSRF check.
+		if !bearer && !isSafeMethod(r.Method) {
+			if err := checkCSRF(r, tokenString); err != nil {
+				apierror.Write(w, r, err)
+				return
+			}
+		}
 
 		// Add user info to context
+		logging.SetUserID(r.Context(), claims.UserID)
 		ctx := context.WithValue(r.Context(), ContextUserIDKey, claims.UserID)
 		ctx = context.WithValue(ctx, ContextUsernameKey, claims.Username)
 
@@ -49,6 +69,39 @@ func RequireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// RequireAdmin lets through only the users listed in config.Auth.Admins.
+// It must run inside RequireAuth.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(config.Auth.Admins, GetUsername(r)) {
+			apierror.Write(w, r, apierror.Forbidden("admin access required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestToken returns the bearer token if there is one, else the session
+// cookie.
+func requestToken(r *http.Request) (token string, bearer, ok bool) {
+	if token, ok := bearerToken(r); ok {
+		return token, true, true
+	}
+	cookie, err := r.Cookie(cookieName(sessionCookieBase))
+	if err != nil {
+		return "", false, false
+	}
+	return cookie.Value, false, true
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
 // GetUserID returns authenticated user ID from context
 func GetUserID(r *http.Request) int {
 	val := r.Context().Value(ContextUserIDKey)
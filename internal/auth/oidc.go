@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/metrics"
+)
+
+const (
+	flowCookieBase = "oidc_flow"
+	// flowLifetime bounds how long the user may take at the provider.
+	flowLifetime = 10 * time.Minute
+)
+
+var (
+	ErrProviderUnavailable = apierror.BadGateway("identity provider unavailable")
+	ErrSignInExpired       = apierror.BadRequest("sign-in expired or was not started here, please try again")
+	ErrSignInFailed        = apierror.Unauthorized("sign-in with the identity provider failed")
+	ErrEmailUnverified     = apierror.Forbidden("the identity provider has not verified this email address")
+)
+
+// OIDCHandler signs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE, then starts the same session as Login.
+type OIDCHandler struct {
+	service  *AuthService
+	provider *oidcProvider
+}
+
+// NewOIDCHandler checks config.OIDC and returns the handler. The provider
+// is not contacted until the first sign-in.
+func NewOIDCHandler(s *AuthService) (*OIDCHandler, error) {
+	cfg := config.OIDC
+	if cfg.ClientID == "" {
+		return nil, errors.New("oidc.client_id is required")
+	}
+	u, err := url.Parse(cfg.RedirectURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("oidc.redirect_url %q must be an absolute URL", cfg.RedirectURL)
+	}
+	if err := ValidateGroupRoles("oidc.group_roles", cfg.GroupRoles); err != nil {
+		return nil, err
+	}
+	return &OIDCHandler{
+		service:  s,
+		provider: newOIDCProvider(cfg.Issuer, cfg.ClientID, cfg.ClientSecret, cfg.RedirectURL, cfg.Scopes),
+	}, nil
+}
+
+// oidcFlow is what the callback needs from the login that started it. It
+// travels in an HttpOnly cookie, signed so that it cannot be forged.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// flowKey signs flow cookies. It is derived from the JWT secret rather than
+// being the secret itself, so that a flow cookie is never a valid session.
+func flowKey() []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("oidc-flow"))
+	return mac.Sum(nil)
+}
+
+// Login sends the browser to the provider. ?redirect names the path to
+// return to afterwards.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	oauth, _, err := h.provider.discover(r.Context())
+	if err != nil {
+		slog.WarnContext(r.Context(), "oidc discovery failed", "issuer", config.OIDC.Issuer, "err", err)
+		apierror.Write(w, r, ErrProviderUnavailable)
+		return
+	}
+
+	flow := oidcFlow{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: localPath(r.URL.Query().Get("redirect")),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(flowLifetime)),
+		},
+	}
+	sealed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, flow).SignedString(flowKey())
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	http.SetCookie(w, flowCookie(sealed, int(flowLifetime.Seconds())))
+
+	target := h.provider.authCodeURL(oauth, flow.State, flow.Nonce, flow.Verifier)
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// Callback receives the provider's answer, verifies the ID token, signs the
+// user in and sends the browser on with the session cookie set.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	flow, err := readFlow(r)
+	// The flow is single use, whatever happens next.
+	http.SetCookie(w, flowCookie("", -1))
+	if err != nil {
+		apierror.Write(w, r, ErrSignInExpired)
+		return
+	}
+	if !hmac.Equal([]byte(q.Get("state")), []byte(flow.State)) {
+		apierror.Write(w, r, ErrSignInExpired)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		slog.WarnContext(ctx, "identity provider refused sign-in", "error", e, "description", q.Get("error_description"))
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		apierror.Write(w, r, ErrSignInFailed)
+		return
+	}
+	code := q.Get("code")
+	if code == "" {
+		apierror.Write(w, r, apierror.BadRequest("code is required"))
+		return
+	}
+
+	oauth, verifier, err := h.provider.discover(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "oidc discovery failed", "issuer", config.OIDC.Issuer, "err", err)
+		apierror.Write(w, r, ErrProviderUnavailable)
+		return
+	}
+	rawIDToken, err := h.provider.exchange(ctx, oauth, code, flow.Verifier)
+	if err != nil {
+		slog.WarnContext(ctx, "oidc code exchange failed", "err", err)
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		apierror.Write(w, r, ErrSignInFailed)
+		return
+	}
+	claims, err := h.provider.verify(ctx, verifier, rawIDToken, flow.Nonce)
+	if err != nil {
+		slog.WarnContext(ctx, "oidc id token rejected", "err", err)
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		apierror.Write(w, r, ErrSignInFailed)
+		return
+	}
+
+	email, _ := claims[config.OIDC.EmailClaim].(string)
+	email = strings.TrimSpace(email)
+	if email == "" {
+		slog.WarnContext(ctx, "oidc id token has no email", "claim", config.OIDC.EmailClaim)
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		apierror.Write(w, r, ErrSignInFailed)
+		return
+	}
+	// A provider that does not say the address is verified may let anyone
+	// claim it.
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		apierror.Write(w, r, ErrEmailUnverified)
+		return
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		slog.WarnContext(ctx, "oidc id token has no subject")
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		apierror.Write(w, r, ErrSignInFailed)
+		return
+	}
+
+	user, err := h.service.signInExternal(ctx, &Identity{
+		Username: email,
+		// sub is only unique at its issuer.
+		Source:     "oidc",
+		Subject:    h.provider.issuer + " " + sub,
+		Groups:     stringList(claims[config.OIDC.GroupsClaim]),
+		GroupRoles: config.OIDC.GroupRoles,
+		Provision:  config.OIDC.Provision == nil || *config.OIDC.Provision,
+	})
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	logging.SetUserID(ctx, user.ID)
+
+	token, err := GenerateToken(ctx, user.ID, user.Username)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	setSession(w, token)
+
+	target := flow.Redirect
+	if target == "" {
+		target = config.OIDC.PostLoginRedirect
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func readFlow(r *http.Request) (*oidcFlow, error) {
+	cookie, err := r.Cookie(cookieName(flowCookieBase))
+	if err != nil {
+		return nil, err
+	}
+	flow := &oidcFlow{}
+	_, err = jwt.ParseWithClaims(cookie.Value, flow, func(*jwt.Token) (any, error) {
+		return flowKey(), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return flow, nil
+}
+
+// flowCookie is the session cookie's sibling for the sign-in flow. The
+// provider redirects back cross-site, so it is never SameSite=Strict.
+func flowCookie(value string, maxAge int) *http.Cookie {
+	c := newCookie(flowCookieBase, value, true, maxAge)
+	if c.SameSite == http.SameSiteStrictMode {
+		c.SameSite = http.SameSiteLaxMode
+	}
+	return c
+}
+
+// localPath returns p if it is a path on this server, else "". Anything
+// else would make the callback an open redirect.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.Contains(p, `\`) {
+		return ""
+	}
+	u, err := url.Parse(p)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return ""
+	}
+	return p
+}
+
+// stringList reads a groups claim, which providers send as a list of
+// strings or, for a single group, a plain string.
+func stringList(v any) []string {
+	switch x := v.(type) {
+	case string:
+		return []string{x}
+	case []any:
+		list := make([]string, 0, len(x))
+		for _, item := range x {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// randomToken returns 32 random bytes, base64url-encoded: enough for state
+// and nonce.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
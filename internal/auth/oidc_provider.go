@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+const oidcHTTPTimeout = 10 * time.Second
+
+// idTokenAlgorithms are the signing algorithms accepted on ID tokens; the
+// verifier also checks that the key type matches.
+var idTokenAlgorithms = []string{
+	oidc.RS256, oidc.RS384, oidc.RS512, oidc.PS256, oidc.PS384, oidc.PS512,
+	oidc.ES256, oidc.ES384, oidc.ES512, oidc.EdDSA,
+}
+
+// oidcProvider talks to the identity provider. Discovery happens on first
+// use rather than at startup, so the server starts while the provider is
+// down and sign-in works once it is back.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOIDCProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string) *oidcProvider {
+	return &oidcProvider{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// discover fetches the provider's discovery document once and returns the
+// OAuth 2.0 client and ID token verifier built from it. The document must
+// be the issuer's own (OpenID Connect Discovery 4.3); go-oidc checks that.
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "oidc.discover", tracing.KindClient)
+	defer span.End()
+
+	// The key set keeps this client for its later fetches.
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, p.client), p.issuer)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, nil, err
+	}
+	endpoint := provider.Endpoint()
+	if p.clientSecret == "" {
+		// A public client, relying on PKCE alone.
+		endpoint.AuthStyle = oauth2.AuthStyleInParams
+	} else {
+		endpoint.AuthStyle = oauth2.AuthStyleInHeader
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		Endpoint:     endpoint,
+		RedirectURL:  p.redirectURL,
+		Scopes:       p.scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{
+		ClientID:             p.clientID,
+		SupportedSigningAlgs: idTokenAlgorithms,
+	})
+	return p.oauth, p.verifier, nil
+}
+
+// authCodeURL is where the browser is sent to sign in.
+func (p *oidcProvider) authCodeURL(oauth *oauth2.Config, state, nonce, verifier string) string {
+	return oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// exchange trades an authorization code and its PKCE verifier for the raw
+// ID token.
+func (p *oidcProvider) exchange(ctx context.Context, oauth *oauth2.Config, code, verifier string) (string, error) {
+	ctx, span := tracing.Start(ctx, "oidc.token", tracing.KindClient)
+	defer span.End()
+
+	tok, err := oauth.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		tracing.SetError(span, err)
+		return "", err
+	}
+	raw, _ := tok.Extra("id_token").(string)
+	if raw == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return raw, nil
+}
+
+// verify checks the ID token's signature against the provider's keys, its
+// issuer, audience, expiry and nonce, and returns its claims.
+func (p *oidcProvider) verify(ctx context.Context, verifier *oidc.IDTokenVerifier, raw, nonce string) (map[string]any, error) {
+	ctx, span := tracing.Start(ctx, "oidc.verify_id_token", tracing.KindInternal)
+	defer span.End()
+
+	idToken, err := verifier.Verify(oidc.ClientContext(ctx, p.client), raw)
+	if err != nil {
+		tracing.SetError(span, err)
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	// With several audiences the token must have been issued to us.
+	if len(idToken.Audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.clientID {
+			return nil, errors.New("id token was issued to another client")
+		}
+	}
+	return claims, nil
+}
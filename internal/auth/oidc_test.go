@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+)
+
+const testClientID = "secretlane"
+
+// mockIdP is an OpenID provider serving discovery, a key set, an
+// authorization endpoint that signs in whoever Next describes, and a token
+// endpoint that checks the PKCE verifier.
+type mockIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// Signer signs ID tokens; it is key unless a test swaps it.
+	Signer *rsa.PrivateKey
+	// Next are the claims of the next sign-in. A "nonce" among them
+	// replaces the one the client sent.
+	Next jwt.MapClaims
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, Signer: key, codes: make(map[string]authorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != testClientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "bad authorization request", http.StatusBadRequest)
+			return
+		}
+		code := randomToken()
+		idp.mu.Lock()
+		idp.codes[code] = authorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: idp.Next}
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		idp.mu.Lock()
+		auth, ok := idp.codes[r.FormValue("code")]
+		delete(idp.codes, r.FormValue("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   testClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": auth.nonce,
+		}
+		for k, v := range auth.claims {
+			claims[k] = v
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "test"
+		raw, err := tok.SignedString(idp.Signer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": randomToken(), "id_token": raw, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// recordingSyncer records the roles each user was last given.
+type recordingSyncer map[int]map[int]string
+
+func (s recordingSyncer) SyncRoles(userID int, roles map[int]string) error {
+	s[userID] = roles
+	return nil
+}
+
+func setupOIDC(t *testing.T) (*OIDCHandler, *mockIdP, recordingSyncer) {
+	t.Helper()
+	configtest.SQLite(t)
+	jwtSecret = []byte("test-secret")
+
+	idp := newMockIdP(t)
+	config.OIDC = config.OIDCConfig{
+		Issuer:      idp.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://secretlane.example.com/api/v1/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+		EmailClaim:  "email",
+		GroupsClaim: "groups",
+		GroupRoles: []config.GroupRole{
+			{Group: "platform", OrgID: 1, Role: "owner"},
+			{Group: "dev", OrgID: 2, Role: "member"},
+		},
+		PostLoginRedirect: "/",
+	}
+	t.Cleanup(func() { config.OIDC = config.OIDCConfig{} })
+
+	roles := recordingSyncer{}
+	h, err := NewOIDCHandler(NewAuthService(nil, nil, roles, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, idp, roles
+}
+
+// startSignIn runs Login and returns the flow cookie and the provider URL
+// it sent the browser to.
+func startSignIn(t *testing.T, h *OIDCHandler) (*http.Cookie, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login = %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("login set %d cookies, want the flow cookie", len(cookies))
+	}
+	return cookies[0], rec.Header().Get("Location")
+}
+
+// authorize signs in at the provider and returns the callback URL it
+// redirects back to.
+func authorize(t *testing.T, authURL string) *url.URL {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize = %s", resp.Status)
+	}
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func callback(h *OIDCHandler, flow *http.Cookie, u *url.URL) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, u.String(), nil)
+	if flow != nil {
+		r.AddCookie(flow)
+	}
+	rec := httptest.NewRecorder()
+	h.Callback(rec, r)
+	return rec
+}
+
+// signIn runs the whole flow for a user with the given claims.
+func signIn(t *testing.T, h *OIDCHandler, idp *mockIdP, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+	idp.Next = claims
+	flow, authURL := startSignIn(t, h)
+	return callback(h, flow, authorize(t, authURL))
+}
+
+func alice() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":            "alice-id",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"groups":         []string{"platform"},
+	}
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	h, idp, roles := setupOIDC(t)
+	ctx := context.Background()
+
+	rec := signIn(t, h, idp, alice())
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("callback = %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Location") != "/" {
+		t.Errorf("redirected to %q, want /", rec.Header().Get("Location"))
+	}
+	var session bool
+	for _, c := range rec.Result().Cookies() {
+		session = session || c.Name == cookieName(sessionCookieBase) && c.Value != ""
+	}
+	if !session {
+		t.Error("callback set no session cookie")
+	}
+
+	u, err := NewDefaultRepository().FindBySubject(ctx, "oidc", idp.URL+" alice-id")
+	if err != nil {
+		t.Fatalf("provisioned user not found by subject: %v", err)
+	}
+	if got := roles[u.ID]; got[1] != "owner" || got[2] != "" {
+		t.Errorf("synced roles = %v, want owner of 1 and nothing in 2", got)
+	}
+
+	// The subject, not the email, identifies the user; groups resync.
+	claims := alice()
+	claims["email"] = "alice.smith@example.com"
+	claims["groups"] = "dev"
+	if rec := signIn(t, h, idp, claims); rec.Code != http.StatusSeeOther {
+		t.Fatalf("second sign-in = %d: %s", rec.Code, rec.Body)
+	}
+	if got := roles[u.ID]; got[1] != "" || got[2] != "member" {
+		t.Errorf("synced roles = %v, want nothing in 1 and member of 2", got)
+	}
+	if exists, _ := NewDefaultRepository().UserExists(ctx, "alice.smith@example.com"); exists {
+		t.Error("a changed email provisioned a second account")
+	}
+}
+
+func TestOIDCRejects(t *testing.T) {
+	h, idp, _ := setupOIDC(t)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		signer *rsa.PrivateKey
+		want   int
+	}{
+		{name: "nonce mismatch", claims: func(c jwt.MapClaims) { c["nonce"] = "replayed" }, want: http.StatusUnauthorized},
+		{name: "bad signature", signer: other, want: http.StatusUnauthorized},
+		{name: "other audience", claims: func(c jwt.MapClaims) { c["aud"] = "another-app" }, want: http.StatusUnauthorized},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, want: http.StatusUnauthorized},
+		{name: "email unverified", claims: func(c jwt.MapClaims) { c["email_verified"] = false }, want: http.StatusForbidden},
+		{name: "email_verified missing", claims: func(c jwt.MapClaims) { delete(c, "email_verified") }, want: http.StatusForbidden},
+		{name: "no subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }, want: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := alice()
+			if tc.claims != nil {
+				tc.claims(claims)
+			}
+			idp.Signer = idp.key
+			if tc.signer != nil {
+				idp.Signer = tc.signer
+			}
+			if rec := signIn(t, h, idp, claims); rec.Code != tc.want {
+				t.Fatalf("callback = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+	idp.Signer = idp.key
+
+	t.Run("state mismatch", func(t *testing.T) {
+		idp.Next = alice()
+		flow, authURL := startSignIn(t, h)
+		u := authorize(t, authURL)
+		q := u.Query()
+		q.Set("state", "forged")
+		u.RawQuery = q.Encode()
+		if rec := callback(h, flow, u); rec.Code != http.StatusBadRequest {
+			t.Fatalf("callback = %d, want 400", rec.Code)
+		}
+	})
+	t.Run("no flow cookie", func(t *testing.T) {
+		idp.Next = alice()
+		_, authURL := startSignIn(t, h)
+		if rec := callback(h, nil, authorize(t, authURL)); rec.Code != http.StatusBadRequest {
+			t.Fatalf("callback = %d, want 400", rec.Code)
+		}
+	})
+	t.Run("code from another sign-in", func(t *testing.T) {
+		// A stolen code fails the PKCE check: the verifier in this
+		// browser's flow is not the one its challenge was made from.
+		idp.Next = alice()
+		_, stolenURL := startSignIn(t, h)
+		stolen := authorize(t, stolenURL)
+		flow, authURL := startSignIn(t, h)
+		u := authorize(t, authURL)
+		q := u.Query()
+		q.Set("code", stolen.Query().Get("code"))
+		u.RawQuery = q.Encode()
+		if rec := callback(h, flow, u); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("callback = %d, want 401", rec.Code)
+		}
+	})
+}
+
+func TestOIDCLinksOnlyPasswordlessAccounts(t *testing.T) {
+	h, idp, _ := setupOIDC(t)
+	ctx := context.Background()
+	repo := NewDefaultRepository()
+
+	if _, err := repo.CreateUser(ctx, "alice@example.com", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := signIn(t, h, idp, alice()); rec.Code != http.StatusConflict {
+		t.Fatalf("sign-in as a password account = %d, want 409: %s", rec.Code, rec.Body)
+	}
+
+	// An account made for single sign-on, e.g. by SCIM, is linked.
+	bob, err := repo.CreateUser(ctx, "bob@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"sub": "bob-id", "email": "bob@example.com", "email_verified": true}
+	if rec := signIn(t, h, idp, claims); rec.Code != http.StatusSeeOther {
+		t.Fatalf("sign-in as a passwordless account = %d: %s", rec.Code, rec.Body)
+	}
+	if u, err := repo.FindBySubject(ctx, "oidc", idp.URL+" bob-id"); err != nil || u.ID != bob.ID {
+		t.Fatalf("bob was not linked: %v", err)
+	}
+
+	// Once linked, another subject with the same email is refused.
+	claims["sub"] = "mallory-id"
+	if rec := signIn(t, h, idp, claims); rec.Code != http.StatusConflict {
+		t.Fatalf("sign-in as another subject = %d, want 409: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+)
+
+// maxPasswordBytes is as much of a password as bcrypt reads.
+const maxPasswordBytes = 72
+
+// dummyHash is checked against for unknown users; its password is unknown.
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("no user has this password, it is only hashed")
+	return hash
+})
+
+var ErrPasswordTooLong = apierror.Validation(apierror.FieldError{Field: "password", Message: "must be at most 72 bytes"})
+
+// HashPassword returns the bcrypt hash to store for password. An empty
+// password stays empty: it marks an account that cannot log in locally.
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether password matches the stored value, and
+// whether the stored value is a plaintext password from before hashing
+// that should be replaced by a hash.
+func checkPassword(stored, password string) (ok, rehash bool) {
+	if stored == "" || password == "" {
+		return false, false
+	}
+	if !isBcryptHash(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+	if err != nil && !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false
+	}
+	return err == nil, false
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
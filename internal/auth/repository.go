@@ -3,50 +3,75 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/tracing"
 )
 
 // Repository encapsulates all DB operations for auth.
-// It works with either sqlite (*sql.DB) or postgres (*pgx.Conn) based on config.DBDriver.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
 type Repository struct {
-	sqlDB  *sql.DB
-	pgxConn *pgx.Conn
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
 }
 
-func NewRepository(sqlDB *sql.DB, pgxConn *pgx.Conn) *Repository {
-	return &Repository{sqlDB: sqlDB, pgxConn: pgxConn}
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
 }
 
 func NewDefaultRepository() *Repository {
-	return &Repository{sqlDB: config.DB, pgxConn: config.PGXConn}
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
 }
 
-func (r *Repository) FindByUsername(username string) (*User, error) {
+// userColumns are the columns scanUser reads. Local users have no source
+// or subject, which are NULL.
+const userColumns = `id, username, password, active, COALESCE(auth_source, ''), COALESCE(auth_subject, '')`
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
 	u := &User{}
+	if err := row.Scan(&u.ID, &u.Username, &u.Password, &u.Active, &u.Source, &u.Subject); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (r *Repository) FindByUsername(ctx context.Context, username string) (*User, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "FindByUsername")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "FindByUsername")()
 
 	if config.DBDriver == "postgres" {
-		row := r.pgxConn.QueryRow(context.Background(),
-			`SELECT id, username, password FROM users WHERE username = $1`, username)
-		if err := row.Scan(&u.ID, &u.Username, &u.Password); err != nil {
-			return nil, err
-		}
-		return u, nil
+		return scanUser(r.pgxPool.QueryRow(ctx,
+			`SELECT `+userColumns+` FROM users WHERE username = $1`, username))
 	}
+	return scanUser(r.sqlDB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+}
 
-	row := r.sqlDB.QueryRow(`SELECT id, username, password FROM users WHERE username = ?`, username)
-	if err := row.Scan(&u.ID, &u.Username, &u.Password); err != nil {
-		return nil, err
+// FindBySubject returns the user an external source knows by subject.
+func (r *Repository) FindBySubject(ctx context.Context, source, subject string) (*User, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "FindBySubject")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "FindBySubject")()
+	query := `SELECT ` + userColumns + ` FROM users WHERE auth_source = $1 AND auth_subject = $2`
+
+	if config.DBDriver == "postgres" {
+		return scanUser(r.pgxPool.QueryRow(ctx, query, source, subject))
 	}
-	return u, nil
+	return scanUser(r.sqlDB.QueryRowContext(ctx, query, source, subject))
 }
 
-func (r *Repository) UserExists(username string) (bool, error) {
+func (r *Repository) UserExists(ctx context.Context, username string) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "UserExists")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "UserExists")()
 	if config.DBDriver == "postgres" {
 		var id int
-		row := r.pgxConn.QueryRow(context.Background(),
+		row := r.pgxPool.QueryRow(ctx,
 			`SELECT id FROM users WHERE username = $1`, username)
 		err := row.Scan(&id)
 		if err == pgx.ErrNoRows {
@@ -59,7 +84,7 @@ func (r *Repository) UserExists(username string) (bool, error) {
 	}
 
 	var id int
-	err := r.sqlDB.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&id)
+	err := r.sqlDB.QueryRowContext(ctx, `SELECT id FROM users WHERE username = ?`, username).Scan(&id)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -69,14 +94,24 @@ func (r *Repository) UserExists(username string) (bool, error) {
 	return true, nil
 }
 
-func (r *Repository) CreateUser(username, password string) (*User, error) {
+// CreateUser stores a local user with password hashed. An empty password
+// makes a user who cannot log in locally, for single sign-on.
+func (r *Repository) CreateUser(ctx context.Context, username, password string) (*User, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "CreateUser")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "CreateUser")()
+	password, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
 	u := &User{
 		Username: username,
 		Password: password,
+		Active:   true,
 	}
 
 	if config.DBDriver == "postgres" {
-		row := r.pgxConn.QueryRow(context.Background(), `
+		row := r.pgxPool.QueryRow(ctx, `
 			INSERT INTO users (username, password)
 			VALUES ($1, $2)
 			RETURNING id
@@ -87,7 +122,7 @@ func (r *Repository) CreateUser(username, password string) (*User, error) {
 		return u, nil
 	}
 
-	res, err := r.sqlDB.Exec(`
+	res, err := r.sqlDB.ExecContext(ctx, `
 		INSERT INTO users (username, password)
 		VALUES (?, ?)
 	`, username, password)
@@ -101,3 +136,92 @@ func (r *Repository) CreateUser(username, password string) (*User, error) {
 	u.ID = int(id)
 	return u, nil
 }
+
+// SetPasswordHash replaces the user's stored password with hash.
+func (r *Repository) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	ctx, span := tracing.StartDB(ctx, "auth", "SetPasswordHash")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "SetPasswordHash")()
+
+	if config.DBDriver == "postgres" {
+		_, err := r.pgxPool.Exec(ctx, `UPDATE users SET password = $1 WHERE id = $2`, hash, id)
+		return err
+	}
+	_, err := r.sqlDB.ExecContext(ctx, `UPDATE users SET password = ? WHERE id = ?`, hash, id)
+	return err
+}
+
+// CreateExternalUser creates a user without a password, linked to their
+// subject at an external source.
+func (r *Repository) CreateExternalUser(ctx context.Context, username, source, subject string) (*User, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "CreateExternalUser")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "CreateExternalUser")()
+	u := &User{Username: username, Active: true, Source: source, Subject: subject}
+	query := `INSERT INTO users (username, password, auth_source, auth_subject) VALUES ($1, '', $2, $3) RETURNING id`
+
+	if config.DBDriver == "postgres" {
+		if err := r.pgxPool.QueryRow(ctx, query, username, source, subject).Scan(&u.ID); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	if err := r.sqlDB.QueryRowContext(ctx, query, username, source, subject).Scan(&u.ID); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// LinkSubject links a user to their subject at an external source. Only a
+// user without a password or a link is linked; it reports whether the user
+// was.
+func (r *Repository) LinkSubject(ctx context.Context, id int, source, subject string) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "LinkSubject")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "LinkSubject")()
+	query := `UPDATE users SET auth_source = $1, auth_subject = $2
+		WHERE id = $3 AND password = '' AND auth_source IS NULL`
+
+	if config.DBDriver == "postgres" {
+		tag, err := r.pgxPool.Exec(ctx, query, source, subject, id)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+	res, err := r.sqlDB.ExecContext(ctx, query, source, subject, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// IsActive reports whether the user exists and has not been deactivated.
+func (r *Repository) IsActive(ctx context.Context, id int) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "auth", "IsActive")
+	defer span.End()
+	defer metrics.ObserveDB("auth", "IsActive")()
+	var active bool
+
+	if config.DBDriver == "postgres" {
+		err := r.pgxPool.QueryRow(ctx, `SELECT active FROM users WHERE id = $1`, id).Scan(&active)
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return active, err
+	}
+
+	err := r.sqlDB.QueryRowContext(ctx, `SELECT active FROM users WHERE id = ?`, id).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return active, err
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows)
+}
@@ -1,43 +1,304 @@
 package auth
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
+)
+
+var (
+	ErrInvalidCredentials = apierror.Unauthorized("invalid username or password")
+	ErrUserExists         = apierror.Conflict("user already exists")
+	ErrNotLocked          = apierror.NotFound("no failed logins are recorded for this user")
+	ErrNotProvisioned     = apierror.Forbidden("no account exists for this user")
+	ErrBackendUnavailable = apierror.BadGateway("authentication backend unavailable")
+	ErrDeactivated        = apierror.Unauthorized("account is deactivated")
+	ErrAccountConflict    = apierror.Conflict("an account with this username already exists and signs in another way")
+)
+
+// AccountAuditor records lockouts in the audit trail. The event bus
+// implements it; auth cannot import events, whose handler depends on auth.
+type AccountAuditor interface {
+	AccountLocked(username string, until time.Time, failures int)
+	AccountUnlocked(username string, actorID int)
+}
+
+// RoleSyncer applies the organization roles that a user's directory groups
+// grant. The org service implements it; auth cannot import org, whose
+// handler depends on auth.
+type RoleSyncer interface {
+	SyncRoles(userID int, roles map[int]string) error
+}
 
 type User struct {
 	ID       int
 	Username string
 	Password string
+	// Active is false once the user is deactivated, e.g. by SCIM; they can
+	// then neither log in nor use an existing session.
+	Active bool
+	// Source and Subject identify a user who signs in through single
+	// sign-on or LDAP: the backend, and who it says they are. They are
+	// empty for local users.
+	Source  string
+	Subject string
 }
 
 type AuthService struct {
-	repo *Repository
+	repo           *Repository
+	lockout        *ratelimit.Lockout
+	audit          AccountAuditor
+	roles          RoleSyncer
+	authenticators []Authenticator
+	active         activeUsers
 }
 
-func NewAuthService() *AuthService {
-	return &AuthService{repo: NewDefaultRepository()}
+// NewAuthService returns the service. A nil lockout never locks accounts.
+// Logins are checked by authenticators, in order.
+func NewAuthService(lockout *ratelimit.Lockout, audit AccountAuditor, roles RoleSyncer, authenticators []Authenticator) *AuthService {
+	return &AuthService{
+		repo:           NewDefaultRepository(),
+		lockout:        lockout,
+		audit:          audit,
+		roles:          roles,
+		authenticators: authenticators,
+		active:         activeUsers{expiry: make(map[int]time.Time)},
+	}
 }
 
-func (s *AuthService) Authenticate(username, password string) (*User, error) {
-	u, err := s.repo.FindByUsername(username)
+// Authenticate checks the credentials with each authenticator in turn until
+// one accepts them. A backend that fails is skipped; if none accepts the
+// credentials because of that, the login is not counted as a failure.
+// Repeated failures lock the username out, whether or not such a user
+// exists, so that locks do not reveal it.
+func (s *AuthService) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	if s.lockout != nil {
+		wait, err := s.lockout.Check(lockoutKey(username))
+		if err != nil {
+			return nil, err
+		}
+		if wait > 0 {
+			metrics.AuthAttempts.WithLabelValues("locked").Inc()
+			return nil, errLocked(wait)
+		}
+	}
+
+	var id *Identity
+	var backendErr error
+	for _, a := range s.authenticators {
+		found, err := a.Authenticate(ctx, username, password)
+		if err == nil {
+			id = found
+			break
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			slog.WarnContext(ctx, "authentication backend failed", "backend", a.Name(), "err", err)
+			if backendErr == nil {
+				backendErr = err
+			}
+		}
+	}
+	if id == nil {
+		// The credentials were not checked, so they do not count towards
+		// lockout. An unreachable directory is a 502, anything else a 500.
+		if backendErr != nil {
+			return nil, backendErr
+		}
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		return nil, s.fail(username)
+	}
+
+	if s.lockout != nil {
+		if _, err := s.lockout.Reset(lockoutKey(username)); err != nil {
+			return nil, err
+		}
+	}
+	if id.User != nil {
+		if !id.User.Active {
+			metrics.AuthAttempts.WithLabelValues("failure").Inc()
+			return nil, ErrDeactivated
+		}
+		metrics.AuthAttempts.WithLabelValues("success").Inc()
+		return id.User, nil
+	}
+	return s.signInExternal(ctx, id)
+}
+
+// fail records a failed login and returns the error to report for it.
+func (s *AuthService) fail(username string) error {
+	if s.lockout == nil {
+		return ErrInvalidCredentials
+	}
+	lock, failures, err := s.lockout.Fail(lockoutKey(username))
 	if err != nil {
-		return nil, errors.New("invalid username or password")
+		return err
+	}
+	if lock == 0 {
+		return ErrInvalidCredentials
 	}
 
-	if u.Password != password {
-		return nil, errors.New("invalid username or password")
+	slog.Warn("account locked", "username", username, "lock", lock.String(), "failures", failures)
+	s.audit.AccountLocked(username, time.Now().UTC().Add(lock), failures)
+	return errLocked(lock)
+}
+
+// Unlock clears the username's failed logins and lock on behalf of an admin.
+func (s *AuthService) Unlock(username string, actorID int) error {
+	if s.lockout == nil {
+		return ErrNotLocked
+	}
+	ok, err := s.lockout.Reset(lockoutKey(username))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotLocked
 	}
 
-	return u, nil
+	slog.Info("account unlocked", "username", username, "actor_id", actorID)
+	s.audit.AccountUnlocked(username, actorID)
+	return nil
+}
+
+func lockoutKey(username string) string {
+	return "lockout:" + username
+}
+
+func errLocked(wait time.Duration) error {
+	return apierror.TooManyRequests("too many failed logins, try again later", wait)
 }
 
 // Signup creates a new user with the given username and password.
-func (s *AuthService) Signup(username, password string) (*User, error) {
-	exists, err := s.repo.UserExists(username)
+func (s *AuthService) Signup(ctx context.Context, username, password string) (*User, error) {
+	var fields []apierror.FieldError
+	if strings.TrimSpace(username) == "" {
+		fields = append(fields, apierror.FieldError{Field: "username", Message: "is required"})
+	}
+	if password == "" {
+		fields = append(fields, apierror.FieldError{Field: "password", Message: "is required"})
+	}
+	if len(fields) > 0 {
+		return nil, apierror.Validation(fields...)
+	}
+
+	exists, err := s.repo.UserExists(ctx, username)
 	if err != nil {
 		return nil, err
 	}
 	if exists {
-		return nil, errors.New("user already exists")
+		return nil, ErrUserExists
 	}
 
-	return s.repo.CreateUser(username, password)
+	return s.repo.CreateUser(ctx, username, password)
+}
+
+// signInExternal returns the user an identity provider vouched for,
+// linking or provisioning them on their first sign-in, and grants them the
+// roles that id.GroupRoles give their groups.
+func (s *AuthService) signInExternal(ctx context.Context, id *Identity) (*User, error) {
+	u, err := s.findBySubject(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !u.Active {
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		return nil, ErrDeactivated
+	}
+
+	if len(id.GroupRoles) > 0 && s.roles != nil {
+		if err := s.roles.SyncRoles(u.ID, GroupRoles(id.Groups, id.GroupRoles)); err != nil {
+			return nil, err
+		}
+	}
+	metrics.AuthAttempts.WithLabelValues("success").Inc()
+	return u, nil
+}
+
+// findBySubject returns the user linked to id.Subject. On the first
+// sign-in the account with id.Username is linked, unless it has a password
+// or another link, as whoever holds that name at the provider need not be
+// its owner; if there is none, it is provisioned.
+func (s *AuthService) findBySubject(ctx context.Context, id *Identity) (*User, error) {
+	u, err := s.repo.FindBySubject(ctx, id.Source, id.Subject)
+	if !isNoRows(err) {
+		return u, err
+	}
+
+	u, err = s.repo.FindByUsername(ctx, id.Username)
+	switch {
+	case err == nil:
+		if u.Password != "" || u.Source != "" {
+			slog.WarnContext(ctx, "refused to link an external identity to an existing account",
+				"source", id.Source, "username", id.Username, "user_id", u.ID)
+			metrics.AuthAttempts.WithLabelValues("failure").Inc()
+			return nil, ErrAccountConflict
+		}
+		linked, err := s.repo.LinkSubject(ctx, u.ID, id.Source, id.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !linked {
+			// The account changed since it was read.
+			metrics.AuthAttempts.WithLabelValues("failure").Inc()
+			return nil, ErrAccountConflict
+		}
+		slog.InfoContext(ctx, "linked user", "source", id.Source, "username", id.Username, "user_id", u.ID)
+		u.Source, u.Subject = id.Source, id.Subject
+		return u, nil
+	case !isNoRows(err):
+		return nil, err
+	case !id.Provision:
+		metrics.AuthAttempts.WithLabelValues("failure").Inc()
+		return nil, ErrNotProvisioned
+	}
+
+	u, err = s.repo.CreateExternalUser(ctx, id.Username, id.Source, id.Subject)
+	if err != nil {
+		// Lost a race with another first sign-in of the same user.
+		if existing, findErr := s.repo.FindBySubject(ctx, id.Source, id.Subject); findErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	slog.InfoContext(ctx, "provisioned user", "source", id.Source, "username", id.Username, "user_id", u.ID)
+	return u, nil
+}
+
+// GroupRoles returns the role groups earn in every mapped organization:
+// owner beats member, and "" means none.
+func GroupRoles(groups []string, mappings []config.GroupRole) map[int]string {
+	roles := make(map[int]string, len(mappings))
+	for _, m := range mappings {
+		if _, ok := roles[m.OrgID]; !ok {
+			roles[m.OrgID] = ""
+		}
+		if roles[m.OrgID] != "owner" && slices.Contains(groups, m.Group) {
+			roles[m.OrgID] = m.Role
+		}
+	}
+	return roles
+}
+
+// ValidateGroupRoles checks the mappings under the given config key.
+func ValidateGroupRoles(key string, mappings []config.GroupRole) error {
+	for i, m := range mappings {
+		switch {
+		case m.Group == "":
+			return fmt.Errorf("%s[%d]: group is required", key, i)
+		case m.OrgID <= 0:
+			return fmt.Errorf("%s[%d]: org_id is required", key, i)
+		case m.Role != "owner" && m.Role != "member":
+			return fmt.Errorf("%s[%d]: role must be owner or member", key, i)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
+)
+
+// stubAuthenticator answers every login with the same identity or error.
+type stubAuthenticator struct {
+	id  *Identity
+	err error
+}
+
+func (a stubAuthenticator) Name() string { return "stub" }
+
+func (a stubAuthenticator) Authenticate(context.Context, string, string) (*Identity, error) {
+	return a.id, a.err
+}
+
+func setupAuthDB(t *testing.T) {
+	t.Helper()
+	configtest.SQLite(t)
+}
+
+func TestExternalAccountsAreScopedPerBackend(t *testing.T) {
+	setupAuthDB(t)
+	ctx := context.Background()
+	repo := NewDefaultRepository()
+
+	if _, err := repo.CreateUser(ctx, "bob", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	sso, err := repo.CreateExternalUser(ctx, "carol", "oidc", "https://idp.example.com carol-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ldapLogin := func(username, dn string) (*User, error) {
+		s := NewAuthService(nil, nil, nil, []Authenticator{stubAuthenticator{id: &Identity{
+			Username: username, Source: "ldap", Subject: dn, Provision: true,
+		}}})
+		return s.Authenticate(ctx, username, "directory-password")
+	}
+
+	// A directory entry named like a local or single sign-on account does
+	// not get into it.
+	if _, err := ldapLogin("bob", "uid=bob,dc=example,dc=com"); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("ldap login as a password account err = %v, want ErrAccountConflict", err)
+	}
+	if _, err := ldapLogin("carol", "uid=carol,dc=example,dc=com"); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("ldap login as an SSO account err = %v, want ErrAccountConflict", err)
+	}
+
+	dave, err := ldapLogin("dave", "uid=dave,dc=example,dc=com")
+	if err != nil {
+		t.Fatalf("provisioning ldap login: %v", err)
+	}
+	if again, err := ldapLogin("dave", "uid=dave,dc=example,dc=com"); err != nil || again.ID != dave.ID {
+		t.Fatalf("second ldap login = %v, %v; want user %d", again, err, dave.ID)
+	}
+	if _, err := ldapLogin("dave", "uid=dave,ou=contractors,dc=example,dc=com"); !errors.Is(err, ErrAccountConflict) {
+		t.Fatalf("ldap login as another entry err = %v, want ErrAccountConflict", err)
+	}
+	if u, err := repo.FindBySubject(ctx, "oidc", "https://idp.example.com carol-id"); err != nil || u.ID != sso.ID {
+		t.Fatalf("carol's link changed: %v", err)
+	}
+}
+
+func TestBackendErrorsDoNotCountTowardsLockout(t *testing.T) {
+	setupAuthDB(t)
+	ctx := context.Background()
+	if _, err := NewDefaultRepository().CreateUser(ctx, "alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	lockout := ratelimit.NewLockout(ratelimit.NewMemoryStore(), 1, time.Minute, time.Hour)
+
+	// The local backend's database failing is an internal error, not
+	// wrong credentials.
+	config.DB.Close()
+	s := NewAuthService(lockout, nil, nil, []Authenticator{NewLocalAuthenticator()})
+	_, err := s.Authenticate(ctx, "alice", "password123")
+	var apiErr *apierror.Error
+	if err == nil || errors.Is(err, ErrInvalidCredentials) || errors.As(err, &apiErr) {
+		t.Fatalf("login with the database down err = %v, want an internal error", err)
+	}
+
+	// An unreachable directory is a bad gateway.
+	s = NewAuthService(lockout, nil, nil, []Authenticator{
+		stubAuthenticator{err: unavailable(errors.New("connection refused"))},
+	})
+	if _, err := s.Authenticate(ctx, "alice", "password123"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("login with ldap down err = %v, want ErrBackendUnavailable", err)
+	}
+
+	if wait, err := lockout.Check(lockoutKey("alice")); err != nil || wait > 0 {
+		t.Fatalf("alice is locked out for %v (%v) after backend failures", wait, err)
+	}
+}
+
+// recordingAuditor keeps the lockout events it is told about.
+type recordingAuditor struct {
+	locked   []string
+	unlocked []string
+}
+
+func (a *recordingAuditor) AccountLocked(username string, until time.Time, failures int) {
+	a.locked = append(a.locked, username)
+}
+
+func (a *recordingAuditor) AccountUnlocked(username string, actorID int) {
+	a.unlocked = append(a.unlocked, username)
+}
+
+func TestAdminUnlockClearsLockout(t *testing.T) {
+	setupAuthDB(t)
+	ctx := context.Background()
+	if _, err := NewDefaultRepository().CreateUser(ctx, "alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	audit := &recordingAuditor{}
+	lockout := ratelimit.NewLockout(ratelimit.NewMemoryStore(), 2, time.Minute, time.Hour)
+	s := NewAuthService(lockout, audit, nil, []Authenticator{NewLocalAuthenticator()})
+
+	if _, err := s.Authenticate(ctx, "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("first wrong password err = %v, want ErrInvalidCredentials", err)
+	}
+	var apiErr *apierror.Error
+	if _, err := s.Authenticate(ctx, "alice", "wrong"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+		t.Fatalf("second wrong password err = %v, want a 429 lock", err)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+		t.Fatalf("right password while locked err = %v, want a 429 lock", err)
+	}
+	if len(audit.locked) != 1 {
+		t.Fatalf("audited %d locks, want 1", len(audit.locked))
+	}
+
+	prev := config.Auth.Admins
+	config.Auth.Admins = []string{"root"}
+	t.Cleanup(func() { config.Auth.Admins = prev })
+	unlock := RequireAdmin(http.HandlerFunc(NewLoginHandler(s).UnlockAccount))
+	do := func(actor string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/lockouts/alice", nil)
+		req.SetPathValue("username", "alice")
+		req = req.WithContext(context.WithValue(context.WithValue(req.Context(),
+			ContextUserIDKey, 1), ContextUsernameKey, actor))
+		rec := httptest.NewRecorder()
+		unlock.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do("alice"); code != http.StatusForbidden {
+		t.Fatalf("unlock by a non-admin = %d, want 403", code)
+	}
+	if code := do("root"); code != http.StatusOK {
+		t.Fatalf("unlock by an admin = %d, want 200", code)
+	}
+	if len(audit.unlocked) != 1 || audit.unlocked[0] != "alice" {
+		t.Fatalf("audited unlocks = %v, want [alice]", audit.unlocked)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); err != nil {
+		t.Fatalf("login after unlock: %v", err)
+	}
+	if code := do("root"); code != http.StatusNotFound {
+		t.Fatalf("unlocking an account that is not locked = %d, want 404", code)
+	}
+}
+
+func TestRequireAuthCachesActiveUsers(t *testing.T) {
+	setupAuthDB(t)
+	jwtSecret = []byte("test-secret")
+	ctx := context.Background()
+	u, err := NewDefaultRepository().CreateUser(ctx, "alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := GenerateToken(ctx, u.ID, u.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewAuthService(nil, nil, nil, nil)
+	h := s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	do := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/workspaces", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(); code != http.StatusNoContent {
+		t.Fatalf("request as an active user = %d, want 204", code)
+	}
+	if _, err := config.DB.Exec(`UPDATE users SET active = 0 WHERE id = ?`, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := do(); code != http.StatusNoContent {
+		t.Fatalf("request within the cache window = %d, want the cached 204", code)
+	}
+	s.ForgetActive(u.ID)
+	if code := do(); code != http.StatusUnauthorized {
+		t.Fatalf("request after deactivation = %d, want 401", code)
+	}
+}
+
+func TestLocalLoginUpgradesPlaintextPasswords(t *testing.T) {
+	setupAuthDB(t)
+	ctx := context.Background()
+	repo := NewDefaultRepository()
+	s := NewAuthService(nil, nil, nil, []Authenticator{NewLocalAuthenticator()})
+
+	stored := func(username string) string {
+		t.Helper()
+		var password string
+		if err := config.DB.QueryRow(`SELECT password FROM users WHERE username = $1`, username).Scan(&password); err != nil {
+			t.Fatal(err)
+		}
+		return password
+	}
+
+	if _, err := repo.CreateUser(ctx, "alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	if p := stored("alice"); !isBcryptHash(p) {
+		t.Fatalf("alice's password is stored as %q, want a bcrypt hash", p)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); err != nil {
+		t.Fatalf("login with the right password: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password124"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with the wrong password err = %v, want ErrInvalidCredentials", err)
+	}
+
+	// A password stored before hashing still works once, then is hashed.
+	if _, err := config.DB.Exec(`INSERT INTO users (username, password) VALUES ('bob', 'hunter22')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "bob", "hunter2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with a prefix of the plaintext password err = %v, want ErrInvalidCredentials", err)
+	}
+	if p := stored("bob"); p != "hunter22" {
+		t.Fatalf("a failed login changed bob's password to %q", p)
+	}
+	if _, err := s.Authenticate(ctx, "bob", "hunter22"); err != nil {
+		t.Fatalf("login with a plaintext password: %v", err)
+	}
+	if p := stored("bob"); !isBcryptHash(p) {
+		t.Fatalf("bob's password is still stored as %q after logging in", p)
+	}
+	if _, err := s.Authenticate(ctx, "bob", "hunter22"); err != nil {
+		t.Fatalf("login after the upgrade: %v", err)
+	}
+
+	if _, err := HashPassword(strings.Repeat("x", maxPasswordBytes+1)); !errors.Is(err, ErrPasswordTooLong) {
+		t.Fatalf("hashing a 73-byte password err = %v, want ErrPasswordTooLong", err)
+	}
+}
+
+func TestLDAPGroupsListsDNAndName(t *testing.T) {
+	got := ldapGroups([]string{" CN=Admins,OU=Groups,DC=example,DC=com ", "developers"})
+	want := []string{"cn=admins,ou=groups,dc=example,dc=com", "admins", "developers"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ldapGroups = %q, want %q", got, want)
+	}
+}
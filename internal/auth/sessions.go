@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often start sweeps out expired sessions. Without the
+// sweep, only scraping the metric would forget them, and with metrics off
+// the map would grow by one entry per login forever.
+const pruneInterval = time.Minute
+
+// sessions tracks the sessions this instance started, for the active
+// sessions metric. Tokens are stateless JWTs, so a session that another
+// instance ends, or that a client simply drops, is only forgotten when it
+// expires.
+var sessions = &sessionTracker{expiry: make(map[[sha256.Size]byte]time.Time)}
+
+type sessionTracker struct {
+	mu     sync.Mutex
+	expiry map[[sha256.Size]byte]time.Time
+	pruned time.Time
+}
+
+func (t *sessionTracker) start(token string, expires time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now := time.Now(); now.Sub(t.pruned) >= pruneInterval {
+		t.prune(now)
+	}
+	t.expiry[sha256.Sum256([]byte(token))] = expires
+}
+
+func (t *sessionTracker) end(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.expiry, sha256.Sum256([]byte(token)))
+}
+
+// prune forgets expired sessions. The caller holds t.mu.
+func (t *sessionTracker) prune(now time.Time) {
+	for key, expires := range t.expiry {
+		if now.After(expires) {
+			delete(t.expiry, key)
+		}
+	}
+	t.pruned = now
+}
+
+// ActiveSessions returns how many sessions started here have neither
+// expired nor logged out.
+func ActiveSessions() int {
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	sessions.prune(time.Now())
+	return len(sessions.expiry)
+}
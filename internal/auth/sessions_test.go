@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestSessionTrackerPrunesOnStart(t *testing.T) {
+	tr := &sessionTracker{expiry: make(map[[sha256.Size]byte]time.Time)}
+
+	tr.start("expired", time.Now().Add(-time.Second))
+	tr.start("live", time.Now().Add(time.Hour))
+	if len(tr.expiry) != 2 {
+		t.Fatalf("tracked = %d, want 2 before the next sweep is due", len(tr.expiry))
+	}
+
+	// Once a sweep is due, the next login forgets expired sessions even
+	// though nothing reads the metric.
+	tr.pruned = time.Now().Add(-pruneInterval)
+	tr.start("another", time.Now().Add(time.Hour))
+	if len(tr.expiry) != 2 {
+		t.Fatalf("tracked = %d, want 2 after the sweep", len(tr.expiry))
+	}
+	if _, ok := tr.expiry[sha256.Sum256([]byte("expired"))]; ok {
+		t.Fatal("expired session is still tracked")
+	}
+
+	tr.end("live")
+	if len(tr.expiry) != 1 {
+		t.Fatalf("tracked = %d after logout, want 1", len(tr.expiry))
+	}
+}
@@ -1,19 +1,37 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds application configuration loaded from YAML/env.
 type Config struct {
-	App      AppConfig      `yaml:"app"`
-	Database DatabaseConfig `yaml:"database"`
-	Postgres PostgresConfig `yaml:"postgres"`
+	App       AppConfig       `yaml:"app"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Postgres  PostgresConfig  `yaml:"postgres"`
+	Agent     AgentConfig     `yaml:"agent"`
+	Workspace WorkspaceConfig `yaml:"workspace"`
+	Secrets   SecretsConfig   `yaml:"secrets"`
+	Webhook   WebhookConfig   `yaml:"webhook"`
+	Auth      AuthConfig      `yaml:"auth"`
+	CORS      CORSConfig      `yaml:"cors"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Cookie    CookieConfig    `yaml:"cookie"`
+	Server    ServerConfig    `yaml:"server"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	OIDC      OIDCConfig      `yaml:"oidc"`
+	LDAP      LDAPConfig      `yaml:"ldap"`
+	SCIM      SCIMConfig      `yaml:"scim"`
 }
 
 type AppConfig struct {
@@ -38,6 +56,249 @@ type PostgresConfig struct {
 	Password string `yaml:"password"`
 	DBName   string `yaml:"dbname"`
 	SSLMode  string `yaml:"sslmode"`
+	// MaxConns caps the connection pool; 0 uses pgx's default, the larger
+	// of 4 and the number of CPUs.
+	MaxConns int `yaml:"max_conns"`
+}
+
+// AgentConfig holds settings for the agent subsystem.
+type AgentConfig struct {
+	// IdentityKeyFile is where the server's ed25519 identity key is stored.
+	// Agents pin the matching public key at enrollment time.
+	IdentityKeyFile string `yaml:"identity_key_file"`
+}
+
+// WorkspaceConfig holds settings for workspaces.
+type WorkspaceConfig struct {
+	// TrashRetentionDays is how long a deleted workspace stays in the trash,
+	// restorable, before it is purged for good. 0 keeps it until it is
+	// purged by hand; nil means it was not set.
+	TrashRetentionDays *int `yaml:"trash_retention_days"`
+}
+
+// PurgeAfterDays returns the trash retention in days, or 0 if trashed
+// workspaces are never purged automatically.
+func (c WorkspaceConfig) PurgeAfterDays() int {
+	if c.TrashRetentionDays == nil {
+		return 0
+	}
+	return *c.TrashRetentionDays
+}
+
+// SecretsConfig holds settings for the secret store.
+type SecretsConfig struct {
+	// KeyFile holds the key secret values are encrypted with. It is
+	// generated on first start; losing it makes every stored value
+	// unreadable.
+	KeyFile string `yaml:"key_file"`
+}
+
+// WebhookConfig holds settings for webhook deliveries.
+type WebhookConfig struct {
+	// AllowedNetworks are CIDRs webhooks may reach although they are
+	// loopback, private or link-local, which are otherwise refused.
+	AllowedNetworks []string `yaml:"allowed_networks"`
+}
+
+// AuthConfig holds login protection and administration settings.
+type AuthConfig struct {
+	// Admins are the usernames allowed to use the admin endpoints.
+	Admins []string `yaml:"admins"`
+	// Backends check logins in order until one accepts them: "local" (the
+	// users table) and "ldap". A backend that cannot be reached is skipped.
+	Backends []string `yaml:"backends"`
+	// RateLimitStore is where login buckets and lockouts are kept: "memory"
+	// for a single instance, "db" to share them between instances.
+	RateLimitStore string `yaml:"rate_limit_store"`
+	// LoginRatePerMinute is the sustained rate of login attempts allowed per
+	// client IP and per username, with bursts of up to LoginBurst. 0 disables it.
+	LoginRatePerMinute int `yaml:"login_rate_per_minute"`
+	LoginBurst         int `yaml:"login_burst"`
+	// LockoutThreshold consecutive failed logins lock the username for
+	// LockoutMinutes; each further failure doubles the lock, up to
+	// LockoutMaxMinutes. 0 disables lockout.
+	LockoutThreshold  int `yaml:"lockout_threshold"`
+	LockoutMinutes    int `yaml:"lockout_minutes"`
+	LockoutMaxMinutes int `yaml:"lockout_max_minutes"`
+}
+
+// CORSConfig is the cross-origin policy for browsers on other origins.
+type CORSConfig struct {
+	// AllowedOrigins are exact origins ("https://app.example.com"), wildcard
+	// subdomain patterns ("https://*.example.com") or "*" for any.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// ExposedHeaders are response headers scripts on allowed origins may read.
+	ExposedHeaders []string `yaml:"exposed_headers"`
+	// AllowCredentials lets allowed origins send the session cookie.
+	AllowCredentials *bool `yaml:"allow_credentials"`
+	// MaxAgeSeconds is how long browsers may cache a preflight answer.
+	MaxAgeSeconds int `yaml:"max_age_seconds"`
+}
+
+// TLSConfig makes the server speak HTTPS itself. It is on when both
+// CertFile and KeyFile are set; SIGHUP reloads them.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuth is "none", "optional" or "require"; the last two verify
+	// client certificates against ClientCAFile (mTLS).
+	ClientAuth   string `yaml:"client_auth"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	// RedirectPort, if not 0, serves plain HTTP there that redirects to HTTPS.
+	RedirectPort int `yaml:"redirect_port"`
+}
+
+// Enabled reports whether the server serves HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// CookieConfig controls the session and CSRF cookies.
+type CookieConfig struct {
+	// Domain shares the cookies with subdomains; empty keeps them to this host.
+	Domain string `yaml:"domain"`
+	// SameSite is "lax", "strict" or "none" ("none" needs Secure).
+	SameSite string `yaml:"same_site"`
+	// LifetimeHours is how long a session lasts, for both cookie and token.
+	LifetimeHours int `yaml:"lifetime_hours"`
+	// Secure marks the cookies Secure without native TLS, e.g. behind a
+	// TLS-terminating proxy. They always are when TLS is enabled.
+	Secure bool `yaml:"secure"`
+}
+
+// ServerConfig holds HTTP server limits and the shutdown grace period.
+type ServerConfig struct {
+	ReadTimeoutSeconds       int `yaml:"read_timeout_seconds"`
+	ReadHeaderTimeoutSeconds int `yaml:"read_header_timeout_seconds"`
+	// WriteTimeoutSeconds does not apply to event streams and agent
+	// connections, which clear it.
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds  int `yaml:"idle_timeout_seconds"`
+	MaxHeaderBytes      int `yaml:"max_header_bytes"`
+	// ShutdownTimeoutSeconds is how long in-flight requests may take to
+	// finish after SIGTERM before the server gives up on them.
+	ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`
+}
+
+// MetricsConfig controls the Prometheus endpoint.
+type MetricsConfig struct {
+	// Enabled serves /metrics on Host:Port, a listener separate from the API
+	// so that it can be kept off the public network. Host defaults to the
+	// loopback address; set it to "0.0.0.0" to let a scraper on another
+	// machine reach it.
+	Enabled *bool  `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"`
+	// SecretReadWorkspaces are the workspace IDs whose secret reads get their
+	// own series; reads from any other workspace are counted together.
+	SecretReadWorkspaces []int `yaml:"secret_read_workspaces"`
+}
+
+// LoggingConfig controls the server's log output.
+type LoggingConfig struct {
+	// Level is the lowest level logged: "debug", "info", "warn" or "error".
+	Level string `yaml:"level"`
+	// Format is "json" for one JSON object per line, or "text".
+	Format string `yaml:"format"`
+}
+
+// TracingConfig controls trace export.
+type TracingConfig struct {
+	// Exporter is "none", "stdout" (one JSON span per line) or "otlp".
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the collector's OTLP/HTTP traces URL; spans are sent
+	// JSON-encoded.
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Requests
+	// that arrive with a traceparent follow the caller's decision instead.
+	// A pointer so that 0 in config.yaml can turn sampling off.
+	SampleRatio *float64 `yaml:"sample_ratio"`
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL; its endpoints are read from
+	// Issuer + "/.well-known/openid-configuration". Empty disables SSO.
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL is this server's callback as registered with the provider,
+	// e.g. "https://secretlane.example.com/api/v1/auth/oidc/callback".
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+	// EmailClaim and GroupsClaim name the ID token claims holding the
+	// user's email, which is their username here, and their groups.
+	EmailClaim  string `yaml:"email_claim"`
+	GroupsClaim string `yaml:"groups_claim"`
+	// Provision creates users the first time they sign in. When false,
+	// only existing users may sign in through the provider.
+	Provision *bool `yaml:"provision"`
+	// GroupRoles give members of provider groups a role in an
+	// organization, and so in its workspaces.
+	GroupRoles []GroupRole `yaml:"group_roles"`
+	// PostLoginRedirect is where the browser is sent after signing in when
+	// the login link named no path.
+	PostLoginRedirect string `yaml:"post_login_redirect"`
+}
+
+// GroupRole gives the members of a directory group a role in an
+// organization, and so in its workspaces.
+type GroupRole struct {
+	Group string `yaml:"group"`
+	OrgID int    `yaml:"org_id"`
+	// Role is "owner" or "member".
+	Role string `yaml:"role"`
+}
+
+// Enabled reports whether OIDC sign-in is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// LDAPConfig is the "ldap" login backend: users are looked up with a
+// service account, then bound as to check their password.
+type LDAPConfig struct {
+	// URL is ldap://host[:389] or ldaps://host[:636].
+	URL string `yaml:"url"`
+	// StartTLS upgrades an ldap:// connection before binding.
+	StartTLS bool `yaml:"start_tls"`
+	// CAFile verifies the server certificate against a private CA instead
+	// of the system roots.
+	CAFile string `yaml:"ca_file"`
+	// BindDN and BindPassword are the service account that searches for
+	// users; empty searches anonymously.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// UserFilter finds the user logging in; {username} is replaced with the
+	// escaped username. Active Directory uses "(sAMAccountName={username})".
+	UserFilter string `yaml:"user_filter"`
+	// GroupAttribute lists the user's groups, as DNs or names.
+	GroupAttribute string `yaml:"group_attribute"`
+	// GroupRoles match groups by DN or by their first RDN value (the CN),
+	// ignoring case.
+	GroupRoles []GroupRole `yaml:"group_roles"`
+	// Provision creates users the first time they log in. When false, only
+	// users that already exist may log in through LDAP.
+	Provision      *bool `yaml:"provision"`
+	TimeoutSeconds int   `yaml:"timeout_seconds"`
+}
+
+// SCIMConfig lets an identity provider create, update and deactivate users
+// and groups through the SCIM 2.0 API under /scim/v2.
+type SCIMConfig struct {
+	// Token is the bearer token the provider sends; empty disables SCIM.
+	Token string `yaml:"token"`
+	// GroupRoles match SCIM groups by display name.
+	GroupRoles []GroupRole `yaml:"group_roles"`
+}
+
+// Enabled reports whether the SCIM API is served.
+func (c SCIMConfig) Enabled() bool {
+	return c.Token != ""
 }
 
 // App is the runtime application configuration used by the rest of the code.
@@ -58,6 +319,51 @@ var (
 
 	// DBDriver is the selected database driver ("sqlite" or "postgres").
 	DBDriver string
+
+	// Agent holds agent subsystem configuration.
+	Agent AgentConfig
+
+	// Workspace holds workspace configuration.
+	Workspace WorkspaceConfig
+
+	// Secrets holds secret store configuration.
+	Secrets SecretsConfig
+
+	// Webhook holds webhook delivery configuration.
+	Webhook WebhookConfig
+
+	// Auth holds login protection and administration configuration.
+	Auth AuthConfig
+
+	// CORS holds the cross-origin policy.
+	CORS CORSConfig
+
+	// TLS holds the HTTPS settings.
+	TLS TLSConfig
+
+	// Cookie holds the session cookie settings.
+	Cookie CookieConfig
+
+	// Server holds HTTP server limits.
+	Server ServerConfig
+
+	// Metrics holds the Prometheus endpoint settings.
+	Metrics MetricsConfig
+
+	// Logging holds the log level and format.
+	Logging LoggingConfig
+
+	// Tracing holds the trace export settings.
+	Tracing TracingConfig
+
+	// OIDC holds the single sign-on settings.
+	OIDC OIDCConfig
+
+	// LDAP holds the LDAP login backend settings.
+	LDAP LDAPConfig
+
+	// SCIM holds the user provisioning settings.
+	SCIM SCIMConfig
 )
 
 // LoadAppConfig initialises application configuration from config.yaml and env.
@@ -67,6 +373,11 @@ var (
 //   3. Environment variables
 func LoadAppConfig() error {
 	// Defaults
+	allowCredentials := true
+	metricsEnabled := true
+	sampleRatio := 1.0
+	provision := true
+	trashRetentionDays := 30
 	cfg := Config{
 		App: AppConfig{
 			Port:            8080,
@@ -84,6 +395,75 @@ func LoadAppConfig() error {
 			DBName:   "secretlane",
 			SSLMode:  "disable",
 		},
+		Agent: AgentConfig{
+			IdentityKeyFile: "./secretlane-agent-identity.pem",
+		},
+		Workspace: WorkspaceConfig{
+			TrashRetentionDays: &trashRetentionDays,
+		},
+		Secrets: SecretsConfig{
+			KeyFile: "./secretlane-secrets.key",
+		},
+		Auth: AuthConfig{
+			Backends:           []string{"local"},
+			RateLimitStore:     "memory",
+			LoginRatePerMinute: 10,
+			LoginBurst:         10,
+			LockoutThreshold:   5,
+			LockoutMinutes:     1,
+			LockoutMaxMinutes:  60,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   []string{"http://localhost:3000"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-CSRF-Token"},
+			ExposedHeaders:   []string{"X-Request-ID", "Retry-After"},
+			AllowCredentials: &allowCredentials,
+			MaxAgeSeconds:    600,
+		},
+		TLS: TLSConfig{
+			ClientAuth: "none",
+		},
+		Cookie: CookieConfig{
+			SameSite:      "lax",
+			LifetimeHours: 24,
+		},
+		Server: ServerConfig{
+			ReadTimeoutSeconds:       30,
+			ReadHeaderTimeoutSeconds: 10,
+			WriteTimeoutSeconds:      60,
+			IdleTimeoutSeconds:       120,
+			MaxHeaderBytes:           1 << 20,
+			ShutdownTimeoutSeconds:   30,
+		},
+		Metrics: MetricsConfig{
+			Enabled: &metricsEnabled,
+			Host:    "127.0.0.1",
+			Port:    9090,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "secretlane",
+			SampleRatio: &sampleRatio,
+		},
+		OIDC: OIDCConfig{
+			Scopes:            []string{"openid", "email", "profile"},
+			EmailClaim:        "email",
+			GroupsClaim:       "groups",
+			Provision:         &provision,
+			PostLoginRedirect: "/",
+		},
+		LDAP: LDAPConfig{
+			UserFilter:     "(uid={username})",
+			GroupAttribute: "memberOf",
+			Provision:      &provision,
+			TimeoutSeconds: 10,
+		},
 	}
 
 	// Optional YAML config
@@ -97,6 +477,9 @@ func LoadAppConfig() error {
 	}
 
 	applyEnvOverrides(&cfg)
+	if err := cfg.validate(); err != nil {
+		return err
+	}
 
 	// Expose runtime config
 	App = AppRuntimeConfig{
@@ -106,6 +489,21 @@ func LoadAppConfig() error {
 	}
 	DBConfig = cfg.Postgres
 	DBDriver = cfg.Database.Driver
+	Agent = cfg.Agent
+	Workspace = cfg.Workspace
+	Secrets = cfg.Secrets
+	Webhook = cfg.Webhook
+	Auth = cfg.Auth
+	CORS = cfg.CORS
+	TLS = cfg.TLS
+	Cookie = cfg.Cookie
+	Server = cfg.Server
+	Metrics = cfg.Metrics
+	Logging = cfg.Logging
+	Tracing = cfg.Tracing
+	OIDC = cfg.OIDC
+	LDAP = cfg.LDAP
+	SCIM = cfg.SCIM
 
 	return nil
 }
@@ -141,10 +539,227 @@ func mergeConfig(dst, src *Config) {
 	if src.Postgres.SSLMode != "" {
 		dst.Postgres.SSLMode = src.Postgres.SSLMode
 	}
+	if src.Postgres.MaxConns != 0 {
+		dst.Postgres.MaxConns = src.Postgres.MaxConns
+	}
 
 	if src.Database.Driver != "" {
 		dst.Database.Driver = src.Database.Driver
 	}
+
+	if src.Agent.IdentityKeyFile != "" {
+		dst.Agent.IdentityKeyFile = src.Agent.IdentityKeyFile
+	}
+
+	if src.Workspace.TrashRetentionDays != nil {
+		dst.Workspace.TrashRetentionDays = src.Workspace.TrashRetentionDays
+	}
+
+	if src.Secrets.KeyFile != "" {
+		dst.Secrets.KeyFile = src.Secrets.KeyFile
+	}
+
+	if src.Webhook.AllowedNetworks != nil {
+		dst.Webhook.AllowedNetworks = src.Webhook.AllowedNetworks
+	}
+
+	if len(src.Auth.Admins) > 0 {
+		dst.Auth.Admins = src.Auth.Admins
+	}
+	if len(src.Auth.Backends) > 0 {
+		dst.Auth.Backends = src.Auth.Backends
+	}
+	if src.Auth.RateLimitStore != "" {
+		dst.Auth.RateLimitStore = src.Auth.RateLimitStore
+	}
+	if src.Auth.LoginRatePerMinute != 0 {
+		dst.Auth.LoginRatePerMinute = src.Auth.LoginRatePerMinute
+	}
+	if src.Auth.LoginBurst != 0 {
+		dst.Auth.LoginBurst = src.Auth.LoginBurst
+	}
+	if src.Auth.LockoutThreshold != 0 {
+		dst.Auth.LockoutThreshold = src.Auth.LockoutThreshold
+	}
+	if src.Auth.LockoutMinutes != 0 {
+		dst.Auth.LockoutMinutes = src.Auth.LockoutMinutes
+	}
+	if src.Auth.LockoutMaxMinutes != 0 {
+		dst.Auth.LockoutMaxMinutes = src.Auth.LockoutMaxMinutes
+	}
+
+	if len(src.CORS.AllowedOrigins) > 0 {
+		dst.CORS.AllowedOrigins = src.CORS.AllowedOrigins
+	}
+	if len(src.CORS.AllowedMethods) > 0 {
+		dst.CORS.AllowedMethods = src.CORS.AllowedMethods
+	}
+	if len(src.CORS.AllowedHeaders) > 0 {
+		dst.CORS.AllowedHeaders = src.CORS.AllowedHeaders
+	}
+	if len(src.CORS.ExposedHeaders) > 0 {
+		dst.CORS.ExposedHeaders = src.CORS.ExposedHeaders
+	}
+	// A pointer, so that an explicit false overrides the default.
+	if src.CORS.AllowCredentials != nil {
+		dst.CORS.AllowCredentials = src.CORS.AllowCredentials
+	}
+	if src.CORS.MaxAgeSeconds != 0 {
+		dst.CORS.MaxAgeSeconds = src.CORS.MaxAgeSeconds
+	}
+
+	if src.TLS.CertFile != "" {
+		dst.TLS.CertFile = src.TLS.CertFile
+	}
+	if src.TLS.KeyFile != "" {
+		dst.TLS.KeyFile = src.TLS.KeyFile
+	}
+	if src.TLS.ClientAuth != "" {
+		dst.TLS.ClientAuth = src.TLS.ClientAuth
+	}
+	if src.TLS.ClientCAFile != "" {
+		dst.TLS.ClientCAFile = src.TLS.ClientCAFile
+	}
+	if src.TLS.RedirectPort != 0 {
+		dst.TLS.RedirectPort = src.TLS.RedirectPort
+	}
+
+	if src.Cookie.Domain != "" {
+		dst.Cookie.Domain = src.Cookie.Domain
+	}
+	if src.Cookie.SameSite != "" {
+		dst.Cookie.SameSite = src.Cookie.SameSite
+	}
+	if src.Cookie.LifetimeHours != 0 {
+		dst.Cookie.LifetimeHours = src.Cookie.LifetimeHours
+	}
+	if src.Cookie.Secure {
+		dst.Cookie.Secure = true
+	}
+
+	if src.Server.ReadTimeoutSeconds != 0 {
+		dst.Server.ReadTimeoutSeconds = src.Server.ReadTimeoutSeconds
+	}
+	if src.Server.ReadHeaderTimeoutSeconds != 0 {
+		dst.Server.ReadHeaderTimeoutSeconds = src.Server.ReadHeaderTimeoutSeconds
+	}
+	if src.Server.WriteTimeoutSeconds != 0 {
+		dst.Server.WriteTimeoutSeconds = src.Server.WriteTimeoutSeconds
+	}
+	if src.Server.IdleTimeoutSeconds != 0 {
+		dst.Server.IdleTimeoutSeconds = src.Server.IdleTimeoutSeconds
+	}
+	if src.Server.MaxHeaderBytes != 0 {
+		dst.Server.MaxHeaderBytes = src.Server.MaxHeaderBytes
+	}
+	if src.Server.ShutdownTimeoutSeconds != 0 {
+		dst.Server.ShutdownTimeoutSeconds = src.Server.ShutdownTimeoutSeconds
+	}
+
+	if src.Metrics.Enabled != nil {
+		dst.Metrics.Enabled = src.Metrics.Enabled
+	}
+	if src.Metrics.Host != "" {
+		dst.Metrics.Host = src.Metrics.Host
+	}
+	if src.Metrics.Port != 0 {
+		dst.Metrics.Port = src.Metrics.Port
+	}
+	if src.Metrics.SecretReadWorkspaces != nil {
+		dst.Metrics.SecretReadWorkspaces = src.Metrics.SecretReadWorkspaces
+	}
+
+	if src.Logging.Level != "" {
+		dst.Logging.Level = src.Logging.Level
+	}
+	if src.Logging.Format != "" {
+		dst.Logging.Format = src.Logging.Format
+	}
+
+	if src.Tracing.Exporter != "" {
+		dst.Tracing.Exporter = src.Tracing.Exporter
+	}
+	if src.Tracing.Endpoint != "" {
+		dst.Tracing.Endpoint = src.Tracing.Endpoint
+	}
+	if src.Tracing.ServiceName != "" {
+		dst.Tracing.ServiceName = src.Tracing.ServiceName
+	}
+	if src.Tracing.SampleRatio != nil {
+		dst.Tracing.SampleRatio = src.Tracing.SampleRatio
+	}
+
+	if src.OIDC.Issuer != "" {
+		dst.OIDC.Issuer = src.OIDC.Issuer
+	}
+	if src.OIDC.ClientID != "" {
+		dst.OIDC.ClientID = src.OIDC.ClientID
+	}
+	if src.OIDC.ClientSecret != "" {
+		dst.OIDC.ClientSecret = src.OIDC.ClientSecret
+	}
+	if src.OIDC.RedirectURL != "" {
+		dst.OIDC.RedirectURL = src.OIDC.RedirectURL
+	}
+	if len(src.OIDC.Scopes) > 0 {
+		dst.OIDC.Scopes = src.OIDC.Scopes
+	}
+	if src.OIDC.EmailClaim != "" {
+		dst.OIDC.EmailClaim = src.OIDC.EmailClaim
+	}
+	if src.OIDC.GroupsClaim != "" {
+		dst.OIDC.GroupsClaim = src.OIDC.GroupsClaim
+	}
+	if src.OIDC.Provision != nil {
+		dst.OIDC.Provision = src.OIDC.Provision
+	}
+	if len(src.OIDC.GroupRoles) > 0 {
+		dst.OIDC.GroupRoles = src.OIDC.GroupRoles
+	}
+	if src.OIDC.PostLoginRedirect != "" {
+		dst.OIDC.PostLoginRedirect = src.OIDC.PostLoginRedirect
+	}
+
+	if src.LDAP.URL != "" {
+		dst.LDAP.URL = src.LDAP.URL
+	}
+	if src.LDAP.StartTLS {
+		dst.LDAP.StartTLS = true
+	}
+	if src.LDAP.CAFile != "" {
+		dst.LDAP.CAFile = src.LDAP.CAFile
+	}
+	if src.LDAP.BindDN != "" {
+		dst.LDAP.BindDN = src.LDAP.BindDN
+	}
+	if src.LDAP.BindPassword != "" {
+		dst.LDAP.BindPassword = src.LDAP.BindPassword
+	}
+	if src.LDAP.BaseDN != "" {
+		dst.LDAP.BaseDN = src.LDAP.BaseDN
+	}
+	if src.LDAP.UserFilter != "" {
+		dst.LDAP.UserFilter = src.LDAP.UserFilter
+	}
+	if src.LDAP.GroupAttribute != "" {
+		dst.LDAP.GroupAttribute = src.LDAP.GroupAttribute
+	}
+	if len(src.LDAP.GroupRoles) > 0 {
+		dst.LDAP.GroupRoles = src.LDAP.GroupRoles
+	}
+	if src.LDAP.Provision != nil {
+		dst.LDAP.Provision = src.LDAP.Provision
+	}
+	if src.LDAP.TimeoutSeconds != 0 {
+		dst.LDAP.TimeoutSeconds = src.LDAP.TimeoutSeconds
+	}
+
+	if src.SCIM.Token != "" {
+		dst.SCIM.Token = src.SCIM.Token
+	}
+	if len(src.SCIM.GroupRoles) > 0 {
+		dst.SCIM.GroupRoles = src.SCIM.GroupRoles
+	}
 }
 
 // applyEnvOverrides applies environment variables over the config.
@@ -185,4 +800,220 @@ func applyEnvOverrides(c *Config) {
 	if v := os.Getenv("DB_DRIVER"); v != "" {
 		c.Database.Driver = v
 	}
+
+	if v := os.Getenv("AGENT_IDENTITY_KEY_FILE"); v != "" {
+		c.Agent.IdentityKeyFile = v
+	}
+
+	if v := os.Getenv("WORKSPACE_TRASH_RETENTION_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			c.Workspace.TrashRetentionDays = &days
+		}
+	}
+
+	if v := os.Getenv("SECRETS_KEY_FILE"); v != "" {
+		c.Secrets.KeyFile = v
+	}
+
+	if v := os.Getenv("WEBHOOK_ALLOWED_NETWORKS"); v != "" {
+		c.Webhook.AllowedNetworks = splitList(v)
+	}
+
+	if v := os.Getenv("AUTH_ADMINS"); v != "" {
+		c.Auth.Admins = splitList(v)
+	}
+	if v := os.Getenv("AUTH_RATE_LIMIT_STORE"); v != "" {
+		c.Auth.RateLimitStore = v
+	}
+	if v := os.Getenv("AUTH_LOGIN_RATE_PER_MINUTE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Auth.LoginRatePerMinute = n
+		}
+	}
+	if v := os.Getenv("AUTH_LOCKOUT_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Auth.LockoutThreshold = n
+		}
+	}
+
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		c.CORS.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("CORS_ALLOWED_METHODS"); v != "" {
+		c.CORS.AllowedMethods = splitList(v)
+	}
+	if v := os.Getenv("CORS_ALLOWED_HEADERS"); v != "" {
+		c.CORS.AllowedHeaders = splitList(v)
+	}
+	if v := os.Getenv("CORS_EXPOSED_HEADERS"); v != "" {
+		c.CORS.ExposedHeaders = splitList(v)
+	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		allow := v == "true" || v == "1"
+		c.CORS.AllowCredentials = &allow
+	}
+	if v := os.Getenv("CORS_MAX_AGE_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.CORS.MaxAgeSeconds = n
+		}
+	}
+
+	if v := os.Getenv("TLS_CERT_FILE"); v != "" {
+		c.TLS.CertFile = v
+	}
+	if v := os.Getenv("TLS_KEY_FILE"); v != "" {
+		c.TLS.KeyFile = v
+	}
+	if v := os.Getenv("TLS_CLIENT_AUTH"); v != "" {
+		c.TLS.ClientAuth = v
+	}
+	if v := os.Getenv("TLS_CLIENT_CA_FILE"); v != "" {
+		c.TLS.ClientCAFile = v
+	}
+	if v := os.Getenv("TLS_REDIRECT_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			c.TLS.RedirectPort = port
+		}
+	}
+
+	if v := os.Getenv("COOKIE_DOMAIN"); v != "" {
+		c.Cookie.Domain = v
+	}
+	if v := os.Getenv("COOKIE_SAME_SITE"); v != "" {
+		c.Cookie.SameSite = v
+	}
+	if v := os.Getenv("COOKIE_LIFETIME_HOURS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Cookie.LifetimeHours = n
+		}
+	}
+	if v := os.Getenv("COOKIE_SECURE"); v != "" {
+		c.Cookie.Secure = v == "true" || v == "1"
+	}
+
+	if v := os.Getenv("SERVER_READ_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.ReadTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SERVER_WRITE_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.WriteTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SERVER_IDLE_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.IdleTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("SERVER_SHUTDOWN_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.ShutdownTimeoutSeconds = n
+		}
+	}
+
+	if v := os.Getenv("METRICS_ENABLED"); v != "" {
+		enabled := v == "true" || v == "1"
+		c.Metrics.Enabled = &enabled
+	}
+	if v := os.Getenv("METRICS_HOST"); v != "" {
+		c.Metrics.Host = v
+	}
+	if v := os.Getenv("METRICS_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			c.Metrics.Port = port
+		}
+	}
+	if v := os.Getenv("METRICS_SECRET_READ_WORKSPACES"); v != "" {
+		var ids []int
+		for _, s := range splitList(v) {
+			if id, err := strconv.Atoi(s); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		c.Metrics.SecretReadWorkspaces = ids
+	}
+
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		c.Logging.Level = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		c.Logging.Format = v
+	}
+
+	if v := os.Getenv("TRACING_EXPORTER"); v != "" {
+		c.Tracing.Exporter = v
+	}
+	if v := os.Getenv("TRACING_ENDPOINT"); v != "" {
+		c.Tracing.Endpoint = v
+	}
+	if v := os.Getenv("TRACING_SAMPLE_RATIO"); v != "" {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			c.Tracing.SampleRatio = &n
+		}
+	}
+
+	if v := os.Getenv("OIDC_ISSUER"); v != "" {
+		c.OIDC.Issuer = v
+	}
+	if v := os.Getenv("OIDC_CLIENT_ID"); v != "" {
+		c.OIDC.ClientID = v
+	}
+	if v := os.Getenv("OIDC_CLIENT_SECRET"); v != "" {
+		c.OIDC.ClientSecret = v
+	}
+	if v := os.Getenv("OIDC_REDIRECT_URL"); v != "" {
+		c.OIDC.RedirectURL = v
+	}
+
+	if v := os.Getenv("AUTH_BACKENDS"); v != "" {
+		c.Auth.Backends = splitList(v)
+	}
+	if v := os.Getenv("LDAP_URL"); v != "" {
+		c.LDAP.URL = v
+	}
+	if v := os.Getenv("LDAP_BIND_DN"); v != "" {
+		c.LDAP.BindDN = v
+	}
+	if v := os.Getenv("LDAP_BIND_PASSWORD"); v != "" {
+		c.LDAP.BindPassword = v
+	}
+	if v := os.Getenv("LDAP_BASE_DN"); v != "" {
+		c.LDAP.BaseDN = v
+	}
+
+	if v := os.Getenv("SCIM_TOKEN"); v != "" {
+		c.SCIM.Token = v
+	}
+}
+
+// validate rejects combinations that are unsafe rather than merely odd.
+func (c *Config) validate() error {
+	// Credentialed CORS cannot use "*", so the origin would have to be
+	// echoed, letting every site on the web act with a visitor's session.
+	if c.CORS.AllowCredentials != nil && *c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		return errors.New(`cors.allowed_origins "*" cannot be combined with cors.allow_credentials; list the frontend origins or set allow_credentials to false`)
+	}
+
+	if c.Workspace.PurgeAfterDays() < 0 {
+		return errors.New("workspace.trash_retention_days must not be negative; use 0 to disable automatic purging")
+	}
+
+	switch strings.ToLower(c.Cookie.SameSite) {
+	case "lax", "strict":
+	case "none":
+		// Browsers drop SameSite=None cookies that are not Secure, so
+		// logins would appear to succeed and then not stick.
+		if !c.TLS.Enabled() && !c.Cookie.Secure {
+			return errors.New(`cookie.same_site "none" needs HTTPS: enable tls or set cookie.secure behind a TLS-terminating proxy`)
+		}
+	default:
+		return fmt.Errorf("unknown cookie.same_site %q (want lax, strict or none)", c.Cookie.SameSite)
+	}
+	return nil
+}
+
+// splitList splits a comma- or space-separated env value.
+func splitList(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
 }
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAppConfigRejectsUnsafeCombinations(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "any origin with credentials",
+			env:  map[string]string{"CORS_ALLOWED_ORIGINS": "*"},
+			want: `cors.allowed_origins "*"`,
+		},
+		{
+			name: "any origin without credentials",
+			env:  map[string]string{"CORS_ALLOWED_ORIGINS": "*", "CORS_ALLOW_CREDENTIALS": "false"},
+		},
+		{
+			name: "same_site none over plain http",
+			env:  map[string]string{"COOKIE_SAME_SITE": "none"},
+			want: `cookie.same_site "none" needs HTTPS`,
+		},
+		{
+			name: "same_site none behind a TLS proxy",
+			env:  map[string]string{"COOKIE_SAME_SITE": "none", "COOKIE_SECURE": "true"},
+		},
+		{
+			name: "same_site none with native TLS",
+			env:  map[string]string{"COOKIE_SAME_SITE": "None", "TLS_CERT_FILE": "tls.crt", "TLS_KEY_FILE": "tls.key"},
+		},
+		{
+			name: "negative trash retention",
+			env:  map[string]string{"WORKSPACE_TRASH_RETENTION_DAYS": "-1"},
+			want: "workspace.trash_retention_days must not be negative",
+		},
+		{
+			name: "unknown same_site",
+			env:  map[string]string{"COOKIE_SAME_SITE": "sometimes"},
+			want: "unknown cookie.same_site",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			err := LoadAppConfig()
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("LoadAppConfig: %v", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Fatalf("LoadAppConfig err = %v, want it to mention %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrashRetentionZeroDisablesPurging(t *testing.T) {
+	if err := LoadAppConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Workspace.PurgeAfterDays(); got != 30 {
+		t.Fatalf("default retention = %d days, want 30", got)
+	}
+
+	t.Setenv("WORKSPACE_TRASH_RETENTION_DAYS", "0")
+	if err := LoadAppConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Workspace.PurgeAfterDays(); got != 0 {
+		t.Fatalf("retention with 0 configured = %d days, want 0 (disabled)", got)
+	}
+}
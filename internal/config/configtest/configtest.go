@@ -0,0 +1,24 @@
+// Package configtest points the config package at throwaway databases so
+// tests can run services against a real, migrated schema.
+package configtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// SQLite makes a fresh, migrated sqlite database in a temporary directory the
+// active database for the rest of the test.
+func SQLite(t testing.TB) {
+	t.Helper()
+	db, err := config.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	config.DBDriver = "sqlite"
+	config.DB = db
+	config.RunMigrations()
+}
@@ -3,19 +3,22 @@ package config
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
-	pgx "github.com/jackc/pgx/v5"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
 var (
 	// DB is used in sqlite mode.
 	DB *sql.DB
-	// PGXConn is used in postgres mode.
-	PGXConn *pgx.Conn
+	// PGXPool is used in postgres mode. It is safe for concurrent use; each
+	// query borrows a connection for its duration.
+	PGXPool *pgxpool.Pool
 )
 
 // InitDatabase connects to SQLite (db-less mode) or Postgres depending on config.
@@ -31,37 +34,64 @@ func InitDatabase() {
 	case "postgres":
 		conn, err := initPostgres()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to init postgres: %v\n", err)
+			slog.Error("failed to init postgres", "err", err)
 			os.Exit(1)
 		}
 		if err := conn.Ping(context.Background()); err != nil {
-			fmt.Fprintf(os.Stderr, "failed to ping postgres: %v\n", err)
+			slog.Error("failed to ping postgres", "err", err)
 			os.Exit(1)
 		}
-		PGXConn = conn
+		PGXPool = conn
 	default:
 		db, err := initSQLite()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to init sqlite: %v\n", err)
+			slog.Error("failed to init sqlite", "err", err)
 			os.Exit(1)
 		}
 		if err := db.Ping(); err != nil {
-			fmt.Fprintf(os.Stderr, "failed to ping sqlite: %v\n", err)
+			slog.Error("failed to ping sqlite", "err", err)
 			os.Exit(1)
 		}
 		DB = db
 	}
 
-	log.Printf("[DB] Connected using driver=%s\n", DBDriver)
+	slog.Info("database connected", "driver", DBDriver)
+}
+
+// PingDatabase checks that the active backend answers.
+func PingDatabase(ctx context.Context) error {
+	if DBDriver == "postgres" {
+		return PGXPool.Ping(ctx)
+	}
+	return DB.PingContext(ctx)
+}
+
+// CloseDatabase closes the connection opened by InitDatabase.
+func CloseDatabase() error {
+	if PGXPool != nil {
+		PGXPool.Close()
+		return nil
+	}
+	if DB != nil {
+		return DB.Close()
+	}
+	return nil
 }
 
 func initSQLite() (*sql.DB, error) {
 	// Local file-based SQLite: DB-less mode.
-	dsn := "./sqlite-secretlane.db"
-	return sql.Open("sqlite3", dsn)
+	return OpenSQLite("./sqlite-secretlane.db")
 }
 
-func initPostgres() (*pgx.Conn, error) {
+// OpenSQLite opens the SQLite database at path with foreign keys enforced.
+// SQLite leaves them off unless every connection asks, and without them the
+// ON DELETE CASCADE clauses the schema relies on (purging a workspace takes
+// its secrets, agents and webhooks with it) silently do nothing.
+func OpenSQLite(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", path+"?_foreign_keys=on")
+}
+
+func initPostgres() (*pgxpool.Pool, error) {
 	// Build DSN from config.DBConfig (set by LoadAppConfig).
 	host := DBConfig.Host
 	port := DBConfig.Port
@@ -91,6 +121,25 @@ func initPostgres() (*pgx.Conn, error) {
 		host, port, user, password, dbname, sslmode,
 	)
 
-	// Use pgx directly as in the official docs example.
-	return pgx.Connect(context.Background(), connString)
+	if DBConfig.MaxConns > 0 {
+		connString += fmt.Sprintf(" pool_max_conns=%d", DBConfig.MaxConns)
+	}
+
+	// A pool rather than a single *pgx.Conn, which cannot be used by two
+	// requests at once.
+	return pgxpool.New(context.Background(), connString)
+}
+
+// IsUniqueViolation reports whether err is a unique constraint or unique
+// index violation from either driver.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		return liteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
 }
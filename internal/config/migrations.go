@@ -1,113 +1,539 @@
 package config
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
 
-// RunMigrations creates all required tables.
+	"golang.org/x/crypto/bcrypt"
+)
+
+// migrated is set once RunMigrations has finished.
+var migrated atomic.Bool
+
+// SchemaVersion is the version of the newest migration; RunMigrations brings
+// the database up to it.
+const SchemaVersion = 1
+
+// migration is one versioned schema change. Its statements run in a single
+// transaction together with the schema_migrations row that records it, so a
+// version is either fully applied or not applied at all. Migrations are
+// append-only: once released, a version's statements never change, and
+// later changes (including dropping anything) go in a new version.
+type migration struct {
+	version  int
+	name     string
+	sqlite   []string
+	postgres []string
+}
+
+// The account seedDefaultUser creates. Change the password after the first
+// login.
+const (
+	defaultUsername     = "admin@local"
+	defaultUserPassword = "ChangeMe123!"
+)
+
+// migrationLockID keys the postgres advisory lock that keeps instances
+// starting together from applying the same migration twice.
+const migrationLockID = 7306429104
+
+// RunMigrations applies every migration newer than the version recorded in
+// schema_migrations and seeds the default user if configured. Existing data
+// is never dropped, so it is safe to run on every start.
 // Call this AFTER InitDatabase().
 func RunMigrations() {
+	var err error
 	if DBDriver == "postgres" {
-		runPostgresMigrations()
+		err = runPostgresMigrations(context.Background())
 	} else {
-		runSQLiteMigrations()
+		err = runSQLiteMigrations(context.Background())
+	}
+	if err != nil {
+		migrationFailed("applying migrations", DBDriver, err)
 	}
+	seedDefaultUser()
+	migrated.Store(true)
 }
 
-func runSQLiteMigrations() {
-	// DEV ONLY: Drop everything before recreating.
-	_, err := DB.Exec(`
-        DROP TABLE IF EXISTS workspaces;
-        DROP TABLE IF EXISTS users;
-    `)
+func runSQLiteMigrations(ctx context.Context) error {
+	if _, err := DB.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at DATETIME NOT NULL
+        );
+    `); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Fatalf("[MIGRATION] failed dropping tables (sqlite): %v", err)
+		return err
 	}
+	defer tx.Rollback()
 
-	// USERS
-	_, err = DB.Exec(`
-        CREATE TABLE IF NOT EXISTS users (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            username TEXT UNIQUE NOT NULL,
-            password TEXT NOT NULL
-        );
-    `)
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	for _, m := range pendingMigrations(current) {
+		for _, stmt := range m.sqlite {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now().UTC()); err != nil {
+			return err
+		}
+		slog.Info("migration applied", "driver", "sqlite", "version", m.version, "name", m.name)
+	}
+	return tx.Commit()
+}
+
+func runPostgresMigrations(ctx context.Context) error {
+	tx, err := PGXPool.Begin(ctx)
 	if err != nil {
-		log.Fatalf("[MIGRATION] failed creating users table (sqlite): %v", err)
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	if App.SeedDefaultUser {
-		_, err = DB.Exec(`
-    INSERT INTO users (username, password)
-        VALUES ('admin@local', 'ChangeMe123!')
-    ON CONFLICT(username) DO NOTHING;
-`)
-		if err != nil {
-			log.Fatalf("[MIGRATION] failed inserting default user (sqlite): %v", err)
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(migrationLockID)); err != nil {
+		return fmt.Errorf("locking schema_migrations: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at TIMESTAMPTZ NOT NULL
+        );
+    `); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	for _, m := range pendingMigrations(current) {
+		for _, stmt := range m.postgres {
+			if _, err := tx.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+			m.version, m.name, time.Now().UTC()); err != nil {
+			return err
+		}
+		slog.Info("migration applied", "driver", "postgres", "version", m.version, "name", m.name)
+	}
+	return tx.Commit(ctx)
+}
+
+// pendingMigrations returns the migrations newer than current, in order. A
+// database ahead of this build (during a rollback, say) is left alone.
+func pendingMigrations(current int) []migration {
+	if current > SchemaVersion {
+		slog.Warn("database schema is newer than this build", "version", current, "build_version", SchemaVersion)
+	}
+	var pending []migration
+	for _, m := range migrations {
+		if m.version > current {
+			pending = append(pending, m)
 		}
 	}
+	return pending
+}
+
+// seedDefaultUser creates the default admin user unless it already exists.
+// The password is stored as a bcrypt hash, like every other.
+func seedDefaultUser() {
+	if !App.SeedDefaultUser {
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(defaultUserPassword), bcrypt.DefaultCost)
+	if err != nil {
+		migrationFailed("hashing default user password", DBDriver, err)
+	}
+	query := `
+        INSERT INTO users (username, password)
+        VALUES ($1, $2)
+        ON CONFLICT (username) DO NOTHING;
+    `
+	if DBDriver == "postgres" {
+		_, err = PGXPool.Exec(context.Background(), query, defaultUsername, string(hash))
+	} else {
+		_, err = DB.Exec(query, defaultUsername, string(hash))
+	}
+	if err != nil {
+		migrationFailed("inserting default user", DBDriver, err)
+	}
+}
 
-	// WORKSPACES
-	_, err = DB.Exec(`
+// CheckMigrations reports an error unless migrations have run and the
+// database records at least SchemaVersion. A restore from an older backup,
+// or another instance migrating it away, is caught here.
+func CheckMigrations(ctx context.Context) error {
+	if !migrated.Load() {
+		return fmt.Errorf("migrations have not run")
+	}
+
+	var version int
+	var err error
+	query := `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	if DBDriver == "postgres" {
+		err = PGXPool.QueryRow(ctx, query).Scan(&version)
+	} else {
+		err = DB.QueryRowContext(ctx, query).Scan(&version)
+	}
+	if err != nil {
+		return err
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("schema is at version %d, want %d", version, SchemaVersion)
+	}
+	return nil
+}
+
+// migrations lists every schema version in order. Version 1 only creates
+// what is missing, so databases set up before versioning adopt it in place.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial schema",
+		sqlite: []string{
+			// USERS
+			`
+        CREATE TABLE IF NOT EXISTS users (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            username TEXT UNIQUE NOT NULL,
+            password TEXT NOT NULL,
+            email TEXT,
+            display_name TEXT,
+            active BOOLEAN NOT NULL DEFAULT 1,
+            external_id TEXT UNIQUE,
+            auth_source TEXT,
+            auth_subject TEXT,
+            deleted_at DATETIME,
+            UNIQUE (auth_source, auth_subject)
+        );
+        `,
+			// ORGANIZATIONS
+			`
+        CREATE TABLE IF NOT EXISTS organizations (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            personal_user_id INTEGER UNIQUE,
+            created_at DATETIME NOT NULL,
+            FOREIGN KEY (personal_user_id) REFERENCES users(id)
+        );
+
+        CREATE TABLE IF NOT EXISTS org_members (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            org_id INTEGER NOT NULL,
+            user_id INTEGER NOT NULL,
+            role TEXT NOT NULL,
+            created_at DATETIME NOT NULL,
+            UNIQUE (org_id, user_id),
+            FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+            FOREIGN KEY (user_id) REFERENCES users(id)
+        );
+        `,
+			// WORKSPACES: live names are unique per organization; trashed ones do
+			// not count, so a name can be reused while the old workspace is restorable.
+			`
         CREATE TABLE IF NOT EXISTS workspaces (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
+            org_id INTEGER NOT NULL,
             name TEXT NOT NULL,
             description TEXT,
             created_by INTEGER NOT NULL,
             created_at TEXT DEFAULT (datetime('now')),
+            deleted_at DATETIME,
+            FOREIGN KEY (org_id) REFERENCES organizations(id),
             FOREIGN KEY (created_by) REFERENCES users(id)
         );
-    `)
-	if err != nil {
-		log.Fatalf("[MIGRATION] failed creating workspaces table (sqlite): %v", err)
-	}
 
-	log.Println("[MIGRATION] Users and workspaces tables created successfully (sqlite)")
-}
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_org_name_live
+            ON workspaces (org_id, name) WHERE deleted_at IS NULL;
+        `,
+			// SECRETS: value holds the sealed (encrypted) value; version counts
+			// changes and starts at 1.
+			`
+        CREATE TABLE IF NOT EXISTS secrets (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            value TEXT NOT NULL,
+            version INTEGER NOT NULL DEFAULT 1,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            updated_at DATETIME NOT NULL,
+            UNIQUE (workspace_id, name),
+            FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+            FOREIGN KEY (created_by) REFERENCES users(id)
+        );
+        `,
+			// AGENTS
+			`
+        CREATE TABLE IF NOT EXISTS agent_join_tokens (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL,
+            token_hash TEXT UNIQUE NOT NULL,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            expires_at DATETIME NOT NULL,
+            used_at DATETIME,
+            FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+            FOREIGN KEY (created_by) REFERENCES users(id)
+        );
 
-func runPostgresMigrations() {
-	// DEV ONLY: drop and recreate just what we need (users + workspaces).
-	_, err := DB.Exec(`
-        DROP TABLE IF EXISTS workspaces;
-        DROP TABLE IF EXISTS users;
-    `)
-	if err != nil {
-		log.Fatalf("[MIGRATION] failed dropping tables (postgres): %v", err)
-	}
+        CREATE TABLE IF NOT EXISTS agents (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            public_key TEXT UNIQUE NOT NULL,
+            created_at DATETIME NOT NULL,
+            last_seen_at DATETIME,
+            revoked_at DATETIME,
+            FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+        );
+        `,
+			// WEBHOOKS
+			`
+        CREATE TABLE IF NOT EXISTS webhooks (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL,
+            url TEXT NOT NULL,
+            events TEXT NOT NULL DEFAULT '',
+            secret TEXT NOT NULL,
+            active BOOLEAN NOT NULL DEFAULT 1,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+            FOREIGN KEY (created_by) REFERENCES users(id)
+        );
 
-	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS webhook_deliveries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            webhook_id INTEGER NOT NULL,
+            event_type TEXT NOT NULL,
+            payload TEXT NOT NULL,
+            status TEXT NOT NULL,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at DATETIME,
+            last_status_code INTEGER NOT NULL DEFAULT 0,
+            last_error TEXT NOT NULL DEFAULT '',
+            created_at DATETIME NOT NULL,
+            delivered_at DATETIME,
+            FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+            ON webhook_deliveries (status, next_attempt_at);
+        `,
+			// EVENTS
+			`
+        CREATE TABLE IF NOT EXISTS events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            workspace_id INTEGER NOT NULL,
+            type TEXT NOT NULL,
+            actor_id INTEGER NOT NULL DEFAULT 0,
+            data TEXT NOT NULL DEFAULT '{}',
+            occurred_at DATETIME NOT NULL
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_events_workspace_id
+            ON events (workspace_id, id);
+        `,
+			// RATE LIMITS: token buckets and login lockouts shared by all instances.
+			`
+        CREATE TABLE IF NOT EXISTS rate_limits (
+            name TEXT PRIMARY KEY,
+            tokens REAL NOT NULL DEFAULT 0,
+            failures INTEGER NOT NULL DEFAULT 0,
+            locked_until DATETIME,
+            updated_at DATETIME NOT NULL,
+            version INTEGER NOT NULL
+        );
+        `,
+			// SCIM GROUPS: groups pushed by the identity provider, whose members
+			// get the roles mapped to them in config.
+			`
+        CREATE TABLE IF NOT EXISTS scim_groups (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            display_name TEXT UNIQUE NOT NULL,
+            external_id TEXT UNIQUE
+        );
+
+        CREATE TABLE IF NOT EXISTS scim_group_members (
+            group_id INTEGER NOT NULL,
+            user_id INTEGER NOT NULL,
+            PRIMARY KEY (group_id, user_id),
+            FOREIGN KEY (group_id) REFERENCES scim_groups(id) ON DELETE CASCADE,
+            FOREIGN KEY (user_id) REFERENCES users(id)
+        );
+        `,
+		},
+		postgres: []string{
+			`
         CREATE TABLE IF NOT EXISTS users (
             id SERIAL PRIMARY KEY,
             username TEXT UNIQUE NOT NULL,
-            password TEXT NOT NULL
+            password TEXT NOT NULL,
+            email TEXT,
+            display_name TEXT,
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            external_id TEXT UNIQUE,
+            auth_source TEXT,
+            auth_subject TEXT,
+            deleted_at TIMESTAMPTZ,
+            UNIQUE (auth_source, auth_subject)
+        );
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS organizations (
+            id SERIAL PRIMARY KEY,
+            name TEXT NOT NULL,
+            personal_user_id INTEGER UNIQUE REFERENCES users(id),
+            created_at TIMESTAMPTZ NOT NULL
         );
-    `)
-	if err != nil {
-		log.Fatalf("[MIGRATION] failed creating users table (postgres): %v", err)
-	}
-
-	if App.SeedDefaultUser {
-		_, err = DB.Exec(`
-        INSERT INTO users (username, password)
-        VALUES ('admin@local', 'ChangeMe123!')
-        ON CONFLICT (username) DO NOTHING;
-    `)
-		if err != nil {
-			log.Fatalf("[MIGRATION] failed inserting default user (postgres): %v", err)
-		}
-	}
 
-	_, err = DB.Exec(`
+        CREATE TABLE IF NOT EXISTS org_members (
+            id SERIAL PRIMARY KEY,
+            org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            role TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL,
+            UNIQUE (org_id, user_id)
+        );
+        `,
+			`
         CREATE TABLE IF NOT EXISTS workspaces (
             id SERIAL PRIMARY KEY,
+            org_id INTEGER NOT NULL REFERENCES organizations(id),
             name TEXT NOT NULL,
             description TEXT,
             created_by INTEGER NOT NULL REFERENCES users(id),
-            created_at TIMESTAMPTZ DEFAULT now()
+            created_at TIMESTAMPTZ DEFAULT now(),
+            deleted_at TIMESTAMPTZ
         );
-    `)
-	if err != nil {
-		log.Fatalf("[MIGRATION] failed creating workspaces table (postgres): %v", err)
-	}
 
-	log.Println("[MIGRATION] Users and workspaces tables created successfully (postgres)")
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_org_name_live
+            ON workspaces (org_id, name) WHERE deleted_at IS NULL;
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS secrets (
+            id SERIAL PRIMARY KEY,
+            workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+            name TEXT NOT NULL,
+            value TEXT NOT NULL,
+            version INTEGER NOT NULL DEFAULT 1,
+            created_by INTEGER NOT NULL REFERENCES users(id),
+            created_at TIMESTAMPTZ NOT NULL,
+            updated_at TIMESTAMPTZ NOT NULL,
+            UNIQUE (workspace_id, name)
+        );
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS agent_join_tokens (
+            id SERIAL PRIMARY KEY,
+            workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+            token_hash TEXT UNIQUE NOT NULL,
+            created_by INTEGER NOT NULL REFERENCES users(id),
+            created_at TIMESTAMPTZ NOT NULL,
+            expires_at TIMESTAMPTZ NOT NULL,
+            used_at TIMESTAMPTZ
+        );
+
+        CREATE TABLE IF NOT EXISTS agents (
+            id SERIAL PRIMARY KEY,
+            workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+            name TEXT NOT NULL,
+            public_key TEXT UNIQUE NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL,
+            last_seen_at TIMESTAMPTZ,
+            revoked_at TIMESTAMPTZ
+        );
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS webhooks (
+            id SERIAL PRIMARY KEY,
+            workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
+            events TEXT NOT NULL DEFAULT '',
+            secret TEXT NOT NULL,
+            active BOOLEAN NOT NULL DEFAULT true,
+            created_by INTEGER NOT NULL REFERENCES users(id),
+            created_at TIMESTAMPTZ NOT NULL
+        );
+
+        CREATE TABLE IF NOT EXISTS webhook_deliveries (
+            id SERIAL PRIMARY KEY,
+            webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+            event_type TEXT NOT NULL,
+            payload TEXT NOT NULL,
+            status TEXT NOT NULL,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at TIMESTAMPTZ,
+            last_status_code INTEGER NOT NULL DEFAULT 0,
+            last_error TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL,
+            delivered_at TIMESTAMPTZ
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+            ON webhook_deliveries (status, next_attempt_at);
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS events (
+            id BIGSERIAL PRIMARY KEY,
+            workspace_id INTEGER NOT NULL,
+            type TEXT NOT NULL,
+            actor_id INTEGER NOT NULL DEFAULT 0,
+            data TEXT NOT NULL DEFAULT '{}',
+            occurred_at TIMESTAMPTZ NOT NULL
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_events_workspace_id
+            ON events (workspace_id, id);
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS rate_limits (
+            name TEXT PRIMARY KEY,
+            tokens DOUBLE PRECISION NOT NULL DEFAULT 0,
+            failures INTEGER NOT NULL DEFAULT 0,
+            locked_until TIMESTAMPTZ,
+            updated_at TIMESTAMPTZ NOT NULL,
+            version BIGINT NOT NULL
+        );
+        `,
+			`
+        CREATE TABLE IF NOT EXISTS scim_groups (
+            id SERIAL PRIMARY KEY,
+            display_name TEXT UNIQUE NOT NULL,
+            external_id TEXT UNIQUE
+        );
+
+        CREATE TABLE IF NOT EXISTS scim_group_members (
+            group_id INTEGER NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            PRIMARY KEY (group_id, user_id)
+        );
+        `,
+		},
+	},
 }
 
+// migrationFailed logs a failed migration step and exits; the server cannot
+// run on a partial schema.
+func migrationFailed(step, driver string, err error) {
+	slog.Error("migration failed", "step", step, "driver", driver, "err", err)
+	os.Exit(1)
+}
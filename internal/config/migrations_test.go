@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunMigrationsKeepsDataAcrossRestarts(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	DBDriver = "sqlite"
+	DB = db
+
+	RunMigrations()
+	if _, err := DB.Exec(`INSERT INTO users (username, password) VALUES ('kept@example.com', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(`INSERT INTO events (workspace_id, type, occurred_at) VALUES (1, 'secret.updated', datetime('now'))`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second start, as after a restart or rollout, must find everything.
+	RunMigrations()
+
+	var users, events, versions, version int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM users WHERE username = 'kept@example.com'`).Scan(&users); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&events); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&versions, &version); err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 || events != 1 {
+		t.Fatalf("after re-running migrations: %d users, %d events; want 1 and 1", users, events)
+	}
+	if versions != len(migrations) || version != SchemaVersion {
+		t.Fatalf("schema_migrations has %d rows up to version %d, want %d up to %d", versions, version, len(migrations), SchemaVersion)
+	}
+}
+
+func TestCheckMigrationsWantsCurrentSchemaVersion(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	DBDriver = "sqlite"
+	DB = db
+	RunMigrations()
+
+	ctx := context.Background()
+	if err := CheckMigrations(ctx); err != nil {
+		t.Fatalf("check after migrating: %v", err)
+	}
+	if _, err := DB.Exec(`DELETE FROM schema_migrations WHERE version = ?`, SchemaVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckMigrations(ctx); err == nil {
+		t.Fatal("check passed with the current version missing from schema_migrations")
+	}
+}
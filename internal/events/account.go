@@ -0,0 +1,47 @@
+package events
+
+import "time"
+
+// AccountLocked records that a username was locked out after failed logins.
+func (b *Bus) AccountLocked(username string, until time.Time, failures int) {
+	b.Publish(Event{
+		Type: AccountLocked,
+		Data: map[string]any{"username": username, "locked_until": until, "failures": failures},
+	})
+}
+
+// AccountUnlocked records that an admin cleared a username's lockout.
+func (b *Bus) AccountUnlocked(username string, actorID int) {
+	b.Publish(Event{
+		Type:    AccountUnlocked,
+		ActorID: actorID,
+		Data:    map[string]any{"username": username},
+	})
+}
+
+// AccountDeactivated records that the identity provider deactivated a user
+// through SCIM.
+func (b *Bus) AccountDeactivated(username string, userID int) {
+	b.Publish(Event{
+		Type: AccountDeactivated,
+		Data: map[string]any{"username": username, "user_id": userID},
+	})
+}
+
+// AccountReactivated records that the identity provider reactivated a user
+// through SCIM.
+func (b *Bus) AccountReactivated(username string, userID int) {
+	b.Publish(Event{
+		Type: AccountReactivated,
+		Data: map[string]any{"username": username, "user_id": userID},
+	})
+}
+
+// AccountDeleted records that the identity provider deleted a user through
+// SCIM.
+func (b *Bus) AccountDeleted(username string, userID int) {
+	b.Publish(Event{
+		Type: AccountDeleted,
+		Data: map[string]any{"username": username, "user_id": userID},
+	})
+}
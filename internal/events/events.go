@@ -0,0 +1,189 @@
+// Package events is the in-process bus for workspace and secret change events.
+// Publishers never include secret values, only keys and versions.
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	WorkspaceCreated = "workspace.created"
+	WorkspaceUpdated = "workspace.updated"
+	WorkspaceDeleted = "workspace.deleted"
+	// WorkspaceRestored follows WorkspaceDeleted when a workspace is taken
+	// out of the trash; WorkspacePurged when it is removed for good.
+	WorkspaceRestored = "workspace.restored"
+	WorkspacePurged   = "workspace.purged"
+	// WorkspaceTransferred is published when a workspace moves to another
+	// organization.
+	WorkspaceTransferred = "workspace.transferred"
+
+	SecretCreated = "secret.created"
+	SecretUpdated = "secret.updated"
+	SecretDeleted = "secret.deleted"
+	SecretRotated = "secret.rotated"
+
+	// AgentRevoked carries the agent_id; every instance drops the agent's
+	// live connections when it sees it.
+	AgentRevoked = "agent.revoked"
+
+	// Account events are not about a workspace: they are recorded with
+	// WorkspaceID 0 for auditing and are not delivered to webhooks.
+	AccountLocked      = "account.locked"
+	AccountUnlocked    = "account.unlocked"
+	AccountDeactivated = "account.deactivated"
+	AccountReactivated = "account.reactivated"
+	AccountDeleted     = "account.deleted"
+)
+
+// Types lists every event type that can be subscribed to.
+var Types = []string{
+	WorkspaceCreated, WorkspaceUpdated, WorkspaceDeleted, WorkspaceRestored, WorkspacePurged,
+	WorkspaceTransferred,
+	SecretCreated, SecretUpdated, SecretDeleted, SecretRotated,
+	AgentRevoked,
+}
+
+// IsValidType reports whether t is a known event type.
+func IsValidType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event describes a change inside a workspace. ID is assigned when the
+// event is persisted and increases monotonically.
+type Event struct {
+	ID          int64          `json:"id"`
+	Type        string         `json:"type"`
+	WorkspaceID int            `json:"workspace_id"`
+	ActorID     int            `json:"actor_id,omitempty"`
+	Data        map[string]any `json:"data,omitempty"`
+	OccurredAt  time.Time      `json:"occurred_at"`
+}
+
+// watchBuffer is how many events a slow watcher may lag behind before it is dropped.
+const watchBuffer = 64
+
+type watcher struct {
+	workspaceID int
+	ch          chan Event
+}
+
+// Bus persists events and fans them out to subscribers and watchers.
+type Bus struct {
+	store *Repository
+
+	mu       sync.RWMutex
+	subs     []func(Event)
+	watchers map[*watcher]struct{}
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBus returns a bus that persists to store. A nil store keeps events in
+// memory only; they then have no ID and cannot be replayed.
+func NewBus(store *Repository) *Bus {
+	return &Bus{store: store, watchers: make(map[*watcher]struct{}), closing: make(chan struct{})}
+}
+
+// Close tells open streams that the server is shutting down; they say so to
+// their clients and end.
+func (b *Bus) Close() {
+	b.closeOnce.Do(func() { close(b.closing) })
+}
+
+// Closing is closed once Close has been called.
+func (b *Bus) Closing() <-chan struct{} {
+	return b.closing
+}
+
+// Subscribe registers fn to receive every published event, synchronously.
+func (b *Bus) Subscribe(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, fn)
+}
+
+// Watch streams the events of one workspace. The channel is closed when
+// cancel is called or when the watcher falls more than watchBuffer events
+// behind; callers should then resume from the last ID they saw.
+func (b *Bus) Watch(workspaceID int) (<-chan Event, func()) {
+	w := &watcher{workspaceID: workspaceID, ch: make(chan Event, watchBuffer)}
+
+	b.mu.Lock()
+	b.watchers[w] = struct{}{}
+	b.mu.Unlock()
+
+	return w.ch, func() { b.removeWatcher(w) }
+}
+
+func (b *Bus) removeWatcher(w *watcher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.watchers[w]; ok {
+		delete(b.watchers, w)
+		close(w.ch)
+	}
+}
+
+// Since returns persisted events of a workspace after the given ID.
+func (b *Bus) Since(workspaceID int, afterID int64, limit int) ([]Event, error) {
+	if b.store == nil {
+		return nil, nil
+	}
+	return b.store.ListAfter(workspaceID, afterID, limit)
+}
+
+// Publish stamps and persists the event, then delivers it to subscribers
+// and watchers. A panicking subscriber is logged and does not affect the others.
+func (b *Bus) Publish(e Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now().UTC()
+	}
+	// Defence in depth: secret values must never leave through events.
+	delete(e.Data, "value")
+
+	if b.store != nil {
+		if err := b.store.Insert(&e); err != nil {
+			slog.Error("failed to persist event", "type", e.Type, "workspace_id", e.WorkspaceID, "err", err)
+		}
+	}
+
+	b.mu.RLock()
+	subs := b.subs
+	var lagging []*watcher
+	for w := range b.watchers {
+		if w.workspaceID != e.WorkspaceID {
+			continue
+		}
+		select {
+		case w.ch <- e:
+		default:
+			lagging = append(lagging, w)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, w := range lagging {
+		b.removeWatcher(w)
+	}
+
+	for _, fn := range subs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("event subscriber panicked", "type", e.Type, "panic", r)
+				}
+			}()
+			fn(e)
+		}()
+	}
+}
@@ -0,0 +1,213 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/logging"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	// replayLimit caps how many missed events are replayed per batch on resume.
+	replayLimit = 500
+)
+
+// Authorizer decides whether a user may watch a workspace.
+type Authorizer interface {
+	IsMember(ctx context.Context, workspaceID, userID int) (bool, error)
+}
+
+// UserChecker reports whether a user may still use their session.
+type UserChecker interface {
+	IsActive(ctx context.Context, userID int) (bool, error)
+}
+
+type Handler struct {
+	bus   *Bus
+	authz Authorizer
+	users UserChecker
+}
+
+func NewHandler(bus *Bus, authz Authorizer, users UserChecker) *Handler {
+	return &Handler{bus: bus, authz: authz, users: users}
+}
+
+// GET /workspaces/{id}/events (Server-Sent Events stream)
+//
+// Clients resume by sending the last ID they saw in the Last-Event-ID header
+// (EventSource does this automatically) or the last_event_id query parameter.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	wsID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid workspace id"))
+		return
+	}
+	logging.SetWorkspaceID(r.Context(), wsID)
+	userID := auth.GetUserID(r)
+	ok, err := h.authz.IsMember(r.Context(), wsID, userID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !ok {
+		apierror.Write(w, r, apierror.Forbidden("not allowed to watch this workspace"))
+		return
+	}
+
+	lastID, err := lastEventID(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Watch before replaying so nothing published in between is lost;
+	// duplicates are skipped by ID below.
+	live, cancel := h.bus.Watch(wsID)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+
+	if lastID > 0 {
+		for {
+			missed, err := h.bus.Since(wsID, lastID, replayLimit)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "event replay failed", "err", err)
+				return
+			}
+			for _, e := range missed {
+				if err := writeEvent(w, e); err != nil {
+					return
+				}
+				lastID = e.ID
+			}
+			if len(missed) < replayLimit {
+				break
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-h.bus.Closing():
+			// Clients reconnect (to another instance) after the retry delay.
+			fmt.Fprint(w, "event: shutdown\ndata: {\"reason\":\"server shutting down\"}\n\n")
+			rc.Flush()
+			return
+
+		case e, open := <-live:
+			if !open {
+				// Fell too far behind; the client reconnects and replays.
+				return
+			}
+			if e.ID != 0 && e.ID <= lastID {
+				continue
+			}
+			if !h.stillAllowed(w, r, wsID, userID) {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			if e.ID != 0 {
+				lastID = e.ID
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			// Quiet workspaces are re-checked here so a removed member
+			// does not keep an idle stream open.
+			if !h.stillAllowed(w, r, wsID, userID) {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// stillAllowed re-checks, for a stream that is already open, that the user
+// is active and a member of the workspace. Streams outlive the auth check
+// made when they were opened, so without this a user who is removed from
+// the organization or deactivated would keep receiving events. On a
+// negative answer it tells the client why before the stream is closed; the
+// client's reconnect is then refused by the usual checks.
+func (h *Handler) stillAllowed(w http.ResponseWriter, r *http.Request, wsID, userID int) bool {
+	active, err := h.users.IsActive(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "event stream access check failed", "err", err)
+		return false
+	}
+	member := false
+	if active {
+		if member, err = h.authz.IsMember(r.Context(), wsID, userID); err != nil {
+			slog.ErrorContext(r.Context(), "event stream access check failed", "err", err)
+			return false
+		}
+	}
+	if !member {
+		fmt.Fprint(w, "event: revoked\ndata: {\"reason\":\"access to this workspace was revoked\"}\n\n")
+		http.NewResponseController(w).Flush()
+		return false
+	}
+	return true
+}
+
+func lastEventID(r *http.Request) (int64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, apierror.BadRequest("invalid Last-Event-ID")
+	}
+	return id, nil
+}
+
+func writeEvent(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", e.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
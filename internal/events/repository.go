@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+)
+
+// Repository persists published events so streams can resume from an ID.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+type Repository struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+}
+
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
+}
+
+func NewDefaultRepository() *Repository {
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
+}
+
+// Insert stores the event and sets its ID.
+func (r *Repository) Insert(e *Event) error {
+	defer metrics.ObserveDB("events", "Insert")()
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			INSERT INTO events (workspace_id, type, actor_id, data, occurred_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, e.WorkspaceID, e.Type, e.ActorID, string(data), e.OccurredAt)
+		return row.Scan(&e.ID)
+	}
+
+	res, err := r.sqlDB.Exec(`
+		INSERT INTO events (workspace_id, type, actor_id, data, occurred_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, e.WorkspaceID, e.Type, e.ActorID, string(data), e.OccurredAt)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListAfter returns up to limit events of a workspace with an ID greater
+// than afterID, oldest first.
+func (r *Repository) ListAfter(workspaceID int, afterID int64, limit int) ([]Event, error) {
+	defer metrics.ObserveDB("events", "ListAfter")()
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), `
+		SELECT id, workspace_id, type, actor_id, data, occurred_at
+		FROM events WHERE workspace_id = $1 AND id > $2
+		ORDER BY id LIMIT $3
+		`, workspaceID, afterID, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Event
+		for rows.Next() {
+			e, err := scanEvent(rows)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *e)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(`
+		SELECT id, workspace_id, type, actor_id, data, occurred_at
+		FROM events WHERE workspace_id = ? AND id > ?
+		ORDER BY id LIMIT ?
+	`, workspaceID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
+	}
+	return list, rows.Err()
+}
+
+func scanEvent(row interface{ Scan(dest ...any) error }) (*Event, error) {
+	e := &Event{}
+	var data string
+	if err := row.Scan(&e.ID, &e.WorkspaceID, &e.Type, &e.ActorID, &data, &e.OccurredAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &e.Data); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
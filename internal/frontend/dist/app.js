@@ -0,0 +1,196 @@
+// Minimal Secretlane UI: login, workspace list/create/delete and a live
+// change feed per workspace. Talks to the JSON API under /api/v1 using the
+// HttpOnly session cookie.
+
+const API = "/api/v1";
+const app = document.getElementById("app");
+
+class ApiError extends Error {
+  constructor(status, body) {
+    const err = body && body.error;
+    super((err && (err.message || err)) || `request failed (${status})`);
+    this.status = status;
+    this.code = err && err.code;
+    this.body = body;
+  }
+}
+
+// The server sets the session's CSRF token in a readable cookie; it must be
+// echoed in X-CSRF-Token on every state-changing request.
+function csrfToken() {
+  const m = document.cookie.match(/(?:^|;\s*)(?:__Host-|__Secure-)?csrf_token=([^;]*)/);
+  return m ? decodeURIComponent(m[1]) : "";
+}
+
+async function api(method, path, body) {
+  const headers = body ? { "Content-Type": "application/json" } : {};
+  if (method !== "GET") headers["X-CSRF-Token"] = csrfToken();
+  const res = await fetch(API + path, {
+    method,
+    credentials: "same-origin",
+    headers,
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const text = await res.text();
+  let data = null;
+  try { data = text ? JSON.parse(text) : null; } catch { data = { error: { message: text.trim() } }; }
+  if (!res.ok) throw new ApiError(res.status, data);
+  return data;
+}
+
+function h(tag, attrs = {}, ...children) {
+  const el = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs)) {
+    if (k.startsWith("on")) el.addEventListener(k.slice(2), v);
+    else if (v !== false && v != null) el.setAttribute(k, v === true ? "" : v);
+  }
+  for (const c of children.flat()) el.append(c instanceof Node ? c : String(c));
+  return el;
+}
+
+function navigate(path) {
+  history.pushState(null, "", path);
+  route();
+}
+
+function setUser(name) {
+  if (name) sessionStorage.setItem("username", name);
+  else sessionStorage.removeItem("username");
+  document.getElementById("nav").hidden = !name;
+  document.getElementById("whoami").textContent = name || "";
+}
+
+// Views
+
+function loginView() {
+  const error = h("p", { class: "error" });
+  const form = h("form", {
+    onsubmit: async (e) => {
+      e.preventDefault();
+      error.textContent = "";
+      const fd = new FormData(form);
+      try {
+        const res = await api("POST", "/login", {
+          username: fd.get("username"),
+          password: fd.get("password"),
+        });
+        setUser(res.username);
+        navigate("/");
+      } catch (err) {
+        error.textContent = err.message;
+      }
+    },
+  },
+    h("label", {}, "Username", h("input", { name: "username", autocomplete: "username", required: true })),
+    h("label", {}, "Password", h("input", { name: "password", type: "password", autocomplete: "current-password", required: true })),
+    error,
+    h("button", { type: "submit" }, "Log in"),
+  );
+  return h("section", { class: "card" }, h("h2", {}, "Log in"), form);
+}
+
+async function workspacesView() {
+  const list = await api("GET", "/workspaces");
+  const items = Array.isArray(list) ? list : (list && list.items) || [];
+  const error = h("p", { class: "error" });
+
+  const form = h("form", {
+    class: "inline",
+    onsubmit: async (e) => {
+      e.preventDefault();
+      error.textContent = "";
+      const fd = new FormData(form);
+      try {
+        await api("POST", "/workspaces", { name: fd.get("name"), description: fd.get("description") });
+        route();
+      } catch (err) {
+        error.textContent = err.message;
+      }
+    },
+  },
+    h("label", {}, "Name", h("input", { name: "name", required: true })),
+    h("label", {}, "Description", h("input", { name: "description" })),
+    h("button", { type: "submit" }, "Create"),
+  );
+
+  const rows = items.map((ws) => h("tr", {},
+    h("td", {}, h("a", { href: `/workspaces/${ws.id}`, onclick: (e) => { e.preventDefault(); navigate(`/workspaces/${ws.id}`); } }, ws.name)),
+    h("td", { class: "muted" }, ws.description || ""),
+    h("td", {}, h("button", {
+      class: "danger",
+      onclick: async () => {
+        if (!confirm(`Delete workspace "${ws.name}"?`)) return;
+        try { await api("DELETE", `/workspaces/${ws.id}`); route(); } catch (err) { error.textContent = err.message; }
+      },
+    }, "Delete")),
+  ));
+
+  return h("div", {},
+    h("section", { class: "card" }, h("h2", {}, "New workspace"), form, error),
+    h("section", { class: "card" },
+      h("h2", {}, "Workspaces"),
+      items.length
+        ? h("table", {}, h("thead", {}, h("tr", {}, h("th", {}, "Name"), h("th", {}, "Description"), h("th", {}))), h("tbody", {}, rows))
+        : h("p", { class: "muted" }, "No workspaces yet."),
+    ),
+  );
+}
+
+let feed = null;
+
+function workspaceView(id) {
+  const log = h("tbody");
+  feed = new EventSource(`${API}/workspaces/${id}/events`, { withCredentials: true });
+  const onEvent = (e) => {
+    const ev = JSON.parse(e.data);
+    log.prepend(h("tr", {},
+      h("td", { class: "muted" }, new Date(ev.occurred_at).toLocaleString()),
+      h("td", {}, ev.type),
+      h("td", {}, ev.data ? JSON.stringify(ev.data) : ""),
+    ));
+  };
+  feed.onmessage = onEvent;
+  for (const t of ["workspace.created", "workspace.updated", "workspace.deleted",
+    "secret.created", "secret.updated", "secret.deleted", "secret.rotated"]) {
+    feed.addEventListener(t, onEvent);
+  }
+
+  return h("section", { class: "card" },
+    h("p", {}, h("a", { href: "/", onclick: (e) => { e.preventDefault(); navigate("/"); } }, "← Workspaces")),
+    h("h2", {}, `Workspace ${id}: live changes`),
+    h("table", {}, h("thead", {}, h("tr", {}, h("th", {}, "When"), h("th", {}, "Event"), h("th", {}, "Details"))), log),
+  );
+}
+
+// Router
+
+async function route() {
+  if (feed) { feed.close(); feed = null; }
+  const path = location.pathname;
+  app.replaceChildren();
+
+  if (path === "/login") {
+    app.append(loginView());
+    return;
+  }
+
+  try {
+    const m = path.match(/^\/workspaces\/(\d+)$/);
+    app.append(m ? workspaceView(m[1]) : await workspacesView());
+    setUser(sessionStorage.getItem("username") || " ");
+  } catch (err) {
+    if (err.status === 401) {
+      setUser(null);
+      navigate("/login");
+      return;
+    }
+    app.append(h("p", { class: "error" }, err.message));
+  }
+}
+
+document.getElementById("logout").addEventListener("click", async () => {
+  try { await api("POST", "/logout"); } finally { setUser(null); navigate("/login"); }
+});
+
+window.addEventListener("popstate", route);
+route();
@@ -0,0 +1,108 @@
+// Package frontend serves the embedded single-page app from dist/.
+//
+// Replace dist/ with the output of the frontend build. Files under
+// dist/assets/ must have content-hashed names: they are served as immutable.
+package frontend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+)
+
+//go:embed dist
+var dist embed.FS
+
+const (
+	indexFile      = "index.html"
+	immutableCache = "public, max-age=31536000, immutable"
+	revalidate     = "no-cache"
+)
+
+type file struct {
+	data []byte
+	etag string
+}
+
+// Handler serves static files with SPA fallback to index.html. Requests
+// under apiPrefix that reach it never fall back; they get a JSON 404.
+type Handler struct {
+	apiPrefix string
+	files     map[string]file
+}
+
+// NewHandler loads the embedded build into memory and computes ETags.
+func NewHandler(apiPrefix string) (*Handler, error) {
+	root, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Handler{apiPrefix: apiPrefix, files: make(map[string]file)}
+	err = fs.WalkDir(root, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(root, p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		h.files[p] = file{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h.files[indexFile]; !ok {
+		return nil, fs.ErrNotExist
+	}
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, h.apiPrefix+"/") || r.URL.Path == h.apiPrefix {
+		apierror.Write(w, r, apierror.NotFound("no such API route"))
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		apierror.Write(w, r, apierror.MethodNotAllowed(http.MethodGet, http.MethodHead))
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+
+	f, ok := h.files[name]
+	if !ok {
+		// Client-side routes have no extension; missing assets stay 404.
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = indexFile
+		f = h.files[indexFile]
+	}
+
+	if strings.HasPrefix(name, "assets/") {
+		w.Header().Set("Cache-Control", immutableCache)
+	} else {
+		w.Header().Set("Cache-Control", revalidate)
+	}
+	w.Header().Set("ETag", f.etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent picks the Content-Type from the extension, sniffing the
+	// content when the extension is unknown, and answers If-None-Match.
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(f.data))
+}
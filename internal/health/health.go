@@ -0,0 +1,133 @@
+// Package health serves the liveness and readiness probes. Liveness only
+// says the process is up; readiness runs dependency checks, so that
+// orchestrators stop routing to an instance whose database is gone.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds each readiness check.
+const checkTimeout = 2 * time.Second
+
+// Statuses of a readiness report.
+const (
+	StatusReady       = "ready"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// Check is one dependency probe. A failing critical check makes the
+// instance unavailable; a failing non-critical one only degrades it.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"` // "ok" or "fail"
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness response.
+type Report struct {
+	Status    string   `json:"status"`
+	Checks    []Result `json:"checks"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// Liveness is the liveness response.
+type Liveness struct {
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp"`
+}
+
+type Checker struct {
+	checks []Check
+}
+
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Ready runs every check concurrently and reports the combined status.
+func (c *Checker) Ready(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	status := StatusReady
+	for _, r := range results {
+		if r.Status == "ok" {
+			continue
+		}
+		if r.Critical {
+			status = StatusUnavailable
+			break
+		}
+		status = StatusDegraded
+	}
+	return Report{Status: status, Checks: results, Timestamp: now()}
+}
+
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	r := Result{
+		Name:      check.Name,
+		Status:    "ok",
+		Critical:  check.Critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		r.Status = "fail"
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Livez answers 200 while the process can serve requests at all.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Liveness{Status: "healthy", Timestamp: now()})
+}
+
+// Readyz answers 200 when ready or degraded and 503 when a critical check
+// fails.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := c.Ready(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
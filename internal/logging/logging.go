@@ -0,0 +1,121 @@
+// Package logging sets up log/slog for the server: JSON or text output at a
+// configured level, correlation fields taken from the request context, and
+// redaction of credentials and secret values in every record.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/requestid"
+)
+
+// Setup installs the configured handler as the slog default. The standard
+// log package then writes through it too.
+func Setup(cfg config.LoggingConfig) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid logging.level %q (want debug, info, warn or error)", cfg.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid logging.format %q (want json or text)", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(New(h)))
+	return nil
+}
+
+// New wraps h so that records get the request's correlation fields and are
+// redacted before h sees them.
+func New(h slog.Handler) slog.Handler {
+	return contextHandler{Handler: redactHandler{Handler: h}}
+}
+
+// Fatal logs msg at error level and exits, for startup failures.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type fieldsKey struct{}
+
+// fields are the correlation fields of one request. They are filled in as
+// the request is handled, so the context holds a pointer that middleware
+// further in can update for the access log written at the end.
+type fields struct {
+	mu          sync.Mutex
+	userID      int
+	workspaceID int
+}
+
+// NewContext returns ctx with empty correlation fields.
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{})
+}
+
+// SetUserID records the authenticated user for the request's log lines.
+func SetUserID(ctx context.Context, id int) {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.userID = id
+		f.mu.Unlock()
+	}
+}
+
+// SetWorkspaceID records the workspace the request acts on.
+func SetWorkspaceID(ctx context.Context, id int) {
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.workspaceID = id
+		f.mu.Unlock()
+	}
+}
+
+// contextHandler adds the request ID and correlation fields to records
+// logged with a request context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	if f, ok := ctx.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		if f.userID != 0 {
+			r.AddAttrs(slog.Int("user_id", f.userID))
+		}
+		if f.workspaceID != 0 {
+			r.AddAttrs(slog.Int("workspace_id", f.workspaceID))
+		}
+		f.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
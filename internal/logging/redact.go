@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must not be logged.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys mark attributes whose values are never logged. A key matches
+// if it contains one of them, ignoring case, so "password", "new_password"
+// and "X-CSRF-Token" all do.
+var sensitiveKeys = []string{
+	"password", "secret", "token", "authorization", "cookie",
+	"private_key", "signature", "value",
+}
+
+// sensitivePatterns find credentials inside free text: messages, string
+// values and errors.
+var sensitivePatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// PEM private keys, e.g. the agent identity key.
+	{regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), Redacted},
+	// JWTs such as session tokens.
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Redacted},
+	// Agent join tokens and webhook signing secrets.
+	{regexp.MustCompile(`\b(slj|whsec)_[A-Za-z0-9_-]+`), Redacted},
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[^\s"',]+`), "$1 " + Redacted},
+	// key=value and "key": "value" forms, which includes structs printed
+	// with %+v such as {Name:DB_PASSWORD Value:...}.
+	{regexp.MustCompile(`(?i)([a-z_-]*(?:password|secret|token|value)[a-z_-]*["']?\s*[:=]\s*["']?)[^\s"'&,;}\]]+`), "${1}" + Redacted},
+}
+
+// redactHandler scrubs every record before passing it on.
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactHandler{Handler: h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// RedactString removes credentials found in s.
+func RedactString(s string) string {
+	for _, p := range sensitivePatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]any, len(group))
+		for i, g := range group {
+			redacted[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		// Structs, maps and errors are flattened to text so that fields
+		// such as Password are caught by the patterns above.
+		v := a.Value.Any()
+		if err, ok := v.(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+		return slog.String(a.Key, RedactString(fmt.Sprintf("%+v", v)))
+	}
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+// Package metrics defines the server's Prometheus metrics and serves them.
+package metrics
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// Registry holds every metric of the server, plus the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	dbBuckets   = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+)
+
+var (
+	HTTPRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "secretlane_http_requests_total",
+		Help: "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "secretlane_http_request_duration_seconds",
+		Help:    "HTTP request latency by route and status.",
+		Buckets: httpBuckets,
+	}, []string{"method", "route", "status"})
+	DBQueryDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "secretlane_db_query_duration_seconds",
+		Help:    "Latency of repository methods.",
+		Buckets: dbBuckets,
+	}, []string{"repository", "method"})
+	AuthAttempts = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "secretlane_auth_attempts_total",
+		Help: "Password logins by result: success, failure or locked.",
+	}, []string{"result"})
+	SecretReads = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "secretlane_secret_reads_total",
+		Help: "Secrets handed to agents by workspace; workspaces not listed in metrics.secret_read_workspaces count as \"other\".",
+	}, []string{"workspace"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// NewGaugeFunc registers a gauge whose value is read when metrics are
+// scraped.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+// ObserveDB starts timing a repository method; call the returned func when
+// it returns:
+//
+//	defer metrics.ObserveDB("workspace", "FindByID")()
+func ObserveDB(repository, method string) func() {
+	start := time.Now()
+	return func() {
+		DBQueryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// SecretRead counts n secrets read from a workspace.
+func SecretRead(workspaceID, n int) {
+	label := "other"
+	if slices.Contains(config.Metrics.SecretReadWorkspaces, workspaceID) {
+		label = strconv.Itoa(workspaceID)
+	}
+	SecretReads.WithLabelValues(label).Add(float64(n))
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/middleware"
+)
+
+// Middleware counts and times requests by method, route pattern and status.
+// It must wrap the router directly, since the route is read from r.Pattern
+// once the mux has matched it. Requests no route matched are labelled
+// "unmatched" so that arbitrary paths can't add series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := middleware.Route(r)
+		status := strconv.Itoa(rec.Status())
+		HTTPRequests.WithLabelValues(r.Method, route, status).Inc()
+		HTTPDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
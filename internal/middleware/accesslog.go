@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
+)
+
+// AccessLog logs one line per request once it is done. It also gives the
+// request the correlation fields that handlers fill in, so it must run
+// inside requestid.Middleware and outside the authentication middleware.
+// The query string is left out, since it may carry tokens.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := NewRecorder(w)
+		inner := r.WithContext(logging.NewContext(r.Context()))
+		next.ServeHTTP(rec, inner)
+		// The router records the matched route on the request it was given;
+		// pass it back out for Tracing.
+		r.Pattern = inner.Pattern
+		r = inner
+
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", Route(r)),
+			slog.Int("status", rec.Status()),
+			slog.Int("bytes", rec.Bytes()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_ip", ratelimit.ClientIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
@@ -1,25 +1,115 @@
 package middleware
 
-import "net/http"
-
-func CORS(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        origin := r.Header.Get("Origin")
-
-        // Allow only your frontend
-        if origin == "http://localhost:3000" {
-            w.Header().Set("Access-Control-Allow-Origin", origin)
-            w.Header().Set("Access-Control-Allow-Credentials", "true")
-            w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-            w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-        }
-
-        // Handle preflight OPTIONS request
-        if r.Method == http.MethodOptions {
-            w.WriteHeader(http.StatusNoContent)
-            return
-        }
-
-        next.ServeHTTP(w, r)
-    })
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// CORS applies the cross-origin policy in cfg. Requests from origins it does
+// not allow get no CORS headers, and their preflights are refused with 403.
+//
+// Origins are matched exactly, against "*", or against a wildcard subdomain
+// pattern such as "https://*.example.com", which matches any subdomain (but
+// not example.com itself) over https on the default port.
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	credentials := cfg.AllowCredentials != nil && *cfg.AllowCredentials
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if !OriginAllowed(cfg.AllowedOrigins, origin) {
+				if preflight {
+					apierror.Write(w, r, apierror.Forbidden("origin not allowed"))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// "*" is answered as "*", which browsers never combine with
+			// credentials; config.LoadAppConfig refuses the pairing, and it
+			// is not honoured here either.
+			if slices.Contains(cfg.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if credentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !containsFold(cfg.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+				apierror.Write(w, r, apierror.Forbidden("method not allowed by CORS policy"))
+				return
+			}
+			for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				if h = strings.TrimSpace(h); h != "" && !containsFold(cfg.AllowedHeaders, h) {
+					apierror.Write(w, r, apierror.Forbidden("header "+h+" not allowed by CORS policy"))
+					return
+				}
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAgeSeconds > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSeconds))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// OriginAllowed reports whether origin matches one of the CORS patterns.
+func OriginAllowed(patterns []string, origin string) bool {
+	for _, p := range patterns {
+		if p == "*" || strings.EqualFold(p, origin) {
+			return true
+		}
+		scheme, domain, ok := strings.Cut(p, "://*.")
+		if !ok {
+			continue
+		}
+		prefix, suffix := scheme+"://", "."+domain
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.EqualFold(origin[:len(prefix)], prefix) &&
+			strings.EqualFold(origin[len(origin)-len(suffix):], suffix) &&
+			!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
 }
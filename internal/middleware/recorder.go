@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Recorder records the status and size of a response. Unwrap keeps flushing
+// and hijacking (event streams, agent websockets) working through it.
+type Recorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+func (w *Recorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *Recorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *Recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status is the response status, 200 if nothing set it.
+func (w *Recorder) Status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// Bytes is the size of the body written so far.
+func (w *Recorder) Bytes() int {
+	return w.bytes
+}
+
+// Route is the pattern the router matched for r, without its method, or
+// "unmatched". It is only known once the router has seen r.
+func Route(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+	_, path, _ := strings.Cut(r.Pattern, " ")
+	return path
+}
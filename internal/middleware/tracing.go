@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+// Tracing starts a server span for each request, continuing the trace in
+// an incoming W3C traceparent header, and names it after the matched route.
+// It must run outside AccessLog so that access log lines carry the trace.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer)
+		if !span.IsRecording() {
+			span.End()
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		defer span.End()
+
+		rec := NewRecorder(w)
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		route := Route(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("url.path", r.URL.Path),
+			attribute.Int("http.response.status_code", rec.Status()),
+		)
+		if rec.Status() >= http.StatusInternalServerError {
+			tracing.SetError(span, errors.New(http.StatusText(rec.Status())))
+		}
+	})
+}
@@ -0,0 +1,242 @@
+// Package openapi builds an OpenAPI 3.1 document from the router's route
+// table. Schemas are derived by reflection from the sample request and
+// response values attached to each route, so the spec follows the Go types.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/router"
+)
+
+// AuthMiddleware is the route-table name of the session middleware; routes
+// using it are documented as requiring authentication.
+const AuthMiddleware = "auth"
+
+// Message is the shape of the plain {"message": "..."} responses.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Info is the document's info object.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+var pathParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\.*\}`)
+
+// Build describes routes. Every route must document at least one response;
+// otherwise Build fails, naming the routes, so an undocumented endpoint
+// cannot ship silently.
+func Build(info Info, routes []router.Route) (*Document, error) {
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]*SecurityScheme{
+				"cookieAuth": {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        "token",
+					Description: "Session JWT set by /signup and /login.",
+				},
+				"bearerAuth": {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description:  "The token returned by /signup and /login with ?token=true.",
+				},
+			},
+		},
+	}
+	schemas := newRegistry(doc.Components.Schemas)
+	errorRef := schemas.of(apierror.Envelope{})
+
+	var undocumented []string
+	for _, rt := range routes {
+		if len(rt.Responses) == 0 {
+			undocumented = append(undocumented, rt.Method+" "+rt.Path)
+			continue
+		}
+
+		op := &Operation{
+			OperationID: operationID(rt),
+			Summary:     rt.Summary,
+			Tags:        []string{tag(rt.Path)},
+			Responses:   make(map[string]*Response),
+		}
+
+		for _, m := range pathParam.FindAllStringSubmatch(rt.Path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:     m[1],
+				In:       "path",
+				Required: true,
+				Schema:   paramSchema(m[1]),
+			})
+		}
+		for _, p := range rt.Params {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        p.Name,
+				In:          p.In,
+				Description: p.Description,
+				Required:    p.Required,
+				Schema:      &Schema{Type: "string"},
+			})
+		}
+
+		if rt.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{"application/json": {Schema: schemas.of(rt.Request)}},
+			}
+		}
+
+		contentType := rt.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		for status, sample := range rt.Responses {
+			resp := &Response{Description: http.StatusText(status)}
+			if sample != nil {
+				resp.Content = map[string]*MediaType{contentType: {Schema: schemas.of(sample)}}
+			}
+			op.Responses[strconv.Itoa(status)] = resp
+		}
+		op.Responses["default"] = &Response{
+			Description: "Error",
+			Content:     map[string]*MediaType{"application/json": {Schema: errorRef}},
+		}
+
+		if rt.Uses(AuthMiddleware) {
+			op.Security = []map[string][]string{{"cookieAuth": {}}, {"bearerAuth": {}}}
+		}
+
+		path := pathParam.ReplaceAllString(rt.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	if len(undocumented) > 0 {
+		return nil, errors.New("openapi: routes without documented responses: " + strings.Join(undocumented, ", "))
+	}
+	return doc, nil
+}
+
+// Handler serves the document as JSON. It is encoded once up front.
+func Handler(doc *Document) (http.HandlerFunc, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: encode document: %w", err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}, nil
+}
+
+// paramSchema assumes numeric IDs for parameters named like "id" or "deliveryID".
+func paramSchema(name string) *Schema {
+	if strings.HasSuffix(strings.ToLower(name), "id") {
+		return &Schema{Type: "integer"}
+	}
+	return &Schema{Type: "string"}
+}
+
+// operationID turns "PUT /api/v1/workspaces/{id}" into "putWorkspacesById".
+func operationID(rt router.Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.Method))
+	for _, seg := range strings.Split(trimVersion(rt.Path), "/") {
+		if seg == "" {
+			continue
+		}
+		if m := pathParam.FindStringSubmatch(seg); m != nil {
+			b.WriteString("By")
+			seg = m[1]
+		}
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// tag groups operations by the first path segment after the version.
+func tag(path string) string {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(trimVersion(path), "/"), "/")
+	return seg
+}
+
+func trimVersion(path string) string {
+	parts := strings.SplitN(path, "/", 4) // "", "api", "v1", rest
+	if len(parts) == 4 && parts[1] == "api" {
+		return "/" + parts[3]
+	}
+	return path
+}
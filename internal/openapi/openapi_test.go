@@ -0,0 +1,151 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/agent"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/health"
+	"github.com/amartya2002/secretlane/internal/openapi"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
+	"github.com/amartya2002/secretlane/internal/router"
+	"github.com/amartya2002/secretlane/internal/routes"
+	"github.com/amartya2002/secretlane/internal/secret"
+	"github.com/amartya2002/secretlane/internal/webhook"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+// setupRoutes builds the route table as main does, with the optional SSO
+// and SCIM routes switched on so that they are covered too.
+func setupRoutes(t *testing.T) *router.Router {
+	t.Helper()
+	configtest.SQLite(t)
+
+	config.App.EnableFrontend = false
+	config.OIDC = config.OIDCConfig{
+		Issuer:      "https://idp.example.com",
+		ClientID:    "secretlane",
+		RedirectURL: "https://secretlane.example.com/api/v1/auth/oidc/callback",
+	}
+	config.SCIM = config.SCIMConfig{Token: strings.Repeat("t", 32)}
+	t.Cleanup(func() {
+		config.OIDC = config.OIDCConfig{}
+		config.SCIM = config.SCIMConfig{}
+	})
+
+	bus := events.NewBus(nil)
+	store := ratelimit.NewMemoryStore()
+	orgs := org.NewService()
+	authService := auth.NewAuthService(ratelimit.NewLockout(store, 5, time.Minute, time.Hour), bus, orgs,
+		[]auth.Authenticator{auth.NewLocalAuthenticator()})
+	workspaces := workspace.NewService(orgs, bus)
+	webhooks, err := webhook.NewService(workspaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := router.New()
+	routes.SetupRoutes(rt, authService, ratelimit.NewLimiter(store, 10, 5), orgs, workspaces,
+		secret.NewService(workspaces, bus), agent.NewService(workspaces, bus), webhooks, bus, health.NewChecker())
+	return rt
+}
+
+var wildcard = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\.\.\.\}`)
+
+// specPath is how the document writes a route pattern: wildcards such as
+// {path...} lose their dots.
+func specPath(pattern string) string {
+	return wildcard.ReplaceAllString(pattern, "{$1}")
+}
+
+// TestSpecCoversRoutes checks the document served at /api/v1/openapi.json
+// against the route table: every registered method and path is described,
+// nothing else is, and authenticated routes declare their security.
+func TestSpecCoversRoutes(t *testing.T) {
+	rt := setupRoutes(t)
+
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json = %d: %s", rec.Code, rec.Body)
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, want 3.1.0", doc.OpenAPI)
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range rt.Routes() {
+		path := specPath(route.Path)
+		key := route.Method + " " + path
+		registered[key] = true
+
+		op := doc.Paths[path][strings.ToLower(route.Method)]
+		if op == nil {
+			t.Errorf("%s is registered but missing from the spec", key)
+			continue
+		}
+		if len(op.Responses) < 2 {
+			t.Errorf("%s documents no success response", key)
+		}
+		if got, want := len(op.Security) > 0, route.Uses(openapi.AuthMiddleware); got != want {
+			t.Errorf("%s: security declared = %v, route requires auth = %v", key, got, want)
+		}
+		for _, name := range pathParams(path) {
+			if !hasPathParam(op, name) {
+				t.Errorf("%s: path parameter %q is not documented", key, name)
+			}
+		}
+	}
+	for _, want := range []string{
+		"POST /api/v1/login",
+		"GET /api/v1/auth/oidc/callback",
+		"PUT /api/v1/workspaces/{id}/secrets/{name}",
+		"GET /scim/v2/Users",
+	} {
+		if !registered[want] {
+			t.Errorf("route table has no %s; is the test wiring out of date?", want)
+		}
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			key := strings.ToUpper(method) + " " + path
+			if !registered[key] {
+				t.Errorf("spec describes %s, which is not registered", key)
+			}
+		}
+	}
+}
+
+var pathParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func pathParams(path string) []string {
+	var names []string
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+func hasPathParam(op *openapi.Operation, name string) bool {
+	for _, p := range op.Parameters {
+		if p.In == "path" && p.Name == name {
+			return true
+		}
+	}
+	return false
+}
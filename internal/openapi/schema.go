@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema (2020-12, as used by OpenAPI 3.1)
+// that Go types map onto.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// registry turns Go types into schemas, placing named structs under
+// components/schemas and referring to them by $ref.
+type registry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newRegistry(schemas map[string]*Schema) *registry {
+	return &registry{schemas: schemas, names: make(map[reflect.Type]string)}
+}
+
+func (reg *registry) of(sample any) *Schema {
+	return reg.schema(reflect.TypeOf(sample))
+}
+
+func (reg *registry) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		return &Schema{Ref: "#/components/schemas/" + reg.define(t)}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := &Schema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			s.Format = "int64"
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: reg.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: reg.schema(t.Elem())}
+	case reflect.Struct:
+		return reg.object(t)
+	default:
+		// interface{} and anything else: any JSON value.
+		return &Schema{}
+	}
+}
+
+// define registers a named struct once and returns its component name.
+// Types from different packages that share a name get a package prefix.
+func (reg *registry) define(t reflect.Type) string {
+	if name, ok := reg.names[t]; ok {
+		return name
+	}
+	name := componentName(t)
+	if _, taken := reg.schemas[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	reg.names[t] = name
+	reg.schemas[name] = &Schema{} // placeholder for recursive types
+	*reg.schemas[name] = *reg.object(t)
+	return name
+}
+
+func (reg *registry) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	reg.fields(t, s)
+	return s
+}
+
+func (reg *registry) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tagValue := f.Tag.Get("json")
+		if tagValue == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tagValue, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				reg.fields(ft, s)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = reg.schema(f.Type)
+		optional := strings.Contains(opts, "omitempty") || strings.Contains(opts, "omitzero") || f.Type.Kind() == reflect.Pointer
+		if !optional {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// componentName names generic instances after their type argument, so
+// Page[workspace.Workspace] becomes "WorkspacePage".
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	base, arg, ok := strings.Cut(name, "[")
+	if !ok {
+		return name
+	}
+	arg = strings.TrimSuffix(arg, "]")
+	arg = arg[strings.LastIndex(arg, ".")+1:]
+	return arg + base
+}
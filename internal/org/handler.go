@@ -0,0 +1,161 @@
+package org
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{service: s}
+}
+
+// POST /orgs
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var body CreateRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	o, err := h.service.Create(body.Name, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, o)
+}
+
+// GET /orgs?limit=&cursor=&sort=&name=
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	p, err := pagination.Parse(r, Sorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.ListForUser(auth.GetUserID(r), p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GET /orgs/{id}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid organization id")
+	if !ok {
+		return
+	}
+
+	o, err := h.service.Get(id, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+// GET /orgs/{id}/members?limit=&cursor=&sort=&name=
+func (h *Handler) Members(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid organization id")
+	if !ok {
+		return
+	}
+	p, err := pagination.Parse(r, MemberSorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.Members(id, auth.GetUserID(r), p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// POST /orgs/{id}/members
+func (h *Handler) AddMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid organization id")
+	if !ok {
+		return
+	}
+	var body AddMemberRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := h.service.AddMember(id, body.Username, body.Role, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"message": "member added"})
+}
+
+// PUT /orgs/{id}/members/{userID}
+func (h *Handler) SetRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid organization id")
+	if !ok {
+		return
+	}
+	memberID, ok := pathID(w, r, "userID", "invalid user id")
+	if !ok {
+		return
+	}
+	var body RoleRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := h.service.SetRole(id, memberID, body.Role, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "member role updated"})
+}
+
+// DELETE /orgs/{id}/members/{userID}
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid organization id")
+	if !ok {
+		return
+	}
+	memberID, ok := pathID(w, r, "userID", "invalid user id")
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(id, memberID, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "member removed"})
+}
+
+func pathID(w http.ResponseWriter, r *http.Request, name, msg string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(msg))
+		return 0, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
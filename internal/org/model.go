@@ -0,0 +1,49 @@
+package org
+
+import "time"
+
+// Member roles. Owners manage membership and may transfer or purge the
+// organization's workspaces; members may use and edit them.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+// Organization owns workspaces. Every user has a personal organization,
+// created on first use, that holds the workspaces they create without
+// naming one; shared organizations have any number of members.
+type Organization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Personal is set on a user's personal organization, which cannot
+	// have other members.
+	Personal  bool      `json:"personal"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the requesting user's role in the organization.
+	Role string `json:"role,omitempty"`
+}
+
+// Member is a user's membership in an organization.
+type Member struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateRequest is the body for creating an organization.
+type CreateRequest struct {
+	Name string `json:"name"`
+}
+
+// AddMemberRequest adds a user by username; Role defaults to member.
+type AddMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// RoleRequest changes a member's role.
+type RoleRequest struct {
+	Role string `json:"role"`
+}
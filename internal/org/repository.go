@@ -0,0 +1,292 @@
+package org
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+// Repository encapsulates all DB operations for organizations and their members.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+// Queries are written with $N placeholders, which both drivers accept.
+type Repository struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+}
+
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
+}
+
+func NewDefaultRepository() *Repository {
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
+}
+
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const orgColumns = `id, name, personal_user_id IS NOT NULL, created_at`
+
+func scanOrg(row rowScanner) (*Organization, error) {
+	o := &Organization{}
+	if err := row.Scan(&o.ID, &o.Name, &o.Personal, &o.CreatedAt); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Create inserts an organization with ownerID as its first owner.
+// personalUserID marks it as that user's personal organization; 0 makes a
+// shared one.
+func (r *Repository) Create(name string, personalUserID, ownerID int, now time.Time) (*Organization, error) {
+	defer metrics.ObserveDB("org", "Create")()
+	var personal any
+	if personalUserID != 0 {
+		personal = personalUserID
+	}
+
+	o := &Organization{Name: name, Personal: personalUserID != 0, CreatedAt: now, Role: RoleOwner}
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			INSERT INTO organizations (name, personal_user_id, created_at)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, name, personal, now)
+		if err := row.Scan(&o.ID); err != nil {
+			return nil, err
+		}
+	} else {
+		res, err := r.sqlDB.Exec(`
+			INSERT INTO organizations (name, personal_user_id, created_at)
+			VALUES (?, ?, ?)
+		`, name, personal, now)
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		o.ID = int(id)
+	}
+
+	if err := r.AddMember(o.ID, ownerID, RoleOwner, now); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// FindByID returns the organization with the given ID, or nil if it does not exist.
+func (r *Repository) FindByID(id int) (*Organization, error) {
+	defer metrics.ObserveDB("org", "FindByID")()
+	o, err := scanOrg(r.queryRow(`SELECT `+orgColumns+` FROM organizations WHERE id = $1`, id))
+	if isNoRows(err) {
+		return nil, nil
+	}
+	return o, err
+}
+
+// FindPersonal returns the user's personal organization, or nil if it has
+// not been created yet.
+func (r *Repository) FindPersonal(userID int) (*Organization, error) {
+	defer metrics.ObserveDB("org", "FindPersonal")()
+	o, err := scanOrg(r.queryRow(`SELECT `+orgColumns+` FROM organizations WHERE personal_user_id = $1`, userID))
+	if isNoRows(err) {
+		return nil, nil
+	}
+	return o, err
+}
+
+// ListForUser returns one page of the organizations the user belongs to,
+// with the user's role, plus one extra row if there are more (see
+// pagination.NewPage).
+func (r *Repository) ListForUser(userID int, p pagination.Params) ([]Organization, error) {
+	defer metrics.ObserveDB("org", "ListForUser")()
+	where, tail, args := p.Query([]any{userID}, "name")
+	return r.queryOrgs(`
+		SELECT id, name, personal, created_at, role FROM (
+			SELECT o.id, o.name, o.personal_user_id IS NOT NULL AS personal, o.created_at, m.role
+			FROM organizations o JOIN org_members m ON m.org_id = o.id
+			WHERE m.user_id = $1
+		) orgs WHERE 1 = 1`+where+tail, args...)
+}
+
+func (r *Repository) queryOrgs(query string, args ...any) ([]Organization, error) {
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Organization
+		for rows.Next() {
+			var o Organization
+			if err := rows.Scan(&o.ID, &o.Name, &o.Personal, &o.CreatedAt, &o.Role); err != nil {
+				return nil, err
+			}
+			list = append(list, o)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Organization
+	for rows.Next() {
+		var o Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.Personal, &o.CreatedAt, &o.Role); err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// Role returns the user's role in the organization, or "" if they are not
+// a member.
+func (r *Repository) Role(orgID, userID int) (string, error) {
+	defer metrics.ObserveDB("org", "Role")()
+	var role string
+	err := r.queryRow(`SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID).Scan(&role)
+	if isNoRows(err) {
+		return "", nil
+	}
+	return role, err
+}
+
+// ListMembers returns one page of an organization's members, plus one extra
+// row if there are more (see pagination.NewPage).
+func (r *Repository) ListMembers(orgID int, p pagination.Params) ([]Member, error) {
+	defer metrics.ObserveDB("org", "ListMembers")()
+	where, tail, args := p.Query([]any{orgID}, "username")
+	return r.queryMembers(`
+		SELECT id, user_id, username, role, created_at FROM (
+			SELECT m.id, m.user_id, u.username, m.role, m.created_at
+			FROM org_members m JOIN users u ON u.id = m.user_id
+			WHERE m.org_id = $1
+		) members WHERE 1 = 1`+where+tail, args...)
+}
+
+func (r *Repository) queryMembers(query string, args ...any) ([]Member, error) {
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Member
+		for rows.Next() {
+			var m Member
+			if err := rows.Scan(&m.ID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+				return nil, err
+			}
+			list = append(list, m)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Username, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) AddMember(orgID, userID int, role string, now time.Time) error {
+	defer metrics.ObserveDB("org", "AddMember")()
+	_, err := r.exec(`
+		INSERT INTO org_members (org_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, orgID, userID, role, now)
+	return err
+}
+
+// SetRole reports whether the user was a member.
+func (r *Repository) SetRole(orgID, userID int, role string) (bool, error) {
+	defer metrics.ObserveDB("org", "SetRole")()
+	return r.exec(`UPDATE org_members SET role = $1 WHERE org_id = $2 AND user_id = $3`, role, orgID, userID)
+}
+
+// RemoveMember reports whether the user was a member.
+func (r *Repository) RemoveMember(orgID, userID int) (bool, error) {
+	defer metrics.ObserveDB("org", "RemoveMember")()
+	return r.exec(`DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+}
+
+func (r *Repository) CountOwners(orgID int) (int, error) {
+	defer metrics.ObserveDB("org", "CountOwners")()
+	var n int
+	err := r.queryRow(`SELECT COUNT(*) FROM org_members WHERE org_id = $1 AND role = $2`, orgID, RoleOwner).Scan(&n)
+	return n, err
+}
+
+// FindUser returns the ID and username of a user, or 0 if there is none.
+// Exactly one of id and username should be set.
+func (r *Repository) FindUser(id int, username string) (int, string, error) {
+	defer metrics.ObserveDB("org", "FindUser")()
+	var uid int
+	var name string
+	err := r.queryRow(`SELECT id, username FROM users WHERE id = $1 OR username = $2`, id, username).Scan(&uid, &name)
+	if isNoRows(err) {
+		return 0, "", nil
+	}
+	return uid, name, err
+}
+
+func (r *Repository) queryRow(query string, args ...any) rowScanner {
+	if config.DBDriver == "postgres" {
+		return r.pgxPool.QueryRow(context.Background(), query, args...)
+	}
+	return r.sqlDB.QueryRow(query, args...)
+}
+
+// exec reports whether the statement affected any row.
+func (r *Repository) exec(query string, args ...any) (bool, error) {
+	if config.DBDriver == "postgres" {
+		tag, err := r.pgxPool.Exec(context.Background(), query, args...)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+
+	res, err := r.sqlDB.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,307 @@
+package org
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+var (
+	ErrNotFound       = apierror.NotFound("organization not found")
+	ErrForbidden      = apierror.Forbidden("not allowed to access this organization")
+	ErrNotOwner       = apierror.Forbidden("only organization owners may do this")
+	ErrPersonal       = apierror.Conflict("personal organizations cannot have other members")
+	ErrAlreadyMember  = apierror.Conflict("user is already a member")
+	ErrLastOwner      = apierror.Conflict("an organization must keep at least one owner")
+	ErrMemberNotFound = apierror.NotFound("member not found")
+)
+
+// Sorts are the sort fields of the organization list.
+var Sorts = pagination.Sorts{
+	Columns: map[string]string{"name": "name", "created_at": "id"},
+	Default: "name",
+}
+
+// MemberSorts are the sort fields of the member list; ?name matches the username.
+var MemberSorts = pagination.Sorts{
+	Columns: map[string]string{"username": "username", "created_at": "id"},
+	Default: "username",
+}
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService() *Service {
+	return &Service{repo: NewDefaultRepository()}
+}
+
+// Create makes a shared organization with userID as its owner.
+func (s *Service) Create(name string, userID int) (*Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, apierror.Field("name", "is required")
+	}
+	return s.repo.Create(name, 0, userID, time.Now().UTC())
+}
+
+// PersonalOrg returns the ID of the user's personal organization, creating
+// it on first use.
+func (s *Service) PersonalOrg(userID int) (int, error) {
+	o, err := s.repo.FindPersonal(userID)
+	if err != nil {
+		return 0, err
+	}
+	if o != nil {
+		return o.ID, nil
+	}
+
+	_, username, err := s.repo.FindUser(userID, "")
+	if err != nil {
+		return 0, err
+	}
+	o, err = s.repo.Create(username, userID, userID, time.Now().UTC())
+	if err != nil {
+		// Lost a race with another request creating it.
+		if existing, findErr := s.repo.FindPersonal(userID); findErr == nil && existing != nil {
+			return existing.ID, nil
+		}
+		return 0, err
+	}
+	return o.ID, nil
+}
+
+// PersonalOrgOf is PersonalOrg for a username; unknown users are a
+// validation error on field.
+func (s *Service) PersonalOrgOf(username, field string) (int, error) {
+	userID, _, err := s.repo.FindUser(0, username)
+	if err != nil {
+		return 0, err
+	}
+	if userID == 0 {
+		return 0, apierror.Field(field, "no such user")
+	}
+	return s.PersonalOrg(userID)
+}
+
+func (s *Service) ListForUser(userID int, p pagination.Params) (pagination.Page[Organization], error) {
+	// Make sure the personal organization shows up before anything is in it.
+	if _, err := s.PersonalOrg(userID); err != nil {
+		return pagination.Page[Organization]{}, err
+	}
+	rows, err := s.repo.ListForUser(userID, p)
+	if err != nil {
+		return pagination.Page[Organization]{}, err
+	}
+	return pagination.NewPage(rows, p, func(o Organization) (string, int64) { return o.Name, int64(o.ID) }), nil
+}
+
+// Get returns the organization with the user's role if they are a member.
+func (s *Service) Get(id, userID int) (*Organization, error) {
+	o, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, ErrNotFound
+	}
+	role, err := s.repo.Role(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrForbidden
+	}
+	o.Role = role
+	return o, nil
+}
+
+// Role returns the user's role in the organization, or "" if they are not
+// a member.
+func (s *Service) Role(id, userID int) (string, error) {
+	return s.repo.Role(id, userID)
+}
+
+// Members returns a page of the organization's members.
+func (s *Service) Members(id, userID int, p pagination.Params) (pagination.Page[Member], error) {
+	if _, err := s.Get(id, userID); err != nil {
+		return pagination.Page[Member]{}, err
+	}
+	rows, err := s.repo.ListMembers(id, p)
+	if err != nil {
+		return pagination.Page[Member]{}, err
+	}
+	return pagination.NewPage(rows, p, func(m Member) (string, int64) { return m.Username, int64(m.ID) }), nil
+}
+
+// AddMember adds a user to a shared organization. Only owners may.
+func (s *Service) AddMember(id int, username, role string, userID int) error {
+	o, err := s.requireOwner(id, userID)
+	if err != nil {
+		return err
+	}
+	if o.Personal {
+		return ErrPersonal
+	}
+	if role == "" {
+		role = RoleMember
+	}
+	if err := validateRole(role); err != nil {
+		return err
+	}
+
+	memberID, _, err := s.repo.FindUser(0, username)
+	if err != nil {
+		return err
+	}
+	if memberID == 0 {
+		return apierror.Field("username", "no such user")
+	}
+	existing, err := s.repo.Role(id, memberID)
+	if err != nil {
+		return err
+	}
+	if existing != "" {
+		return ErrAlreadyMember
+	}
+	return s.repo.AddMember(id, memberID, role, time.Now().UTC())
+}
+
+// SetRole changes a member's role. Only owners may, and the last owner
+// cannot be demoted.
+func (s *Service) SetRole(id, memberID int, role string, userID int) error {
+	if _, err := s.requireOwner(id, userID); err != nil {
+		return err
+	}
+	if err := validateRole(role); err != nil {
+		return err
+	}
+
+	current, err := s.repo.Role(id, memberID)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return ErrMemberNotFound
+	}
+	if current == RoleOwner && role != RoleOwner {
+		if err := s.requireAnotherOwner(id); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.repo.SetRole(id, memberID, role)
+	return err
+}
+
+// RemoveMember removes a user from an organization. Owners may remove
+// anyone and members may remove themselves, but the last owner cannot go:
+// the organization's workspaces would be left without anyone to manage them.
+func (s *Service) RemoveMember(id, memberID, userID int) error {
+	if memberID == userID {
+		if _, err := s.Get(id, userID); err != nil {
+			return err
+		}
+	} else if _, err := s.requireOwner(id, userID); err != nil {
+		return err
+	}
+
+	role, err := s.repo.Role(id, memberID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrMemberNotFound
+	}
+	if role == RoleOwner {
+		if err := s.requireAnotherOwner(id); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.repo.RemoveMember(id, memberID)
+	return err
+}
+
+// SyncRoles sets the user's role in each organization of roles to the one
+// their identity provider groups grant; "" removes them. Those
+// organizations are managed by the provider, so roles given by hand are
+// overwritten. Personal organizations are skipped, and the last owner is
+// kept rather than demoted or removed.
+func (s *Service) SyncRoles(userID int, roles map[int]string) error {
+	now := time.Now().UTC()
+	for id, role := range roles {
+		o, err := s.repo.FindByID(id)
+		if err != nil {
+			return err
+		}
+		if o == nil || o.Personal {
+			slog.Warn("cannot sync roles of a missing or personal organization", "org_id", id)
+			continue
+		}
+		current, err := s.repo.Role(id, userID)
+		if err != nil {
+			return err
+		}
+		if current == role {
+			continue
+		}
+		if current == RoleOwner {
+			err := s.requireAnotherOwner(id)
+			if errors.Is(err, ErrLastOwner) {
+				slog.Warn("keeping the last owner of an organization despite their groups", "org_id", id, "user_id", userID)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case role == "":
+			_, err = s.repo.RemoveMember(id, userID)
+		case current == "":
+			err = s.repo.AddMember(id, userID, role, now)
+		default:
+			_, err = s.repo.SetRole(id, userID, role)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) requireOwner(id, userID int) (*Organization, error) {
+	o, err := s.Get(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Role != RoleOwner {
+		return nil, ErrNotOwner
+	}
+	return o, nil
+}
+
+// requireAnotherOwner fails if the organization has only one owner left.
+func (s *Service) requireAnotherOwner(id int) error {
+	owners, err := s.repo.CountOwners(id)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func validateRole(role string) error {
+	if role != RoleOwner && role != RoleMember {
+		return apierror.Field("role", "must be owner or member")
+	}
+	return nil
+}
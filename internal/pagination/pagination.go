@@ -0,0 +1,179 @@
+// Package pagination implements keyset pagination for list endpoints.
+//
+// Lists accept ?limit=, ?cursor=, ?sort= (a field name, "-" prefix for
+// descending) and, where the resource has a name, ?name= (case-insensitive
+// substring). They respond with Page: {"items": [...], "next_cursor": "..."}.
+// Cursors are opaque to clients and only valid with the sort they came from.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Sorts describes the sort fields a list supports.
+type Sorts struct {
+	// Columns maps API field names to SQL columns. Every column must be
+	// non-null; rows with equal values are ordered by id.
+	Columns map[string]string
+	// Default is used when ?sort is absent, e.g. "-created_at".
+	Default string
+}
+
+// Fields lists the accepted ?sort values, for docs and error messages.
+func (s Sorts) Fields() []string {
+	fields := make([]string, 0, len(s.Columns))
+	for f := range s.Columns {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// Params is a parsed list request.
+type Params struct {
+	Limit  int
+	Field  string
+	Column string
+	Desc   bool
+	// Name filters on a case-insensitive substring when non-empty.
+	Name  string
+	after *cursor
+}
+
+type cursor struct {
+	Field string `json:"f"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int64  `json:"i"`
+}
+
+// Parse reads the pagination query parameters.
+func Parse(r *http.Request, sorts Sorts) (Params, error) {
+	q := r.URL.Query()
+	p := Params{Limit: DefaultLimit, Name: strings.TrimSpace(q.Get("name"))}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return p, apierror.Field("limit", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+		}
+		p.Limit = n
+	}
+
+	sort := q.Get("sort")
+	if sort == "" {
+		sort = sorts.Default
+	}
+	p.Field, p.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	col, ok := sorts.Columns[p.Field]
+	if !ok {
+		return p, apierror.Field("sort", "must be one of "+strings.Join(sorts.Fields(), ", ")+" (prefix with - for descending)")
+	}
+	p.Column = col
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return p, apierror.Field("cursor", "is invalid")
+		}
+		if c.Field != p.Field || c.Desc != p.Desc {
+			return p, apierror.Field("cursor", "was issued for a different sort")
+		}
+		p.after = c
+	}
+	return p, nil
+}
+
+// Query builds the filter and ordering for a keyset query over a table with
+// an integer id column. The returned where is "" or starts with " AND ",
+// and uses $N placeholders numbered from len(args)+1, which both pgx and
+// sqlite accept. tail holds ORDER BY and LIMIT; one extra row is fetched so
+// NewPage can tell whether there is a next page.
+func (p Params) Query(args []any, nameColumn string) (where, tail string, out []any) {
+	out = args
+	next := func(v any) string {
+		out = append(out, v)
+		return "$" + strconv.Itoa(len(out))
+	}
+
+	var b strings.Builder
+	if p.Name != "" && nameColumn != "" {
+		fmt.Fprintf(&b, " AND LOWER(%s) LIKE %s ESCAPE '\\'", nameColumn, next("%"+escapeLike(strings.ToLower(p.Name))+"%"))
+	}
+
+	op, dir := ">", "ASC"
+	if p.Desc {
+		op, dir = "<", "DESC"
+	}
+	if p.after != nil {
+		if p.Column == "id" {
+			fmt.Fprintf(&b, " AND id %s %s", op, next(p.after.ID))
+		} else {
+			v := next(p.after.Value)
+			fmt.Fprintf(&b, " AND (%s %s %s OR (%s = %s AND id %s %s))", p.Column, op, v, p.Column, v, op, next(p.after.ID))
+		}
+	}
+
+	order := fmt.Sprintf("%s %s", p.Column, dir)
+	if p.Column != "id" {
+		order += ", id " + dir
+	}
+	tail = fmt.Sprintf(" ORDER BY %s LIMIT %s", order, next(p.Limit+1))
+	return b.String(), tail, out
+}
+
+// Page is the list response envelope.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage trims the extra row fetched by Query and, if there was one, sets
+// NextCursor from the last item. key returns an item's sort value (as
+// stored, formatted as text) and id.
+func NewPage[T any](rows []T, p Params, key func(T) (string, int64)) Page[T] {
+	page := Page[T]{Items: rows}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(rows) > p.Limit {
+		page.Items = rows[:p.Limit]
+		value, id := key(page.Items[p.Limit-1])
+		page.NextCursor = encodeCursor(&cursor{Field: p.Field, Desc: p.Desc, Value: value, ID: id})
+	}
+	return page
+}
+
+func encodeCursor(c *cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
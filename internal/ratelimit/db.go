@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// updateAttempts bounds how often Update retries when other requests keep
+// changing the same entry under it.
+const updateAttempts = 5
+
+var errContended = errors.New("rate limit entry is contended, giving up")
+
+// DBStore keeps entries in the rate_limits table so that every server
+// instance sees the same buckets and locks. Updates are optimistic: a row is
+// only written back if its version has not moved since it was read.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+type DBStore struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func NewDBStore(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *DBStore {
+	return &DBStore{sqlDB: sqlDB, pgxPool: pgxPool, lastPruned: time.Now()}
+}
+
+func NewDefaultDBStore() *DBStore {
+	return NewDBStore(config.DB, config.PGXPool)
+}
+
+func (s *DBStore) Get(key string) (Entry, error) {
+	e, _, err := s.load(key)
+	return e, err
+}
+
+func (s *DBStore) Update(key string, fn func(e *Entry)) (Entry, error) {
+	if err := s.prune(); err != nil {
+		return Entry{}, err
+	}
+
+	for range updateAttempts {
+		e, version, err := s.load(key)
+		if err != nil {
+			return Entry{}, err
+		}
+		fn(&e)
+
+		var ok bool
+		if version == 0 {
+			ok, err = s.exec(`
+				INSERT INTO rate_limits (name, tokens, failures, locked_until, updated_at, version)
+				VALUES ($1, $2, $3, $4, $5, 1)
+				ON CONFLICT (name) DO NOTHING
+			`, key, e.Tokens, e.Failures, nullTime(e.LockedUntil), e.UpdatedAt)
+		} else {
+			ok, err = s.exec(`
+				UPDATE rate_limits
+				SET tokens = $1, failures = $2, locked_until = $3, updated_at = $4, version = version + 1
+				WHERE name = $5 AND version = $6
+			`, e.Tokens, e.Failures, nullTime(e.LockedUntil), e.UpdatedAt, key, version)
+		}
+		if err != nil {
+			return Entry{}, err
+		}
+		if ok {
+			return e, nil
+		}
+	}
+	return Entry{}, errContended
+}
+
+func (s *DBStore) Delete(key string) (bool, error) {
+	return s.exec(`DELETE FROM rate_limits WHERE name = $1`, key)
+}
+
+// load returns the entry and its version, which is 0 if there is no row.
+func (s *DBStore) load(key string) (Entry, int64, error) {
+	var e Entry
+	var lockedUntil *time.Time
+	var version int64
+	query := `SELECT tokens, failures, locked_until, updated_at, version FROM rate_limits WHERE name = $1`
+
+	var err error
+	if config.DBDriver == "postgres" {
+		err = s.pgxPool.QueryRow(context.Background(), query, key).
+			Scan(&e.Tokens, &e.Failures, &lockedUntil, &e.UpdatedAt, &version)
+	} else {
+		err = s.sqlDB.QueryRow(query, key).
+			Scan(&e.Tokens, &e.Failures, &lockedUntil, &e.UpdatedAt, &version)
+	}
+	if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, 0, nil
+	}
+	if err != nil {
+		return Entry{}, 0, err
+	}
+	if lockedUntil != nil {
+		e.LockedUntil = *lockedUntil
+	}
+	return e, version, nil
+}
+
+// prune drops idle entries at most once per pruneInterval per instance.
+func (s *DBStore) prune() error {
+	s.mu.Lock()
+	now := time.Now()
+	due := now.Sub(s.lastPruned) >= pruneInterval
+	if due {
+		s.lastPruned = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+
+	now = now.UTC()
+	_, err := s.exec(`
+		DELETE FROM rate_limits
+		WHERE updated_at < $1 AND (locked_until IS NULL OR locked_until < $2)
+	`, now.Add(-idleTTL), now)
+	return err
+}
+
+// exec runs a statement written with $N placeholders, which both pgx and
+// sqlite accept, and reports whether it affected any row.
+func (s *DBStore) exec(query string, args ...any) (bool, error) {
+	if config.DBDriver == "postgres" {
+		tag, err := s.pgxPool.Exec(context.Background(), query, args...)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+
+	res, err := s.sqlDB.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
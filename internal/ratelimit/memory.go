@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps entries in process memory. Each server instance then
+// limits on its own, so use DBStore when running more than one.
+type MemoryStore struct {
+	mu         sync.Mutex
+	entries    map[string]Entry
+	lastPruned time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), lastPruned: time.Now()}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(e *Entry)) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	e := s.entries[key]
+	fn(&e)
+	s.entries[key] = e
+	return e, nil
+}
+
+func (s *MemoryStore) Delete(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.entries[key]
+	delete(s.entries, key)
+	return ok, nil
+}
+
+// prune drops idle entries at most once per pruneInterval. s.mu must be held.
+func (s *MemoryStore) prune() {
+	now := time.Now()
+	if now.Sub(s.lastPruned) < pruneInterval {
+		return
+	}
+	s.lastPruned = now
+	for key, e := range s.entries {
+		if now.Sub(e.UpdatedAt) > idleTTL && now.After(e.LockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Package ratelimit throttles requests with token buckets and locks out keys
+// after repeated failures. State is kept in a Store: MemoryStore for a single
+// server, DBStore when several instances must share it.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+)
+
+// idleTTL is how long an untouched entry is kept. Buckets refill and
+// failures are forgotten well before that.
+const idleTTL = 24 * time.Hour
+
+// pruneInterval is how often stores drop entries idle for longer than idleTTL.
+const pruneInterval = time.Hour
+
+// Entry is the state kept for one key. Buckets use Tokens; lockouts use
+// Failures and LockedUntil.
+type Entry struct {
+	Tokens      float64
+	Failures    int
+	LockedUntil time.Time
+	UpdatedAt   time.Time
+}
+
+// Store keeps entries by key. Update must be atomic per key, also across
+// server instances sharing the store.
+type Store interface {
+	// Get returns the entry for key, or the zero Entry if there is none.
+	Get(key string) (Entry, error)
+	// Update loads the entry for key (the zero Entry if there is none), lets
+	// fn change it and saves the result, which it returns.
+	Update(key string, fn func(e *Entry)) (Entry, error)
+	// Delete removes the entry and reports whether there was one.
+	Delete(key string) (bool, error)
+}
+
+// Limiter is a token bucket per key: each key may burst up to burst
+// requests, refilled at perMinute.
+type Limiter struct {
+	store Store
+	rate  float64 // tokens per second
+	burst float64
+}
+
+// NewLimiter returns a limiter, or nil (which lets everything through) if
+// perMinute is not positive. burst defaults to perMinute.
+func NewLimiter(store Store, perMinute, burst int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &Limiter{store: store, rate: float64(perMinute) / 60, burst: float64(burst)}
+}
+
+// Allow takes a token from key's bucket. It returns 0 if there was one, or
+// how long until the next token otherwise.
+func (l *Limiter) Allow(key string) (time.Duration, error) {
+	var wait time.Duration
+	_, err := l.store.Update(key, func(e *Entry) {
+		now := time.Now().UTC()
+		if e.UpdatedAt.IsZero() {
+			e.Tokens = l.burst
+		} else {
+			elapsed := now.Sub(e.UpdatedAt).Seconds()
+			e.Tokens = math.Min(l.burst, e.Tokens+math.Max(0, elapsed)*l.rate)
+		}
+		e.UpdatedAt = now
+
+		if e.Tokens >= 1 {
+			e.Tokens--
+			wait = 0
+			return
+		}
+		wait = time.Duration((1 - e.Tokens) / l.rate * float64(time.Second))
+	})
+	return wait, err
+}
+
+// KeyFunc returns the buckets a request draws from.
+type KeyFunc func(r *http.Request) []string
+
+// Middleware answers 429 with Retry-After when any of the request's buckets
+// is empty. A nil Limiter passes every request through.
+func (l *Limiter) Middleware(keys KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var wait time.Duration
+			for _, key := range keys(r) {
+				d, err := l.Allow(key)
+				if err != nil {
+					apierror.Write(w, r, err)
+					return
+				}
+				wait = max(wait, d)
+			}
+			if wait > 0 {
+				apierror.Write(w, r, apierror.TooManyRequests("too many requests, slow down", wait))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the IP of the request's peer.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Lockout locks a key for a while once it reaches threshold consecutive
+// failures. Every further failure doubles the lock, up to maxLock.
+type Lockout struct {
+	store     Store
+	threshold int
+	base      time.Duration
+	maxLock   time.Duration
+}
+
+// NewLockout returns a lockout, or nil (which never locks) if threshold is
+// not positive.
+func NewLockout(store Store, threshold int, base, maxLock time.Duration) *Lockout {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Lockout{store: store, threshold: threshold, base: base, maxLock: max(base, maxLock)}
+}
+
+// Check returns how much longer key is locked, or 0.
+func (l *Lockout) Check(key string) (time.Duration, error) {
+	e, err := l.store.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return max(0, time.Until(e.LockedUntil)), nil
+}
+
+// Fail records a failure. If it locks the key, Fail returns the lock
+// duration and the number of consecutive failures so far.
+func (l *Lockout) Fail(key string) (time.Duration, int, error) {
+	var lock time.Duration
+	e, err := l.store.Update(key, func(e *Entry) {
+		now := time.Now().UTC()
+		// Failures spread out over more than a day do not add up.
+		if now.Sub(e.UpdatedAt) > idleTTL {
+			e.Failures = 0
+		}
+		e.Failures++
+		e.UpdatedAt = now
+
+		lock = 0
+		if over := e.Failures - l.threshold; over >= 0 {
+			lock = l.base
+			for ; over > 0 && lock < l.maxLock; over-- {
+				lock *= 2
+			}
+			lock = min(lock, l.maxLock)
+			e.LockedUntil = now.Add(lock)
+		}
+	})
+	return lock, e.Failures, err
+}
+
+// Reset forgets key's failures and lock, and reports whether there were any.
+func (l *Lockout) Reset(key string) (bool, error) {
+	return l.store.Delete(key)
+}
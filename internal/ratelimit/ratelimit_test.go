@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+)
+
+// stores runs fn against each Store implementation.
+func stores(t *testing.T, fn func(t *testing.T, store Store)) {
+	t.Run("memory", func(t *testing.T) { fn(t, NewMemoryStore()) })
+	t.Run("db", func(t *testing.T) {
+		configtest.SQLite(t)
+		fn(t, NewDefaultDBStore())
+	})
+}
+
+// rewind moves key's last update back by d, as if d had passed.
+func rewind(t *testing.T, store Store, key string, d time.Duration) {
+	t.Helper()
+	if _, err := store.Update(key, func(e *Entry) { e.UpdatedAt = e.UpdatedAt.Add(-d) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimiterDrainsAndRefillsBucket(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		l := NewLimiter(store, 60, 3)
+		for i := range 3 {
+			if wait, err := l.Allow("k"); err != nil || wait != 0 {
+				t.Fatalf("request %d: wait %v, %v; want it allowed", i+1, wait, err)
+			}
+		}
+		wait, err := l.Allow("k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait <= 0 || wait > time.Second {
+			t.Fatalf("fourth request wait = %v, want up to a second at 60/min", wait)
+		}
+		if wait, _ := l.Allow("other"); wait != 0 {
+			t.Fatalf("another key waits %v, want its own full bucket", wait)
+		}
+
+		// Two seconds refill two tokens at one per second.
+		rewind(t, store, "k", 2*time.Second)
+		for i := range 2 {
+			if wait, err := l.Allow("k"); err != nil || wait != 0 {
+				t.Fatalf("refilled request %d: wait %v, %v; want it allowed", i+1, wait, err)
+			}
+		}
+		if wait, _ := l.Allow("k"); wait == 0 {
+			t.Fatal("bucket refilled beyond the elapsed time")
+		}
+
+		// A long pause refills only up to the burst.
+		rewind(t, store, "k", time.Hour)
+		for i := range 3 {
+			if wait, _ := l.Allow("k"); wait != 0 {
+				t.Fatalf("request %d after an hour waits %v", i+1, wait)
+			}
+		}
+		if wait, _ := l.Allow("k"); wait == 0 {
+			t.Fatal("bucket held more than its burst")
+		}
+	})
+}
+
+func TestLockoutDoublesUpToMax(t *testing.T) {
+	stores(t, func(t *testing.T, store Store) {
+		l := NewLockout(store, 3, time.Minute, 4*time.Minute)
+		for i, want := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+			lock, failures, err := l.Fail("alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lock != want || failures != i+1 {
+				t.Fatalf("failure %d: lock %v after %d failures, want %v after %d", i+1, lock, failures, want, i+1)
+			}
+		}
+		if wait, err := l.Check("alice"); err != nil || wait <= 3*time.Minute {
+			t.Fatalf("check = %v, %v; want locked for about 4m", wait, err)
+		}
+		if wait, _ := l.Check("bob"); wait != 0 {
+			t.Fatalf("bob is locked for %v by alice's failures", wait)
+		}
+
+		// Failures more than a day apart start over.
+		rewind(t, store, "alice", idleTTL+time.Minute)
+		if lock, failures, _ := l.Fail("alice"); lock != 0 || failures != 1 {
+			t.Fatalf("failure after a day: lock %v after %d failures, want none after 1", lock, failures)
+		}
+
+		if ok, err := l.Reset("alice"); err != nil || !ok {
+			t.Fatalf("reset = %v, %v; want true", ok, err)
+		}
+		if wait, _ := l.Check("alice"); wait != 0 {
+			t.Fatalf("alice still locked for %v after reset", wait)
+		}
+		if ok, _ := l.Reset("alice"); ok {
+			t.Fatal("second reset found an entry")
+		}
+	})
+}
+
+func TestMiddlewareAnswers429WithRetryAfter(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), 30, 1)
+	h := l.Middleware(func(r *http.Request) []string {
+		return []string{"ip:" + ClientIP(r), "user:" + r.URL.Query().Get("user")}
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login?user="+user, nil)
+		req.RemoteAddr = "192.0.2.1:4321"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("alice"); rec.Code != http.StatusNoContent {
+		t.Fatalf("first request = %d, want 204", rec.Code)
+	}
+	// The IP's bucket is empty even though bob's is full.
+	rec := do("bob")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", rec.Code)
+	}
+	secs, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || secs < 1 || secs > 2 {
+		t.Fatalf("Retry-After = %q, want about 2 seconds at 30/min", rec.Header().Get("Retry-After"))
+	}
+
+	var disabled *Limiter
+	if NewLimiter(NewMemoryStore(), 0, 5) != disabled {
+		t.Fatal("a limiter with no rate is not nil")
+	}
+	passed := false
+	disabled.Middleware(nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { passed = true })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !passed {
+		t.Fatal("a nil limiter blocked a request")
+	}
+}
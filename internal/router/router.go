@@ -0,0 +1,215 @@
+// Package router registers method-qualified routes on a net/http ServeMux
+// ("PUT /api/v1/workspaces/{id}") and keeps a table of them so docs can be
+// generated from what is actually served.
+//
+// Requests that match a registered path with the wrong method get a JSON 405
+// with an Allow header; unmatched requests go to the fallback handler or a
+// JSON 404.
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+)
+
+// Middleware wraps a handler. Name identifies it in the route table (e.g.
+// "auth"), so docs can tell which routes require a session.
+type Middleware struct {
+	Name string
+	Wrap func(http.Handler) http.Handler
+}
+
+// Route is one entry of the route table. Besides what is served it carries
+// documentation, filled in through the builder methods below.
+type Route struct {
+	Method     string
+	Path       string
+	Summary    string
+	Middleware []string
+
+	// Request is a sample of the JSON body (e.g. Credentials{}), or nil.
+	Request any
+	// Responses maps success statuses to a sample body; nil means no body.
+	Responses map[int]any
+	// ContentType of successful responses; empty means application/json.
+	ContentType string
+	Params      []Param
+}
+
+// Param is a documented query or header parameter. Path parameters are
+// taken from the pattern.
+type Param struct {
+	Name        string
+	In          string // "query" or "header"
+	Description string
+	Required    bool
+}
+
+// Body documents the JSON request body.
+func (r *Route) Body(sample any) *Route {
+	r.Request = sample
+	return r
+}
+
+// Returns documents a success response.
+func (r *Route) Returns(status int, sample any) *Route {
+	if r.Responses == nil {
+		r.Responses = make(map[int]any)
+	}
+	r.Responses[status] = sample
+	return r
+}
+
+// Produces overrides the content type of successful responses.
+func (r *Route) Produces(contentType string) *Route {
+	r.ContentType = contentType
+	return r
+}
+
+// Query documents a query parameter.
+func (r *Route) Query(name, description string, required bool) *Route {
+	r.Params = append(r.Params, Param{Name: name, In: "query", Description: description, Required: required})
+	return r
+}
+
+// Header documents an optional request header.
+func (r *Route) Header(name, description string) *Route {
+	r.Params = append(r.Params, Param{Name: name, In: "header", Description: description})
+	return r
+}
+
+// Uses reports whether the named middleware wraps the route.
+func (r Route) Uses(name string) bool {
+	return slices.Contains(r.Middleware, name)
+}
+
+// methods are probed when deciding between 404 and 405.
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// Router is the root of a route tree. Groups share its mux and table.
+type Router struct {
+	mux      *http.ServeMux
+	routes   []*Route
+	fallback http.Handler
+}
+
+func New() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Fallback serves requests that match no route and no path, e.g. the SPA.
+func (rt *Router) Fallback(h http.Handler) {
+	rt.fallback = h
+}
+
+// Routes returns a copy of the route table in registration order.
+func (rt *Router) Routes() []Route {
+	out := make([]Route, len(rt.routes))
+	for i, r := range rt.routes {
+		out[i] = *r
+	}
+	return out
+}
+
+// Group starts a set of routes sharing a path prefix and middleware.
+func (rt *Router) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{root: rt, prefix: prefix, middleware: mw}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern != "" {
+		rt.mux.ServeHTTP(w, r)
+		return
+	}
+
+	if allow := rt.allowed(r); len(allow) > 0 {
+		apierror.Write(w, r, apierror.MethodNotAllowed(allow...))
+		return
+	}
+	if rt.fallback != nil {
+		rt.fallback.ServeHTTP(w, r)
+		return
+	}
+	apierror.Write(w, r, apierror.NotFound("no such route"))
+}
+
+// allowed lists the methods registered for the request's path.
+func (rt *Router) allowed(r *http.Request) []string {
+	var allow []string
+	probe := r.Clone(r.Context())
+	for _, m := range methods {
+		probe.Method = m
+		if _, pattern := rt.mux.Handler(probe); pattern != "" {
+			allow = append(allow, m)
+		}
+	}
+	return allow
+}
+
+// Group registers routes under a prefix. Middleware applies outermost first.
+type Group struct {
+	root       *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Group nests a sub-group that inherits this group's prefix and middleware.
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		root:       g.root,
+		prefix:     g.prefix + prefix,
+		middleware: append(slices.Clone(g.middleware), mw...),
+	}
+}
+
+// With returns a group with the same prefix and extra middleware.
+func (g *Group) With(mw ...Middleware) *Group {
+	return g.Group("", mw...)
+}
+
+// Handle registers h for method and path (relative to the group prefix).
+// Extra middleware applies inside the group's. The returned route is used to
+// document the request and responses.
+func (g *Group) Handle(method, path, summary string, h http.HandlerFunc, mw ...Middleware) *Route {
+	chain := append(slices.Clone(g.middleware), mw...)
+
+	var handler http.Handler = h
+	names := make([]string, len(chain))
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i].Wrap(handler)
+		names[i] = chain[i].Name
+	}
+
+	full := g.prefix + path
+	g.root.mux.Handle(strings.ToUpper(method)+" "+full, handler)
+	route := &Route{
+		Method:     strings.ToUpper(method),
+		Path:       full,
+		Summary:    summary,
+		Middleware: names,
+	}
+	g.root.routes = append(g.root.routes, route)
+	return route
+}
+
+func (g *Group) Get(path, summary string, h http.HandlerFunc, mw ...Middleware) *Route {
+	return g.Handle(http.MethodGet, path, summary, h, mw...)
+}
+
+func (g *Group) Post(path, summary string, h http.HandlerFunc, mw ...Middleware) *Route {
+	return g.Handle(http.MethodPost, path, summary, h, mw...)
+}
+
+func (g *Group) Put(path, summary string, h http.HandlerFunc, mw ...Middleware) *Route {
+	return g.Handle(http.MethodPut, path, summary, h, mw...)
+}
+
+func (g *Group) Delete(path, summary string, h http.HandlerFunc, mw ...Middleware) *Route {
+	return g.Handle(http.MethodDelete, path, summary, h, mw...)
+}
@@ -1,28 +1,246 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/amartya2002/secretlane/internal/agent"
 	"github.com/amartya2002/secretlane/internal/auth"
 	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/frontend"
+	"github.com/amartya2002/secretlane/internal/health"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/openapi"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
+	"github.com/amartya2002/secretlane/internal/router"
+	"github.com/amartya2002/secretlane/internal/scim"
+	"github.com/amartya2002/secretlane/internal/secret"
+	"github.com/amartya2002/secretlane/internal/webhook"
 	"github.com/amartya2002/secretlane/internal/workspace"
 )
 
-func SetupRoutes(mux *http.ServeMux, authService *auth.AuthService, wsService *workspace.Service) {
+const apiV1 = "/api/v1"
+
+// RequireAdmin marks routes reserved for the configured admins.
+var RequireAdmin = router.Middleware{Name: "admin", Wrap: auth.RequireAdmin}
+
+func SetupRoutes(rt *router.Router, authService *auth.AuthService, loginLimiter *ratelimit.Limiter, orgService *org.Service, wsService *workspace.Service, secretService *secret.Service, agentService *agent.Service, webhookService *webhook.Service, bus *events.Bus, checker *health.Checker) {
 	authHandler := auth.NewLoginHandler(authService)
+	orgHandler := org.NewHandler(orgService)
 	wsHandler := workspace.NewHandler(wsService)
+	secretHandler := secret.NewHandler(secretService)
+	agentHandler := agent.NewHandler(agentService)
+	webhookHandler := webhook.NewHandler(webhookService)
+	eventsHandler := events.NewHandler(bus, wsService, authService)
 
-	const apiV1 = "/api/v1"
+	// requireAuth marks routes that need a user session.
+	requireAuth := router.Middleware{Name: openapi.AuthMiddleware, Wrap: authService.RequireAuth}
+
+	api := rt.Group(apiV1)
+	authed := api.With(requireAuth)
+	admin := authed.With(RequireAdmin)
+	throttleLogin := router.Middleware{Name: "ratelimit", Wrap: loginLimiter.Middleware(auth.LoginKeys)}
 
 	// Auth
-	mux.HandleFunc(apiV1+"/signup", authHandler.Signup)
-	mux.HandleFunc(apiV1+"/login", authHandler.Login)
-	mux.Handle(apiV1+"/logout", auth.RequireAuth(http.HandlerFunc(auth.Logout)))
+	api.Post("/signup", "Create an account and start a session", authHandler.Signup).
+		Query("token", "true to return the session token for bearer auth", false).
+		Body(auth.Credentials{}).Returns(http.StatusOK, auth.Session{})
+	api.Post("/login", "Start a session", authHandler.Login, throttleLogin).
+		Query("token", "true to return the session token for bearer auth", false).
+		Body(auth.Credentials{}).Returns(http.StatusOK, auth.Session{})
+	authed.Post("/logout", "End the session", auth.Logout).
+		Returns(http.StatusOK, openapi.Message{})
+	if config.OIDC.Enabled() {
+		oidcHandler, err := auth.NewOIDCHandler(authService)
+		if err != nil {
+			logging.Fatal("invalid oidc config", "err", err)
+		}
+		api.Get("/auth/oidc/login", "Start single sign-on with the identity provider", oidcHandler.Login).
+			Query("redirect", "Path on this server to return to after signing in", false).
+			Returns(http.StatusFound, nil)
+		api.Get("/auth/oidc/callback", "Finish single sign-on and start a session", oidcHandler.Callback, throttleLogin).
+			Query("code", "Authorization code from the identity provider", true).
+			Query("state", "State sent with the login redirect", true).
+			Returns(http.StatusSeeOther, nil)
+	}
+
+	// Admin
+	admin.Delete("/admin/lockouts/{username}", "Unlock an account locked by failed logins", authHandler.UnlockAccount).
+		Returns(http.StatusOK, openapi.Message{})
+
+	// Health: liveness never touches dependencies; readiness checks them.
+	api.Get("/livez", "Liveness check", checker.Livez).
+		Returns(http.StatusOK, health.Liveness{})
+	api.Get("/healthz", "Liveness check (alias of /livez)", checker.Livez).
+		Returns(http.StatusOK, health.Liveness{})
+	api.Get("/readyz", "Readiness check with dependency status", checker.Readyz).
+		Returns(http.StatusOK, health.Report{}).
+		Returns(http.StatusServiceUnavailable, health.Report{})
+
+	// Organizations
+	paginated(authed.Get("/orgs", "List your organizations", orgHandler.List), org.Sorts, "name").
+		Returns(http.StatusOK, pagination.Page[org.Organization]{})
+	authed.Post("/orgs", "Create an organization", orgHandler.Create).
+		Body(org.CreateRequest{}).Returns(http.StatusCreated, org.Organization{})
+	authed.Get("/orgs/{id}", "Get an organization", orgHandler.Get).
+		Returns(http.StatusOK, org.Organization{})
+	paginated(authed.Get("/orgs/{id}/members", "List organization members", orgHandler.Members), org.MemberSorts, "username").
+		Returns(http.StatusOK, pagination.Page[org.Member]{})
+	authed.Post("/orgs/{id}/members", "Add an organization member", orgHandler.AddMember).
+		Body(org.AddMemberRequest{}).Returns(http.StatusCreated, openapi.Message{})
+	authed.Put("/orgs/{id}/members/{userID}", "Change a member's role", orgHandler.SetRole).
+		Body(org.RoleRequest{}).Returns(http.StatusOK, openapi.Message{})
+	authed.Delete("/orgs/{id}/members/{userID}", "Remove an organization member", orgHandler.RemoveMember).
+		Returns(http.StatusOK, openapi.Message{})
+
+	// Workspaces
+	paginated(authed.Get("/workspaces", "List workspaces", wsHandler.List), workspace.Sorts, "name").
+		Query("org_id", "Only workspaces of this organization", false).
+		Returns(http.StatusOK, pagination.Page[workspace.Workspace]{})
+	authed.Post("/workspaces", "Create a workspace", wsHandler.Create).
+		Body(workspace.Input{}).Returns(http.StatusCreated, workspace.Created{})
+	authed.Get("/workspaces/{id}", "Get a workspace", wsHandler.Get).
+		Returns(http.StatusOK, workspace.Workspace{})
+	authed.Put("/workspaces/{id}", "Update a workspace", wsHandler.Update).
+		Body(workspace.Input{}).Returns(http.StatusOK, openapi.Message{})
+	authed.Delete("/workspaces/{id}", "Move a workspace to the trash", wsHandler.Delete).
+		Returns(http.StatusOK, openapi.Message{})
+	paginated(authed.Get("/workspaces/trash", "List deleted workspaces", wsHandler.Trash), workspace.Sorts, "name").
+		Query("org_id", "Only workspaces of this organization", false).
+		Returns(http.StatusOK, pagination.Page[workspace.Workspace]{})
+	authed.Post("/workspaces/{id}/restore", "Restore a workspace from the trash", wsHandler.Restore).
+		Returns(http.StatusOK, openapi.Message{})
+	authed.Post("/workspaces/{id}/transfer", "Move a workspace to another organization", wsHandler.Transfer).
+		Body(workspace.TransferRequest{}).Returns(http.StatusOK, openapi.Message{})
+	authed.Post("/workspaces/{id}/purge", "Permanently delete a workspace", wsHandler.Purge).
+		Body(workspace.PurgeRequest{}).Returns(http.StatusOK, openapi.Message{})
+	authed.Get("/workspaces/{id}/events", "Stream workspace changes (SSE)", eventsHandler.Stream).
+		Header("Last-Event-ID", "Resume after this event ID").
+		Query("last_event_id", "Same as Last-Event-ID, for clients that cannot set headers", false).
+		Produces("text/event-stream").Returns(http.StatusOK, events.Event{})
 
-	// Health
-	mux.HandleFunc(apiV1+"/healthz", config.HealthCheckHandler)
+	// Secrets
+	paginated(authed.Get("/workspaces/{id}/secrets", "List secrets without their values", secretHandler.List), secret.Sorts, "name").
+		Returns(http.StatusOK, pagination.Page[secret.Secret]{})
+	authed.Get("/workspaces/{id}/secrets/{name}", "Read a secret", secretHandler.Get).
+		Returns(http.StatusOK, secret.Secret{})
+	authed.Put("/workspaces/{id}/secrets/{name}", "Create or update a secret", secretHandler.Set).
+		Body(secret.SetRequest{}).
+		Returns(http.StatusCreated, secret.Secret{}).
+		Returns(http.StatusOK, secret.Secret{})
+	authed.Post("/workspaces/{id}/secrets/{name}/rotate", "Rotate a secret, generating a value if none is given", secretHandler.Rotate).
+		Body(secret.RotateRequest{}).Returns(http.StatusOK, secret.Secret{})
+	authed.Delete("/workspaces/{id}/secrets/{name}", "Delete a secret", secretHandler.Delete).
+		Returns(http.StatusOK, openapi.Message{})
+
+	// Agents: token management is authenticated as a user; enroll and
+	// connect are authenticated by join token and key signature respectively.
+	paginated(authed.Get("/agents", "List agents in a workspace", agentHandler.List), agent.Sorts, "name").
+		Query("workspace_id", "Workspace to list", true).
+		Returns(http.StatusOK, pagination.Page[agent.Agent]{})
+	authed.Post("/agents/tokens", "Create a join token", agentHandler.CreateJoinToken).
+		Body(agent.JoinTokenRequest{}).Returns(http.StatusCreated, agent.JoinTokenResponse{})
+	authed.Delete("/agents/{id}", "Revoke an agent", agentHandler.Revoke).
+		Returns(http.StatusOK, openapi.Message{})
+	api.Post("/agents/enroll", "Enroll an agent with a join token", agentHandler.Enroll).
+		Body(agent.EnrollRequest{}).Returns(http.StatusCreated, agent.EnrollResponse{})
+	api.Get("/agents/connect", "Agent WebSocket connection", agentHandler.Connect).
+		Returns(http.StatusSwitchingProtocols, nil)
+
+	// Webhooks
+	paginated(authed.Get("/webhooks", "List webhooks in a workspace", webhookHandler.List), webhook.Sorts, "URL").
+		Query("workspace_id", "Workspace to list", true).
+		Returns(http.StatusOK, pagination.Page[webhook.Webhook]{})
+	authed.Post("/webhooks", "Create a webhook", webhookHandler.Create).
+		Body(webhook.CreateRequest{}).Returns(http.StatusCreated, webhook.Webhook{})
+	authed.Get("/webhooks/{id}", "Get a webhook", webhookHandler.Get).
+		Returns(http.StatusOK, webhook.Webhook{})
+	authed.Delete("/webhooks/{id}", "Delete a webhook", webhookHandler.Delete).
+		Returns(http.StatusOK, openapi.Message{})
+	paginated(authed.Get("/webhooks/{id}/deliveries", "List webhook deliveries", webhookHandler.Deliveries), webhook.DeliverySorts, "").
+		Returns(http.StatusOK, pagination.Page[webhook.Delivery]{})
+	authed.Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", "Retry a webhook delivery", webhookHandler.Redeliver).
+		Returns(http.StatusAccepted, webhook.Delivery{})
+
+	// SCIM provisioning, authenticated by the provider's bearer token.
+	if config.SCIM.Enabled() {
+		scimService, err := scim.NewService(orgService, authService, bus)
+		if err != nil {
+			logging.Fatal("invalid scim config", "err", err)
+		}
+		scimHandler := scim.NewHandler(scimService)
+		sc := rt.Group(scim.Prefix, router.Middleware{Name: "scim", Wrap: scim.RequireToken})
+
+		sc.Get("/ServiceProviderConfig", "SCIM features supported", scimHandler.ServiceProviderConfig).
+			Produces("application/scim+json").Returns(http.StatusOK, map[string]any{})
+		sc.Get("/Users", "List or look up users", scimHandler.ListUsers).
+			Query("filter", `e.g. userName eq "jdoe"; only eq is supported`, false).
+			Query("startIndex", "1-based index of the first result", false).
+			Query("count", "Page size, up to 200 (default 100)", false).
+			Produces("application/scim+json").Returns(http.StatusOK, scim.ListResponse[scim.User]{})
+		sc.Post("/Users", "Provision a user", scimHandler.CreateUser).
+			Body(scim.User{}).Produces("application/scim+json").Returns(http.StatusCreated, scim.User{})
+		sc.Get("/Users/{id}", "Get a user", scimHandler.GetUser).
+			Produces("application/scim+json").Returns(http.StatusOK, scim.User{})
+		sc.Put("/Users/{id}", "Replace a user", scimHandler.ReplaceUser).
+			Body(scim.User{}).Produces("application/scim+json").Returns(http.StatusOK, scim.User{})
+		sc.Handle(http.MethodPatch, "/Users/{id}", "Update or deactivate a user", scimHandler.PatchUser).
+			Body(scim.PatchRequest{}).Produces("application/scim+json").Returns(http.StatusOK, scim.User{})
+		sc.Delete("/Users/{id}", "Delete (offboard) a user", scimHandler.DeleteUser).
+			Returns(http.StatusNoContent, nil)
+		sc.Get("/Groups", "List or look up groups", scimHandler.ListGroups).
+			Query("filter", `e.g. displayName eq "Engineering"; only eq is supported`, false).
+			Query("startIndex", "1-based index of the first result", false).
+			Query("count", "Page size, up to 200 (default 100)", false).
+			Query("excludedAttributes", "members, to leave out the member lists", false).
+			Produces("application/scim+json").Returns(http.StatusOK, scim.ListResponse[scim.Group]{})
+		sc.Post("/Groups", "Create a group", scimHandler.CreateGroup).
+			Body(scim.Group{}).Produces("application/scim+json").Returns(http.StatusCreated, scim.Group{})
+		sc.Get("/Groups/{id}", "Get a group", scimHandler.GetGroup).
+			Query("excludedAttributes", "members, to leave out the member list", false).
+			Produces("application/scim+json").Returns(http.StatusOK, scim.Group{})
+		sc.Put("/Groups/{id}", "Replace a group and its members", scimHandler.ReplaceGroup).
+			Body(scim.Group{}).Produces("application/scim+json").Returns(http.StatusOK, scim.Group{})
+		sc.Handle(http.MethodPatch, "/Groups/{id}", "Rename a group or change its members", scimHandler.PatchGroup).
+			Body(scim.PatchRequest{}).Produces("application/scim+json").Returns(http.StatusOK, scim.Group{})
+		sc.Delete("/Groups/{id}", "Delete a group", scimHandler.DeleteGroup).
+			Returns(http.StatusNoContent, nil)
+	}
+
+	// The spec is built last so it covers every route above, itself included.
+	var spec http.HandlerFunc
+	api.Get("/openapi.json", "This OpenAPI document", func(w http.ResponseWriter, r *http.Request) { spec(w, r) }).
+		Returns(http.StatusOK, map[string]any{})
+	doc, err := openapi.Build(openapi.Info{Title: "Secretlane API", Version: "v1"}, rt.Routes())
+	if err != nil {
+		logging.Fatal("failed to build OpenAPI document", "err", err)
+	}
+	if spec, err = openapi.Handler(doc); err != nil {
+		logging.Fatal("failed to build OpenAPI document", "err", err)
+	}
+
+	// Frontend: the embedded SPA answers everything outside /api/v1.
+	if config.App.EnableFrontend {
+		fe, err := frontend.NewHandler(apiV1)
+		if err != nil {
+			logging.Fatal("failed to load embedded frontend", "err", err)
+		}
+		rt.Fallback(fe)
+	}
+}
 
-	// Workspaces (authenticated)
-	mux.Handle(apiV1+"/workspaces", auth.RequireAuth(http.HandlerFunc(wsHandler.Workspaces)))
-	mux.Handle(apiV1+"/workspaces/", auth.RequireAuth(http.HandlerFunc(wsHandler.WorkspaceByID)))
+// paginated documents the list parameters of pagination.Parse. nameField is
+// what ?name matches, or "" if the list has no name filter.
+func paginated(route *router.Route, sorts pagination.Sorts, nameField string) *router.Route {
+	route.Query("limit", fmt.Sprintf("Page size, 1-%d (default %d)", pagination.MaxLimit, pagination.DefaultLimit), false).
+		Query("cursor", "next_cursor from the previous page", false).
+		Query("sort", "One of "+strings.Join(sorts.Fields(), ", ")+"; prefix with - for descending (default "+sorts.Default+")", false)
+	if nameField != "" {
+		route.Query("name", "Case-insensitive substring of the "+nameField, false)
+	}
+	return route
 }
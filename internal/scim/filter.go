@@ -0,0 +1,96 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// userFilters and groupFilters are the attributes a list can be filtered
+// on, in lower case, with the condition each becomes.
+var (
+	userFilters = map[string]string{
+		"username":     "LOWER(username) = LOWER($1)",
+		"externalid":   "external_id = $1",
+		"displayname":  "display_name = $1",
+		"emails":       "LOWER(email) = LOWER($1)",
+		"emails.value": "LOWER(email) = LOWER($1)",
+	}
+	groupFilters = map[string]string{
+		"displayname": "display_name = $1",
+		"externalid":  "external_id = $1",
+	}
+)
+
+// parseFilter turns a filter such as `userName eq "jdoe"` into a condition.
+// Only eq on one attribute is supported, which is what identity providers
+// send to look up a resource before creating it.
+func parseFilter(filter string, attrs map[string]string) (condition, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return condition{}, nil
+	}
+
+	// A value path like emails[type eq "work"].value has spaces inside
+	// the brackets.
+	depth, end := 0, len(filter)
+	for i, c := range filter {
+		if c == '[' {
+			depth++
+		} else if c == ']' {
+			depth--
+		} else if c == ' ' && depth == 0 {
+			end = i
+			break
+		}
+	}
+	attr := attributeName(filter[:end])
+	op, value, _ := strings.Cut(strings.TrimSpace(filter[end:]), " ")
+	if !strings.EqualFold(op, "eq") {
+		return condition{}, errInvalidFilter("only the eq operator is supported")
+	}
+	expr, ok := attrs[attr]
+	if !ok {
+		return condition{}, errInvalidFilter("cannot filter on " + filter[:end])
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(value)), &v); err != nil {
+		return condition{}, errInvalidFilter("malformed value in filter")
+	}
+	s, ok := v.(string)
+	if !ok {
+		return condition{}, errInvalidFilter("filter value must be a string")
+	}
+	return condition{expr: expr, value: s}, nil
+}
+
+// attributeName lower-cases an attribute path and drops a schema URN
+// prefix and any value filter, so `emails[type eq "work"].value` becomes
+// "emails.value".
+func attributeName(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	for _, urn := range []string{SchemaUser, SchemaGroup} {
+		path = strings.TrimPrefix(path, strings.ToLower(urn)+":")
+	}
+	if start := strings.IndexByte(path, '['); start >= 0 {
+		if n := strings.IndexByte(path[start:], ']'); n >= 0 {
+			path = path[:start] + path[start+n+1:]
+		}
+	}
+	return path
+}
+
+// valueFilter returns the value that a path like `members[value eq "12"]`
+// selects, or "" if the path has no filter on value.
+func valueFilter(path string) string {
+	start := strings.IndexByte(path, '[')
+	end := strings.LastIndexByte(path, ']')
+	if start < 0 || end < start {
+		return ""
+	}
+	cond, err := parseFilter(path[start+1:end], map[string]string{"value": "value"})
+	if err != nil {
+		return ""
+	}
+	return cond.value
+}
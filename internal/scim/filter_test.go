@@ -0,0 +1,60 @@
+package scim
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, tc := range []struct {
+		filter string
+		want   condition
+	}{
+		{``, condition{}},
+		{`userName eq "jdoe"`, condition{userFilters["username"], "jdoe"}},
+		{`  USERNAME EQ "jdoe"  `, condition{userFilters["username"], "jdoe"}},
+		{SchemaUser + `:userName eq "jdoe"`, condition{userFilters["username"], "jdoe"}},
+		{`externalId eq "ext 1"`, condition{userFilters["externalid"], "ext 1"}},
+		{`emails[type eq "work"].value eq "j@example.com"`, condition{userFilters["emails.value"], "j@example.com"}},
+		{`userName eq "say \"hi\""`, condition{userFilters["username"], `say "hi"`}},
+	} {
+		got, err := parseFilter(tc.filter, userFilters)
+		if err != nil || got != tc.want {
+			t.Errorf("parseFilter(%q) = %+v, %v; want %+v", tc.filter, got, err, tc.want)
+		}
+	}
+
+	for _, filter := range []string{
+		`userName`,
+		`userName co "jd"`,
+		`userName eq "jdoe" and active eq true`,
+		`title eq "boss"`,
+		`userName eq jdoe`,
+		`userName eq 5`,
+	} {
+		_, err := parseFilter(filter, userFilters)
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != "invalidFilter" {
+			t.Errorf("parseFilter(%q) err = %v, want invalidFilter", filter, err)
+		}
+	}
+	if _, err := parseFilter(`userName eq "jdoe"`, groupFilters); err == nil {
+		t.Error("groups can be filtered on userName")
+	}
+}
+
+func TestValueFilter(t *testing.T) {
+	for path, want := range map[string]string{
+		`members[value eq "12"]`:   "12",
+		`members[VALUE EQ "12"]`:   "12",
+		`members`:                  "",
+		`members[display eq "12"]`: "",
+		`members[value eq 12]`:     "",
+	} {
+		if got := valueFilter(path); got != want {
+			t.Errorf("valueFilter(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// Prefix is where the API is served; Users and Groups live under it.
+const Prefix = "/scim/v2"
+
+const (
+	usersPath  = Prefix + "/Users"
+	groupsPath = Prefix + "/Groups"
+
+	contentType = "application/scim+json"
+
+	// maxCount caps the page size a list may ask for.
+	maxCount     = 200
+	defaultCount = 100
+)
+
+// scimTypes are the apierror codes that are SCIM error types (RFC 7644
+// section 3.12); other codes are sent without one.
+var scimTypes = []string{"invalidFilter", "invalidSyntax", "invalidValue", "uniqueness", "noTarget", "mutability"}
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{service: s}
+}
+
+// RequireToken lets through requests that carry config.SCIM.Token as a
+// bearer token.
+func RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		// Hashing first makes the comparison independent of the length.
+		got := sha256.Sum256([]byte(strings.TrimSpace(token)))
+		want := sha256.Sum256([]byte(config.SCIM.Token))
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeError(w, r, apierror.Unauthorized("missing or invalid SCIM token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET /Users?filter=&startIndex=&count=
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := pageParams(r)
+	list, err := h.service.ListUsers(r.Context(), r.URL.Query().Get("filter"), startIndex, count)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, list)
+}
+
+// POST /Users
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var body User
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	u, err := h.service.CreateUser(r.Context(), body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", u.Meta.Location)
+	writeSCIM(w, http.StatusCreated, u)
+}
+
+// GET /Users/{id}
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrUserNotFound)
+	if !ok {
+		return
+	}
+
+	u, err := h.service.GetUser(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, u)
+}
+
+// PUT /Users/{id}
+func (h *Handler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrUserNotFound)
+	if !ok {
+		return
+	}
+	var body User
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	u, err := h.service.ReplaceUser(r.Context(), id, body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, u)
+}
+
+// PATCH /Users/{id}
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrUserNotFound)
+	if !ok {
+		return
+	}
+	var body PatchRequest
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	u, err := h.service.PatchUser(r.Context(), id, body.Operations)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, u)
+}
+
+// DELETE /Users/{id}
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrUserNotFound)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteUser(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /Groups?filter=&startIndex=&count=&excludedAttributes=
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	startIndex, count := pageParams(r)
+	list, err := h.service.ListGroups(r.Context(), r.URL.Query().Get("filter"), startIndex, count, withMembers(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, list)
+}
+
+// POST /Groups
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var body Group
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	g, err := h.service.CreateGroup(r.Context(), body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", g.Meta.Location)
+	writeSCIM(w, http.StatusCreated, g)
+}
+
+// GET /Groups/{id}?excludedAttributes=
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrGroupNotFound)
+	if !ok {
+		return
+	}
+
+	g, err := h.service.GetGroup(r.Context(), id, withMembers(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, g)
+}
+
+// PUT /Groups/{id}
+func (h *Handler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrGroupNotFound)
+	if !ok {
+		return
+	}
+	var body Group
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	g, err := h.service.ReplaceGroup(r.Context(), id, body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, g)
+}
+
+// PATCH /Groups/{id}
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrGroupNotFound)
+	if !ok {
+		return
+	}
+	var body PatchRequest
+	if err := decode(r, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	g, err := h.service.PatchGroup(r.Context(), id, body.Operations)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeSCIM(w, http.StatusOK, g)
+}
+
+// DELETE /Groups/{id}
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, ok := resourceID(w, r, ErrGroupNotFound)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteGroup(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /ServiceProviderConfig
+func (h *Handler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{SchemaServiceProviderConfig},
+		"patch":          map[string]any{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxCount},
+		"changePassword": map[string]any{"supported": false},
+		"sort":           map[string]any{"supported": false},
+		"etag":           map[string]any{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token set as scim.token",
+			"primary":     true,
+		}},
+		"meta": Meta{ResourceType: "ServiceProviderConfig", Location: Prefix + "/ServiceProviderConfig"},
+	})
+}
+
+// pageParams reads startIndex (1-based) and count, clamping them as RFC
+// 7644 section 3.4.2.4 asks rather than rejecting bad values.
+func pageParams(r *http.Request) (startIndex, count int) {
+	q := r.URL.Query()
+	startIndex, err := strconv.Atoi(q.Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err = strconv.Atoi(q.Get("count"))
+	switch {
+	case err != nil:
+		count = defaultCount
+	case count < 0:
+		count = 0
+	case count > maxCount:
+		count = maxCount
+	}
+	return startIndex, count
+}
+
+// withMembers is false when the request asks for excludedAttributes=members,
+// which providers use to look up large groups cheaply.
+func withMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if attributeName(attr) == "members" {
+			return false
+		}
+	}
+	return true
+}
+
+// resourceID parses the {id} path value. IDs are opaque to the provider, so
+// one that is not a number is simply not found.
+func resourceID(w http.ResponseWriter, r *http.Request, notFound error) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, r, notFound)
+		return 0, false
+	}
+	return id, true
+}
+
+func decode(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return apierror.New(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("invalid request body: %v", err))
+	}
+	return nil
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends err as a SCIM error. Errors that are not *apierror.Error
+// become a 500 with a generic message; the cause is logged.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		slog.ErrorContext(r.Context(), "internal error", "method", r.Method, "path", r.URL.Path, "err", err)
+		apiErr = apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "internal server error")
+	}
+
+	body := Error{
+		Schemas: []string{SchemaError},
+		Status:  strconv.Itoa(apiErr.Status),
+		Detail:  apiErr.Message,
+	}
+	if slices.Contains(scimTypes, apiErr.Code) {
+		body.ScimType = apiErr.Code
+	}
+	writeSCIM(w, apiErr.Status, body)
+}
@@ -0,0 +1,338 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/events"
+)
+
+const testToken = "test-scim-token-that-is-long-enough"
+
+// recordingRoles keeps the roles last synced for each user.
+type recordingRoles struct {
+	mu    sync.Mutex
+	roles map[int]map[int]string
+}
+
+func (r *recordingRoles) SyncRoles(userID int, roles map[int]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[userID] = roles
+	return nil
+}
+
+func (r *recordingRoles) of(userID int) map[int]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roles[userID]
+}
+
+// scimTest serves the SCIM API the way the routes do, against a fresh
+// database, with the auth service that logins and sessions go through.
+type scimTest struct {
+	t       *testing.T
+	handler http.Handler
+	auth    *auth.AuthService
+	roles   *recordingRoles
+}
+
+func newSCIMTest(t *testing.T) *scimTest {
+	t.Helper()
+	configtest.SQLite(t)
+	t.Setenv("JWT_SECRET", "test-secret")
+	auth.InitJWT()
+	scimCfg := config.SCIM
+	t.Cleanup(func() { config.SCIM = scimCfg })
+	config.SCIM = config.SCIMConfig{
+		Token:      testToken,
+		GroupRoles: []config.GroupRole{{Group: "Admins", OrgID: 7, Role: "owner"}},
+	}
+
+	st := &scimTest{t: t, roles: &recordingRoles{roles: map[int]map[int]string{}}}
+	st.auth = auth.NewAuthService(nil, nil, st.roles, []auth.Authenticator{auth.NewLocalAuthenticator()})
+	s, err := NewService(st.roles, st.auth, events.NewBus(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(s)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+usersPath, h.ListUsers)
+	mux.HandleFunc("POST "+usersPath, h.CreateUser)
+	mux.HandleFunc("GET "+usersPath+"/{id}", h.GetUser)
+	mux.HandleFunc("PUT "+usersPath+"/{id}", h.ReplaceUser)
+	mux.HandleFunc("PATCH "+usersPath+"/{id}", h.PatchUser)
+	mux.HandleFunc("DELETE "+usersPath+"/{id}", h.DeleteUser)
+	mux.HandleFunc("GET "+groupsPath, h.ListGroups)
+	mux.HandleFunc("POST "+groupsPath, h.CreateGroup)
+	mux.HandleFunc("GET "+groupsPath+"/{id}", h.GetGroup)
+	mux.HandleFunc("PATCH "+groupsPath+"/{id}", h.PatchGroup)
+	st.handler = RequireToken(mux)
+	return st
+}
+
+// do sends a request with the SCIM token and decodes the response into
+// out, if given, when it has the wanted status.
+func (st *scimTest) do(method, path, body string, want int, out any) {
+	st.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	st.handler.ServeHTTP(rec, req)
+	if rec.Code != want {
+		st.t.Fatalf("%s %s = %d %s, want %d", method, path, rec.Code, rec.Body, want)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			st.t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+}
+
+func (st *scimTest) createUser(body string) User {
+	st.t.Helper()
+	var u User
+	st.do(http.MethodPost, usersPath, body, http.StatusCreated, &u)
+	return u
+}
+
+func userID(t *testing.T, u User) int {
+	t.Helper()
+	id, err := strconv.Atoi(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestRequireTokenRefusesOtherTokens(t *testing.T) {
+	st := newSCIMTest(t)
+	for _, header := range []string{"", "Bearer", "Bearer wrong", "Basic " + testToken, "Bearer " + testToken + "x"} {
+		req := httptest.NewRequest(http.MethodGet, usersPath, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		st.handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q = %d, want 401 with a challenge", header, rec.Code)
+		}
+	}
+	st.do(http.MethodGet, usersPath, "", http.StatusOK, nil)
+}
+
+func TestListUsersFilters(t *testing.T) {
+	st := newSCIMTest(t)
+	st.createUser(`{"userName": "Alice", "externalId": "ext-a", "emails": [{"value": "alice@example.com", "primary": true}]}`)
+	st.createUser(`{"userName": "bob", "externalId": "ext-b"}`)
+
+	for filter, want := range map[string]string{
+		``:                      "",
+		`userName eq "alice"`:   "Alice",
+		`externalId eq "ext-b"`: "bob",
+		`emails[type eq "work"].value eq "ALICE@example.com"`: "Alice",
+		`userName eq "carol"`: "-",
+	} {
+		var list ListResponse[User]
+		st.do(http.MethodGet, usersPath+"?filter="+url.QueryEscape(filter), "", http.StatusOK, &list)
+		var names []string
+		for _, u := range list.Resources {
+			names = append(names, u.UserName)
+		}
+		switch want {
+		case "":
+			if list.TotalResults != 2 || len(names) != 2 {
+				t.Errorf("no filter found %v of %d, want both users", names, list.TotalResults)
+			}
+		case "-":
+			if list.TotalResults != 0 || len(names) != 0 {
+				t.Errorf("filter %q found %v, want nobody", filter, names)
+			}
+		default:
+			if list.TotalResults != 1 || len(names) != 1 || names[0] != want {
+				t.Errorf("filter %q found %v of %d, want [%s]", filter, names, list.TotalResults, want)
+			}
+		}
+	}
+
+	var scimErr Error
+	st.do(http.MethodGet, usersPath+"?filter="+url.QueryEscape(`userName sw "a"`), "", http.StatusBadRequest, &scimErr)
+	if scimErr.ScimType != "invalidFilter" || scimErr.Status != "400" {
+		t.Fatalf("unsupported filter error = %+v, want a 400 invalidFilter", scimErr)
+	}
+
+	var page ListResponse[User]
+	st.do(http.MethodGet, usersPath+"?startIndex=2&count=1", "", http.StatusOK, &page)
+	if page.TotalResults != 2 || page.StartIndex != 2 || page.ItemsPerPage != 1 || page.Resources[0].UserName != "bob" {
+		t.Fatalf("second page = %+v, want bob of 2", page)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	st := newSCIMTest(t)
+	u := st.createUser(`{"userName": "alice", "displayName": "Alice", "externalId": "ext-a"}`)
+	path := usersPath + "/" + u.ID
+
+	var got User
+	st.do(http.MethodPatch, path, `{"Operations": [
+		{"op": "Replace", "path": "displayName", "value": "Alice Liddell"},
+		{"op": "add", "path": "emails[type eq \"work\"].value", "value": "alice@example.com"},
+		{"op": "remove", "path": "externalId"}
+	]}`, http.StatusOK, &got)
+	if got.DisplayName != "Alice Liddell" || got.ExternalID != "" || len(got.Emails) != 1 || got.Emails[0].Value != "alice@example.com" {
+		t.Fatalf("after patch with paths: %+v", got)
+	}
+
+	// Without a path the value holds the attributes, as Entra ID sends them.
+	st.do(http.MethodPatch, path, `{"Operations": [
+		{"op": "replace", "value": {"userName": " alice2 ", "active": "False", "name.givenName": "ignored"}}
+	]}`, http.StatusOK, &got)
+	if got.UserName != "alice2" || got.Active == nil || *got.Active {
+		t.Fatalf("after patch without a path: %+v", got)
+	}
+
+	for body, scimType := range map[string]string{
+		`{"Operations": [{"op": "remove", "path": "userName"}]}`:              "mutability",
+		`{"Operations": [{"op": "remove"}]}`:                                  "noTarget",
+		`{"Operations": [{"op": "move", "path": "displayName"}]}`:             "invalidValue",
+		`{"Operations": [{"op": "replace", "path": "active", "value": "y"}]}`: "invalidValue",
+		`{"Operations": [{"op": "replace", "value": "alice"}]}`:               "invalidValue",
+		`{"Operations": [`: "invalidSyntax",
+	} {
+		var scimErr Error
+		st.do(http.MethodPatch, path, body, http.StatusBadRequest, &scimErr)
+		if scimErr.ScimType != scimType {
+			t.Errorf("patch %s: scimType %q, want %q", body, scimErr.ScimType, scimType)
+		}
+	}
+
+	// A failed patch changes nothing, even its operations that were valid.
+	st.do(http.MethodPatch, path, `{"Operations": [
+		{"op": "replace", "path": "displayName", "value": "Changed"},
+		{"op": "remove", "path": "userName"}
+	]}`, http.StatusBadRequest, nil)
+	st.do(http.MethodGet, path, "", http.StatusOK, &got)
+	if got.DisplayName != "Alice Liddell" {
+		t.Fatalf("displayName = %q after a failed patch", got.DisplayName)
+	}
+
+	st.createUser(`{"userName": "bob"}`)
+	var scimErr Error
+	st.do(http.MethodPatch, path, `{"Operations": [{"op": "replace", "path": "userName", "value": "BOB"}]}`, http.StatusConflict, &scimErr)
+	if scimErr.ScimType != "uniqueness" {
+		t.Fatalf("renaming onto bob: scimType %q, want uniqueness", scimErr.ScimType)
+	}
+	st.do(http.MethodPatch, usersPath+"/999", `{"Operations": []}`, http.StatusNotFound, nil)
+	st.do(http.MethodPatch, usersPath+"/abc", `{"Operations": []}`, http.StatusNotFound, nil)
+}
+
+func TestPatchGroupMembersSyncsRoles(t *testing.T) {
+	st := newSCIMTest(t)
+	alice := st.createUser(`{"userName": "alice"}`)
+	bob := st.createUser(`{"userName": "bob"}`)
+	aliceID, bobID := userID(t, alice), userID(t, bob)
+
+	var g Group
+	st.do(http.MethodPost, groupsPath, `{"displayName": "admins"}`, http.StatusCreated, &g)
+	path := groupsPath + "/" + g.ID
+	owner, none := map[int]string{7: "owner"}, map[int]string{7: ""}
+
+	st.do(http.MethodPatch, path, `{"Operations": [
+		{"op": "add", "path": "members", "value": [{"value": "`+alice.ID+`"}, {"value": "`+bob.ID+`"}]}
+	]}`, http.StatusOK, &g)
+	if len(g.Members) != 2 || !maps.Equal(st.roles.of(aliceID), owner) || !maps.Equal(st.roles.of(bobID), owner) {
+		t.Fatalf("after adding both: members %v, roles %v and %v", g.Members, st.roles.of(aliceID), st.roles.of(bobID))
+	}
+
+	st.do(http.MethodPatch, path, `{"Operations": [
+		{"op": "remove", "path": "members[value eq \"`+alice.ID+`\"]"}
+	]}`, http.StatusOK, &g)
+	if len(g.Members) != 1 || g.Members[0].Value != bob.ID || !maps.Equal(st.roles.of(aliceID), none) {
+		t.Fatalf("after removing alice: members %v, her roles %v", g.Members, st.roles.of(aliceID))
+	}
+
+	// Renaming the group out of the mapping takes the role away.
+	st.do(http.MethodPatch, path, `{"Operations": [{"op": "replace", "value": {"displayName": "readers"}}]}`, http.StatusOK, &g)
+	if g.DisplayName != "readers" || !maps.Equal(st.roles.of(bobID), none) {
+		t.Fatalf("after renaming: %q, bob's roles %v", g.DisplayName, st.roles.of(bobID))
+	}
+
+	var scimErr Error
+	st.do(http.MethodPatch, path, `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "999"}]}]}`, http.StatusBadRequest, &scimErr)
+	if scimErr.ScimType != "invalidValue" {
+		t.Fatalf("adding a missing user: scimType %q, want invalidValue", scimErr.ScimType)
+	}
+	// No members are omitted from the response, so it needs a fresh Group.
+	var emptied Group
+	st.do(http.MethodPatch, path, `{"Operations": [{"op": "remove", "path": "members"}]}`, http.StatusOK, &emptied)
+	if len(emptied.Members) != 0 || !maps.Equal(st.roles.of(bobID), none) {
+		t.Fatalf("removing all members left %v", emptied.Members)
+	}
+}
+
+func TestDeactivatedUserLosesSessionAndLogin(t *testing.T) {
+	st := newSCIMTest(t)
+	ctx := context.Background()
+	u := st.createUser(`{"userName": "alice", "password": "password123"}`)
+	path := usersPath + "/" + u.ID
+
+	login, err := st.auth.Authenticate(ctx, "alice", "password123")
+	if err != nil {
+		t.Fatalf("login as a provisioned user: %v", err)
+	}
+	token, err := auth.GenerateToken(ctx, login.ID, login.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := st.auth.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	session := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/workspaces", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := session(); code != http.StatusNoContent {
+		t.Fatalf("request in the session = %d, want 204", code)
+	}
+
+	// The session is refused at once on this instance, despite the cache.
+	st.do(http.MethodPatch, path, `{"Operations": [{"op": "replace", "path": "active", "value": false}]}`, http.StatusOK, nil)
+	if code := session(); code != http.StatusUnauthorized {
+		t.Fatalf("request after deactivation = %d, want 401", code)
+	}
+	if _, err := st.auth.Authenticate(ctx, "alice", "password123"); !errors.Is(err, auth.ErrDeactivated) {
+		t.Fatalf("login after deactivation err = %v, want ErrDeactivated", err)
+	}
+
+	st.do(http.MethodPatch, path, `{"Operations": [{"op": "replace", "value": {"active": true}}]}`, http.StatusOK, nil)
+	if code := session(); code != http.StatusNoContent {
+		t.Fatalf("request after reactivation = %d, want 204", code)
+	}
+	if _, err := st.auth.Authenticate(ctx, "alice", "password123"); err != nil {
+		t.Fatalf("login after reactivation: %v", err)
+	}
+
+	st.do(http.MethodDelete, path, "", http.StatusNoContent, nil)
+	if code := session(); code != http.StatusUnauthorized {
+		t.Fatalf("request after deletion = %d, want 401", code)
+	}
+	// The username is freed, so there is no account to log in to.
+	if _, err := st.auth.Authenticate(ctx, "alice", "password123"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("login after deletion err = %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,446 @@
+package scim
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+// Repository encapsulates all DB operations for SCIM users and groups.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+// Queries are written with $N placeholders, which both drivers accept;
+// SQLite binds them in the order they first appear, so they must appear in
+// order.
+type Repository struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+}
+
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
+}
+
+func NewDefaultRepository() *Repository {
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
+}
+
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// userRecord is a row of the users table. Optional columns read as "".
+type userRecord struct {
+	ID          int
+	UserName    string
+	ExternalID  string
+	DisplayName string
+	Email       string
+	Active      bool
+}
+
+type groupRecord struct {
+	ID          int
+	DisplayName string
+	ExternalID  string
+}
+
+// ref is a user or group listed by another resource.
+type ref struct {
+	ID      int
+	Display string
+}
+
+// condition narrows a list to rows where an SQL expression over $1 holds;
+// the zero value matches every row.
+type condition struct {
+	expr  string
+	value string
+}
+
+const userColumns = `id, username, COALESCE(external_id, ''), COALESCE(display_name, ''), COALESCE(email, ''), active`
+
+func scanUser(row rowScanner) (*userRecord, error) {
+	u := &userRecord{}
+	if err := row.Scan(&u.ID, &u.UserName, &u.ExternalID, &u.DisplayName, &u.Email, &u.Active); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+const groupColumns = `id, display_name, COALESCE(external_id, '')`
+
+func scanGroup(row rowScanner) (*groupRecord, error) {
+	g := &groupRecord{}
+	if err := row.Scan(&g.ID, &g.DisplayName, &g.ExternalID); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ListUsers returns a page of the users that match cond, skipping offset,
+// and the number that match in all. Deleted users are never listed.
+func (r *Repository) ListUsers(ctx context.Context, cond condition, offset, limit int) ([]userRecord, int, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "ListUsers")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "ListUsers")()
+
+	var list []userRecord
+	total, err := r.list(ctx, "users", "deleted_at IS NULL", userColumns, cond, offset, limit, func(row rowScanner) error {
+		u, err := scanUser(row)
+		if err == nil {
+			list = append(list, *u)
+		}
+		return err
+	})
+	return list, total, err
+}
+
+// FindUser returns the user with the given ID, or nil if there is none or
+// they were deleted.
+func (r *Repository) FindUser(ctx context.Context, id int) (*userRecord, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "FindUser")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "FindUser")()
+	u, err := scanUser(r.queryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 AND deleted_at IS NULL`, id))
+	if isNoRows(err) {
+		return nil, nil
+	}
+	return u, err
+}
+
+// UserTaken reports which of userName (ignoring case) and externalID
+// already belong to a user other than exceptID: "userName", "externalId"
+// or "".
+func (r *Repository) UserTaken(ctx context.Context, userName, externalID string, exceptID int) (string, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "UserTaken")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "UserTaken")()
+	var n int
+	err := r.queryRow(ctx, `SELECT COUNT(*) FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2`, userName, exceptID).Scan(&n)
+	if err != nil || n > 0 {
+		return "userName", err
+	}
+	if externalID == "" {
+		return "", nil
+	}
+	err = r.queryRow(ctx, `SELECT COUNT(*) FROM users WHERE external_id = $1 AND id <> $2`, externalID, exceptID).Scan(&n)
+	if err != nil || n > 0 {
+		return "externalId", err
+	}
+	return "", nil
+}
+
+// CreateUser inserts u and sets its ID. passwordHash is stored as is; an
+// empty one means the user can only log in through single sign-on or LDAP.
+func (r *Repository) CreateUser(ctx context.Context, u *userRecord, passwordHash string) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "CreateUser")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "CreateUser")()
+	id, err := r.insert(ctx, `
+		INSERT INTO users (username, password, email, display_name, active, external_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, u.UserName, passwordHash, nullable(u.Email), nullable(u.DisplayName), u.Active, nullable(u.ExternalID))
+	if err != nil {
+		return err
+	}
+	u.ID = id
+	return nil
+}
+
+// UpdateUser saves u. The password is only changed when a passwordHash is
+// given.
+func (r *Repository) UpdateUser(ctx context.Context, u *userRecord, passwordHash string) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "UpdateUser")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "UpdateUser")()
+	_, err := r.exec(ctx, `
+		UPDATE users
+		SET username = $1, email = $2, display_name = $3, active = $4, external_id = $5,
+		    password = CASE WHEN $6 = '' THEN password ELSE $6 END
+		WHERE id = $7 AND deleted_at IS NULL
+	`, u.UserName, nullable(u.Email), nullable(u.DisplayName), u.Active, nullable(u.ExternalID), passwordHash, u.ID)
+	return err
+}
+
+// DeleteUser deactivates the user and marks them deleted. The row is kept
+// because workspaces and other records point at it; the username is
+// renamed and any single sign-on link dropped so that it can be provisioned
+// again.
+func (r *Repository) DeleteUser(ctx context.Context, id int, userName string, now time.Time) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "DeleteUser")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "DeleteUser")()
+	if _, err := r.exec(ctx, `DELETE FROM scim_group_members WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+	_, err := r.exec(ctx, `
+		UPDATE users
+		SET username = $1, active = $2, external_id = NULL, auth_source = NULL, auth_subject = NULL, deleted_at = $3
+		WHERE id = $4
+	`, "deleted:"+strconv.Itoa(id)+":"+userName, false, now, id)
+	return err
+}
+
+// UserGroups lists the groups the user is a member of.
+func (r *Repository) UserGroups(ctx context.Context, userID int) ([]ref, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "UserGroups")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "UserGroups")()
+	return r.refs(ctx, `
+		SELECT g.id, g.display_name
+		FROM scim_groups g JOIN scim_group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.id
+	`, userID)
+}
+
+// ListGroups returns a page of the groups that match cond, skipping offset,
+// and the number that match in all.
+func (r *Repository) ListGroups(ctx context.Context, cond condition, offset, limit int) ([]groupRecord, int, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "ListGroups")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "ListGroups")()
+
+	var list []groupRecord
+	total, err := r.list(ctx, "scim_groups", "1 = 1", groupColumns, cond, offset, limit, func(row rowScanner) error {
+		g, err := scanGroup(row)
+		if err == nil {
+			list = append(list, *g)
+		}
+		return err
+	})
+	return list, total, err
+}
+
+// FindGroup returns the group with the given ID, or nil if there is none.
+func (r *Repository) FindGroup(ctx context.Context, id int) (*groupRecord, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "FindGroup")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "FindGroup")()
+	g, err := scanGroup(r.queryRow(ctx, `SELECT `+groupColumns+` FROM scim_groups WHERE id = $1`, id))
+	if isNoRows(err) {
+		return nil, nil
+	}
+	return g, err
+}
+
+// GroupTaken reports which of displayName and externalID already belong to
+// a group other than exceptID: "displayName", "externalId" or "".
+func (r *Repository) GroupTaken(ctx context.Context, displayName, externalID string, exceptID int) (string, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "GroupTaken")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "GroupTaken")()
+	var n int
+	err := r.queryRow(ctx, `SELECT COUNT(*) FROM scim_groups WHERE display_name = $1 AND id <> $2`, displayName, exceptID).Scan(&n)
+	if err != nil || n > 0 {
+		return "displayName", err
+	}
+	if externalID == "" {
+		return "", nil
+	}
+	err = r.queryRow(ctx, `SELECT COUNT(*) FROM scim_groups WHERE external_id = $1 AND id <> $2`, externalID, exceptID).Scan(&n)
+	if err != nil || n > 0 {
+		return "externalId", err
+	}
+	return "", nil
+}
+
+// CreateGroup inserts g and sets its ID.
+func (r *Repository) CreateGroup(ctx context.Context, g *groupRecord) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "CreateGroup")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "CreateGroup")()
+	id, err := r.insert(ctx, `
+		INSERT INTO scim_groups (display_name, external_id)
+		VALUES ($1, $2)
+	`, g.DisplayName, nullable(g.ExternalID))
+	if err != nil {
+		return err
+	}
+	g.ID = id
+	return nil
+}
+
+func (r *Repository) UpdateGroup(ctx context.Context, g *groupRecord) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "UpdateGroup")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "UpdateGroup")()
+	_, err := r.exec(ctx, `UPDATE scim_groups SET display_name = $1, external_id = $2 WHERE id = $3`,
+		g.DisplayName, nullable(g.ExternalID), g.ID)
+	return err
+}
+
+// DeleteGroup deletes the group and its memberships.
+func (r *Repository) DeleteGroup(ctx context.Context, id int) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "DeleteGroup")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "DeleteGroup")()
+	// SQLite does not enforce the ON DELETE CASCADE.
+	if _, err := r.exec(ctx, `DELETE FROM scim_group_members WHERE group_id = $1`, id); err != nil {
+		return err
+	}
+	_, err := r.exec(ctx, `DELETE FROM scim_groups WHERE id = $1`, id)
+	return err
+}
+
+// GroupMembers lists the users in the group.
+func (r *Repository) GroupMembers(ctx context.Context, groupID int) ([]ref, error) {
+	ctx, span := tracing.StartDB(ctx, "scim", "GroupMembers")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "GroupMembers")()
+	return r.refs(ctx, `
+		SELECT u.id, u.username
+		FROM users u JOIN scim_group_members m ON m.user_id = u.id
+		WHERE m.group_id = $1 AND u.deleted_at IS NULL
+		ORDER BY u.id
+	`, groupID)
+}
+
+func (r *Repository) AddMember(ctx context.Context, groupID, userID int) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "AddMember")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "AddMember")()
+	_, err := r.exec(ctx, `
+		INSERT INTO scim_group_members (group_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`, groupID, userID)
+	return err
+}
+
+func (r *Repository) RemoveMember(ctx context.Context, groupID, userID int) error {
+	ctx, span := tracing.StartDB(ctx, "scim", "RemoveMember")
+	defer span.End()
+	defer metrics.ObserveDB("scim", "RemoveMember")()
+	_, err := r.exec(ctx, `DELETE FROM scim_group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID)
+	return err
+}
+
+// list runs the count and page queries of ListUsers and ListGroups.
+func (r *Repository) list(ctx context.Context, table, where, columns string, cond condition, offset, limit int, scan func(rowScanner) error) (int, error) {
+	var args []any
+	if cond.expr != "" {
+		where += " AND " + cond.expr
+		args = append(args, cond.value)
+	}
+
+	var total int
+	if err := r.queryRow(ctx, `SELECT COUNT(*) FROM `+table+` WHERE `+where, args...).Scan(&total); err != nil {
+		return 0, err
+	}
+	if limit == 0 || offset >= total {
+		return total, nil
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY id LIMIT $%d OFFSET $%d`,
+		columns, table, where, len(args)+1, len(args)+2)
+	return total, r.query(ctx, query, append(args, limit, offset), scan)
+}
+
+func (r *Repository) refs(ctx context.Context, query string, args ...any) ([]ref, error) {
+	var list []ref
+	err := r.query(ctx, query, args, func(row rowScanner) error {
+		var x ref
+		if err := row.Scan(&x.ID, &x.Display); err != nil {
+			return err
+		}
+		list = append(list, x)
+		return nil
+	})
+	return list, err
+}
+
+// query calls scan for each row of the result.
+func (r *Repository) query(ctx context.Context, query string, args []any, scan func(rowScanner) error) error {
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}
+
+	rows, err := r.sqlDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *Repository) queryRow(ctx context.Context, query string, args ...any) rowScanner {
+	if config.DBDriver == "postgres" {
+		return r.pgxPool.QueryRow(ctx, query, args...)
+	}
+	return r.sqlDB.QueryRowContext(ctx, query, args...)
+}
+
+// insert runs an INSERT and returns the new row's ID.
+func (r *Repository) insert(ctx context.Context, query string, args ...any) (int, error) {
+	if config.DBDriver == "postgres" {
+		var id int
+		err := r.pgxPool.QueryRow(ctx, query+` RETURNING id`, args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := r.sqlDB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// exec reports whether the statement affected any row.
+func (r *Repository) exec(ctx context.Context, query string, args ...any) (bool, error) {
+	if config.DBDriver == "postgres" {
+		tag, err := r.pgxPool.Exec(ctx, query, args...)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+
+	res, err := r.sqlDB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// nullable stores "" as NULL, so that unique columns allow many blanks.
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows)
+}
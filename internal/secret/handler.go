@@ -0,0 +1,133 @@
+package secret
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{service: s}
+}
+
+// GET /workspaces/{id}/secrets?limit=&cursor=&sort=&name=
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	p, err := pagination.Parse(r, Sorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.List(r.Context(), wsID, auth.GetUserID(r), p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GET /workspaces/{id}/secrets/{name}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	sec, err := h.service.Get(r.Context(), wsID, r.PathValue("name"), auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sec)
+}
+
+// PUT /workspaces/{id}/secrets/{name} creates or updates a secret.
+func (h *Handler) Set(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var body SetRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	sec, created, err := h.service.Set(r.Context(), wsID, r.PathValue("name"), body.Value, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, sec)
+}
+
+// POST /workspaces/{id}/secrets/{name}/rotate
+func (h *Handler) Rotate(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var body RotateRequest
+	if r.ContentLength != 0 {
+		if err := apierror.DecodeJSON(r, &body); err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+	}
+
+	sec, err := h.service.Rotate(r.Context(), wsID, r.PathValue("name"), body.Value, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sec)
+}
+
+// DELETE /workspaces/{id}/secrets/{name}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), wsID, r.PathValue("name"), auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "secret deleted"})
+}
+
+// pathID parses the {id} workspace path value, writing a 400 if it is not a
+// number.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid workspace id"))
+		return 0, false
+	}
+	logging.SetWorkspaceID(r.Context(), id)
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
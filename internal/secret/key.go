@@ -0,0 +1,139 @@
+package secret
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+const keySize = 32
+
+// storeKey encrypts secret values at rest (AES-256-GCM).
+var storeKey []byte
+
+// InitKey loads the store key from config.Secrets.KeyFile, generating and
+// persisting a new one on first start.
+func InitKey() error {
+	key, err := loadOrCreateKey(config.Secrets.KeyFile)
+	if err != nil {
+		return err
+	}
+	storeKey = key
+	return nil
+}
+
+// CheckKey reports whether the store key is loaded and still on disk. A lost
+// key file would make the next start unable to read any stored value.
+func CheckKey(ctx context.Context) error {
+	if storeKey == nil {
+		return errors.New("secret store key not loaded")
+	}
+	data, err := os.ReadFile(config.Secrets.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read secret store key: %w", err)
+	}
+	key, err := parseKey(data, config.Secrets.KeyFile)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(key, storeKey) != 1 {
+		return errors.New("secret store key file changed since start")
+	}
+	return nil
+}
+
+// loadOrCreateKey reads a base64-encoded 32-byte key from path. If the file
+// does not exist a new key is generated and written with mode 0600.
+func loadOrCreateKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if dir := filepath.Dir(path); dir != "" {
+			if err := os.MkdirAll(dir, 0o700); err != nil {
+				return nil, err
+			}
+		}
+		out := base64.StdEncoding.EncodeToString(key) + "\n"
+		if err := os.WriteFile(path, []byte(out), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write secret store key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret store key: %w", err)
+	}
+	return parseKey(data, path)
+}
+
+func parseKey(data []byte, path string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("secret store key %s is not a base64-encoded %d-byte key", path, keySize)
+	}
+	return key, nil
+}
+
+// seal encrypts a value. The workspace and name are bound in as additional
+// data, so a sealed value copied to another row does not open.
+func seal(workspaceID int, name, value string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), additionalData(workspaceID, name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value sealed by seal.
+func open(workspaceID int, name, sealed string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("secret %q is not a sealed value", name)
+	}
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, additionalData(workspaceID, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %q: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	if storeKey == nil {
+		return nil, errors.New("secret store key not loaded")
+	}
+	block, err := aes.NewCipher(storeKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func additionalData(workspaceID int, name string) []byte {
+	b := []byte("secretlane-secret:v1:")
+	b = strconv.AppendInt(b, int64(workspaceID), 10)
+	b = append(b, ':')
+	return append(b, name...)
+}
@@ -0,0 +1,27 @@
+package secret
+
+import "time"
+
+// Secret is a named value in a workspace. Value is only filled in when a
+// single secret is read; lists carry names and versions alone.
+type Secret struct {
+	ID          int       `json:"id"`
+	WorkspaceID int       `json:"workspace_id"`
+	Name        string    `json:"name"`
+	Value       string    `json:"value,omitempty"`
+	Version     int       `json:"version"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SetRequest is the body for creating or updating a secret.
+type SetRequest struct {
+	Value string `json:"value"`
+}
+
+// RotateRequest is the body for rotating a secret. An empty Value makes the
+// server generate a random one.
+type RotateRequest struct {
+	Value string `json:"value,omitempty"`
+}
@@ -0,0 +1,190 @@
+package secret
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+// Repository encapsulates all DB operations for secrets. Values go in and
+// come out sealed; the service encrypts and decrypts them.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+// Queries are written with $N placeholders, which both drivers accept.
+type Repository struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+}
+
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
+}
+
+func NewDefaultRepository() *Repository {
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
+}
+
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const secretColumns = `id, workspace_id, name, value, version, created_by, created_at, updated_at`
+
+func scanSecret(row rowScanner) (*Secret, error) {
+	s := &Secret{}
+	if err := row.Scan(&s.ID, &s.WorkspaceID, &s.Name, &s.Value, &s.Version, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListPage returns one page of a workspace's secrets, plus one extra row if
+// there are more (see pagination.NewPage).
+func (r *Repository) ListPage(ctx context.Context, workspaceID int, p pagination.Params) ([]Secret, error) {
+	ctx, span := tracing.StartDB(ctx, "secret", "ListPage")
+	defer span.End()
+	defer metrics.ObserveDB("secret", "ListPage")()
+	where, tail, args := p.Query([]any{workspaceID}, "name")
+	return r.query(ctx, `
+		SELECT `+secretColumns+` FROM secrets
+		WHERE workspace_id = $1`+where+tail, args...)
+}
+
+// All returns every secret of a workspace.
+func (r *Repository) All(ctx context.Context, workspaceID int) ([]Secret, error) {
+	ctx, span := tracing.StartDB(ctx, "secret", "All")
+	defer span.End()
+	defer metrics.ObserveDB("secret", "All")()
+	return r.query(ctx, `
+		SELECT `+secretColumns+` FROM secrets
+		WHERE workspace_id = $1 ORDER BY name
+	`, workspaceID)
+}
+
+// Find returns the named secret of a workspace, or nil if there is none.
+func (r *Repository) Find(ctx context.Context, workspaceID int, name string) (*Secret, error) {
+	ctx, span := tracing.StartDB(ctx, "secret", "Find")
+	defer span.End()
+	defer metrics.ObserveDB("secret", "Find")()
+	s, err := scanSecret(r.queryRow(ctx, `
+		SELECT `+secretColumns+` FROM secrets
+		WHERE workspace_id = $1 AND name = $2
+	`, workspaceID, name))
+	if isNoRows(err) {
+		return nil, nil
+	}
+	return s, err
+}
+
+// Create inserts s at version 1 and sets its ID.
+func (r *Repository) Create(ctx context.Context, s *Secret) error {
+	ctx, span := tracing.StartDB(ctx, "secret", "Create")
+	defer span.End()
+	defer metrics.ObserveDB("secret", "Create")()
+	s.Version = 1
+	return r.queryRow(ctx, `
+		INSERT INTO secrets (workspace_id, name, value, version, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, s.WorkspaceID, s.Name, s.Value, s.Version, s.CreatedBy, s.CreatedAt, s.UpdatedAt).Scan(&s.ID)
+}
+
+// Update replaces the value of a secret and returns its new version. ok is
+// false if the secret does not exist.
+func (r *Repository) Update(ctx context.Context, workspaceID int, name, value string, now time.Time) (version int, ok bool, err error) {
+	ctx, span := tracing.StartDB(ctx, "secret", "Update")
+	defer span.End()
+	defer metrics.ObserveDB("secret", "Update")()
+	err = r.queryRow(ctx, `
+		UPDATE secrets SET value = $1, version = version + 1, updated_at = $2
+		WHERE workspace_id = $3 AND name = $4
+		RETURNING version
+	`, value, now, workspaceID, name).Scan(&version)
+	if isNoRows(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return version, true, nil
+}
+
+// Delete reports whether the secret existed.
+func (r *Repository) Delete(ctx context.Context, workspaceID int, name string) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "secret", "Delete")
+	defer span.End()
+	defer metrics.ObserveDB("secret", "Delete")()
+	if config.DBDriver == "postgres" {
+		tag, err := r.pgxPool.Exec(ctx, `DELETE FROM secrets WHERE workspace_id = $1 AND name = $2`, workspaceID, name)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+
+	res, err := r.sqlDB.ExecContext(ctx, `DELETE FROM secrets WHERE workspace_id = $1 AND name = $2`, workspaceID, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *Repository) query(ctx context.Context, query string, args ...any) ([]Secret, error) {
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Secret
+		for rows.Next() {
+			s, err := scanSecret(rows)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *s)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Secret
+	for rows.Next() {
+		s, err := scanSecret(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *s)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) queryRow(ctx context.Context, query string, args ...any) rowScanner {
+	if config.DBDriver == "postgres" {
+		return r.pgxPool.QueryRow(ctx, query, args...)
+	}
+	return r.sqlDB.QueryRowContext(ctx, query, args...)
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,260 @@
+package secret
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+// maxValueSize bounds a secret value; certificates and keys fit easily.
+const maxValueSize = 64 << 10
+
+var (
+	ErrForbidden = apierror.Forbidden("not allowed to access secrets in this workspace")
+	ErrNotFound  = apierror.NotFound("secret not found")
+
+	ErrWorkspaceInactive = errors.New("workspace is missing or in the trash")
+)
+
+// validName keeps names usable as environment variables and template keys.
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,127}$`)
+
+// Secrets belong to a workspace; any member of its organization may read
+// and change them. Values are encrypted with the store key before they
+// reach the database, and events about them never carry values.
+type Service struct {
+	repo       *Repository
+	workspaces *workspace.Service
+	events     *events.Bus
+}
+
+func NewService(workspaces *workspace.Service, bus *events.Bus) *Service {
+	return &Service{repo: NewDefaultRepository(), workspaces: workspaces, events: bus}
+}
+
+// Sorts are the sort fields of the secret list; created_at sorts by id.
+var Sorts = pagination.Sorts{
+	Columns: map[string]string{"name": "name", "created_at": "id"},
+	Default: "name",
+}
+
+// List returns a page of a workspace's secrets, without their values.
+func (s *Service) List(ctx context.Context, workspaceID, userID int, p pagination.Params) (pagination.Page[Secret], error) {
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return pagination.Page[Secret]{}, err
+	}
+
+	rows, err := s.repo.ListPage(ctx, workspaceID, p)
+	if err != nil {
+		return pagination.Page[Secret]{}, err
+	}
+	page := pagination.NewPage(rows, p, func(sec Secret) (string, int64) { return sec.Name, int64(sec.ID) })
+	for i := range page.Items {
+		page.Items[i].Value = ""
+	}
+	return page, nil
+}
+
+// Get returns a secret with its value.
+func (s *Service) Get(ctx context.Context, workspaceID int, name string, userID int) (*Secret, error) {
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	sec, err := s.repo.Find(ctx, workspaceID, name)
+	if err != nil {
+		return nil, err
+	}
+	if sec == nil {
+		return nil, ErrNotFound
+	}
+	if sec.Value, err = open(workspaceID, name, sec.Value); err != nil {
+		return nil, err
+	}
+	metrics.SecretRead(workspaceID, 1)
+	return sec, nil
+}
+
+// Set creates the secret or replaces its value. created reports which.
+func (s *Service) Set(ctx context.Context, workspaceID int, name, value string, userID int) (sec *Secret, created bool, err error) {
+	if err := validate(name, value); err != nil {
+		return nil, false, err
+	}
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return nil, false, err
+	}
+
+	sealed, err := seal(workspaceID, name, value)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now().UTC()
+
+	existing, err := s.repo.Find(ctx, workspaceID, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing == nil {
+		sec = &Secret{
+			WorkspaceID: workspaceID,
+			Name:        name,
+			Value:       sealed,
+			CreatedBy:   userID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := s.repo.Create(ctx, sec); err != nil {
+			return nil, false, err
+		}
+		sec.Value = ""
+		s.publish(events.SecretCreated, sec, userID)
+		return sec, true, nil
+	}
+
+	if existing.Version, err = s.update(ctx, workspaceID, name, sealed, now); err != nil {
+		return nil, false, err
+	}
+	existing.Value, existing.UpdatedAt = "", now
+	s.publish(events.SecretUpdated, existing, userID)
+	return existing, false, nil
+}
+
+// Rotate replaces the value of an existing secret, generating a random one
+// if value is empty, and returns the secret with its new value.
+func (s *Service) Rotate(ctx context.Context, workspaceID int, name, value string, userID int) (*Secret, error) {
+	if value == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		value = base64.RawURLEncoding.EncodeToString(raw)
+	}
+	if err := validate(name, value); err != nil {
+		return nil, err
+	}
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	sec, err := s.repo.Find(ctx, workspaceID, name)
+	if err != nil {
+		return nil, err
+	}
+	if sec == nil {
+		return nil, ErrNotFound
+	}
+	sealed, err := seal(workspaceID, name, value)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if sec.Version, err = s.update(ctx, workspaceID, name, sealed, now); err != nil {
+		return nil, err
+	}
+	sec.UpdatedAt = now
+	s.publish(events.SecretRotated, sec, userID)
+	sec.Value = value
+	return sec, nil
+}
+
+func (s *Service) Delete(ctx context.Context, workspaceID int, name string, userID int) error {
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+
+	ok, err := s.repo.Delete(ctx, workspaceID, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	s.events.Publish(events.Event{
+		Type:        events.SecretDeleted,
+		WorkspaceID: workspaceID,
+		ActorID:     userID,
+		Data:        map[string]any{"name": name},
+	})
+	return nil
+}
+
+// Secrets returns every secret of a workspace by name. It does no access
+// check: it serves agents, which are bound to their workspace. A workspace in
+// the trash serves none.
+func (s *Service) Secrets(workspaceID int) (map[string]string, error) {
+	ctx := context.Background()
+	active, err := s.workspaces.IsActive(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrWorkspaceInactive
+	}
+
+	rows, err := s.repo.All(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]string, len(rows))
+	for _, sec := range rows {
+		value, err := open(workspaceID, sec.Name, sec.Value)
+		if err != nil {
+			return nil, err
+		}
+		secrets[sec.Name] = value
+	}
+	return secrets, nil
+}
+
+// update stores a new sealed value and returns the new version. A secret
+// deleted since it was looked up is not found.
+func (s *Service) update(ctx context.Context, workspaceID int, name, sealed string, now time.Time) (int, error) {
+	version, ok, err := s.repo.Update(ctx, workspaceID, name, sealed, now)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return version, nil
+}
+
+func (s *Service) publish(eventType string, sec *Secret, userID int) {
+	s.events.Publish(events.Event{
+		Type:        eventType,
+		WorkspaceID: sec.WorkspaceID,
+		ActorID:     userID,
+		Data:        map[string]any{"name": sec.Name, "version": sec.Version},
+	})
+}
+
+func (s *Service) requireMember(ctx context.Context, workspaceID, userID int) error {
+	ok, err := s.workspaces.IsMember(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func validate(name, value string) error {
+	if !validName.MatchString(name) {
+		return apierror.Field("name", "must start with a letter or underscore and contain only letters, digits, _, . and - (at most 128 characters)")
+	}
+	if len(value) > maxValueSize {
+		return apierror.Field("value", fmt.Sprintf("must not exceed %d bytes", maxValueSize))
+	}
+	return nil
+}
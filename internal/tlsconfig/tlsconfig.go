@@ -0,0 +1,138 @@
+// Package tlsconfig builds the server's TLS settings from config.TLS and
+// reloads the certificate without a restart.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// CertReloader serves the certificate in certFile/keyFile and loads it again
+// on Reload, so that renewed certificates apply to new connections.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the key pair again. On error the previous one stays in use.
+func (c *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// WatchSIGHUP reloads the certificate whenever the process gets SIGHUP,
+// until ctx is done.
+func (c *CertReloader) WatchSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := c.Reload(); err != nil {
+				slog.Error("TLS reload failed, keeping the old certificate", "err", err)
+				continue
+			}
+			slog.Info("TLS certificate reloaded", "cert_file", c.certFile)
+		}
+	}
+}
+
+// Build returns the server TLS configuration and the reloader behind it.
+func Build(cfg config.TLSConfig) (*tls.Config, *CertReloader, error) {
+	certs, err := NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	switch cfg.ClientAuth {
+	case "", "none":
+		return tlsCfg, certs, nil
+	case "optional":
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, nil, fmt.Errorf("unknown tls.client_auth %q (want none, optional or require)", cfg.ClientAuth)
+	}
+
+	if cfg.ClientCAFile == "" {
+		return nil, nil, fmt.Errorf("tls.client_auth %q needs tls.client_ca_file", cfg.ClientAuth)
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	tlsCfg.ClientCAs = pool
+	return tlsCfg, certs, nil
+}
+
+// RedirectHandler sends every request to the same URL over HTTPS on
+// httpsPort.
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// RedirectAddr is the listen address of the HTTP-to-HTTPS redirect, or ""
+// if it is disabled.
+func RedirectAddr(cfg config.TLSConfig) string {
+	if cfg.RedirectPort == 0 {
+		return ""
+	}
+	return ":" + strconv.Itoa(cfg.RedirectPort)
+}
@@ -0,0 +1,123 @@
+// Package tracing sets up the OpenTelemetry SDK and has small helpers for
+// the spans the server records. Trace context arrives and leaves in the W3C
+// traceparent header. With no exporter configured the global provider stays
+// the no-op one, so spans cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amartya2002/secretlane/internal/config"
+)
+
+// shutdownTimeout bounds how long Run waits for the last spans to export.
+const shutdownTimeout = 10 * time.Second
+
+// Span kinds, re-exported so that callers need not import the trace API.
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+)
+
+var tracer = otel.Tracer("github.com/amartya2002/secretlane")
+
+// Provider exports the spans recorded while it runs.
+type Provider struct {
+	tp *sdktrace.TracerProvider
+}
+
+// Setup installs a tracer provider exporting as configured and returns it,
+// or nil if tracing is off. Run flushes it when its context is done.
+func Setup(cfg config.TracingConfig) (*Provider, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("tracing.exporter otlp needs tracing.endpoint")
+		}
+		exp, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	default:
+		return nil, fmt.Errorf("unknown tracing.exporter %q (want none, stdout or otlp)", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing.exporter %s: %w", cfg.Exporter, err)
+	}
+
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		// Follow the caller's sampling decision so traces stay whole.
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return &Provider{tp: tp}, nil
+}
+
+// Run waits until ctx is done, then exports what is left and shuts the
+// provider down.
+func (p *Provider) Run(ctx context.Context) {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := p.tp.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("failed to flush spans", "err", err)
+	}
+}
+
+// Start begins a span as a child of the span in ctx, or as the root of a
+// new trace. The returned context carries the span.
+func Start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// StartDB begins a span for a repository method.
+func StartDB(ctx context.Context, repository, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, repository+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", dbSystem()),
+			attribute.String("db.operation", method),
+		))
+}
+
+// SetError marks span failed. A nil err is ignored.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func dbSystem() string {
+	if config.DBDriver == "postgres" {
+		return "postgresql"
+	}
+	return "sqlite"
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// blockedNetworks are the addresses webhooks may not reach unless listed in
+// webhook.allowed_networks: loopback, private, link-local (which includes the
+// cloud metadata endpoint 169.254.169.254), carrier-grade NAT, multicast and
+// other special-purpose ranges.
+var blockedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// addressGuard decides which addresses deliveries may connect to.
+type addressGuard struct {
+	allowed []netip.Prefix
+}
+
+// newAddressGuard parses the CIDRs that are reachable despite falling in a
+// blocked range, such as a deploy pipeline on the internal network.
+func newAddressGuard(allowed []string) (*addressGuard, error) {
+	g := &addressGuard{}
+	for _, cidr := range allowed {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("webhook.allowed_networks: %q is not a CIDR", cidr)
+		}
+		g.allowed = append(g.allowed, p.Masked())
+	}
+	return g, nil
+}
+
+// permits reports whether addr may be reached.
+func (g *addressGuard) permits(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range g.allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	for _, p := range blockedNetworks {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// control is a net.Dialer Control hook. It runs after name resolution, on
+// the address actually dialed, so a hostname that resolves (or re-resolves)
+// to an internal address is refused too.
+func (g *addressGuard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !g.permits(addr) {
+		return fmt.Errorf("webhook target %s is in a blocked network", addr)
+	}
+	return nil
+}
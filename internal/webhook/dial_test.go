@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestAddressGuard(t *testing.T) {
+	guard, err := newAddressGuard([]string{"10.20.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"10.20.3.4", true},
+	} {
+		if got := guard.permits(netip.MustParseAddr(tc.addr)); got != tc.want {
+			t.Errorf("permits(%s) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+
+	if _, err := newAddressGuard([]string{"10.0.0.1"}); err == nil {
+		t.Error("newAddressGuard accepted an address without a prefix length")
+	}
+}
+
+func TestDispatcherRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivery reached a loopback server")
+	}))
+	defer srv.Close()
+
+	guard, err := newAddressGuard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(nil, guard)
+	// "localhost" only becomes a blocked address once it is resolved.
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	_, err = d.send(context.Background(), &Webhook{ID: 1, URL: url, Secret: "whsec_test"}, &Delivery{ID: 1, Payload: "{}"})
+	if err == nil || !strings.Contains(err.Error(), "blocked network") {
+		t.Fatalf("send err = %v, want blocked network", err)
+	}
+
+	// Listing the network lets the delivery through.
+	if guard, err = newAddressGuard([]string{"127.0.0.0/8", "::1/128"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	if _, err := NewDispatcher(nil, guard).send(context.Background(), &Webhook{ID: 1, URL: url, Secret: "whsec_test"}, &Delivery{ID: 1, Payload: "{}"}); err != nil {
+		t.Fatalf("send to allowed network: %v", err)
+	}
+}
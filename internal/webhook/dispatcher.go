@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/amartya2002/secretlane/internal/tracing"
+)
+
+const (
+	// maxAttempts is how many times a delivery is tried before it is marked failed.
+	maxAttempts = 8
+	// baseBackoff doubles after every failed attempt, up to maxBackoff.
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+
+	pollInterval   = 5 * time.Second
+	batchSize      = 20
+	dialTimeout    = 5 * time.Second
+	requestTimeout = 10 * time.Second
+	maxErrorLength = 500
+
+	// claimLease is how long a claimed batch is reserved for this
+	// dispatcher. It outlasts sending a whole batch, so a claim only lapses
+	// if the dispatcher died before recording the outcome.
+	claimLease = 5 * time.Minute
+)
+
+// Dispatcher sends pending deliveries and schedules retries with exponential
+// backoff. Several instances may run against one database; each delivery is
+// claimed by one of them before it is sent.
+type Dispatcher struct {
+	repo   *Repository
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewDispatcher sends deliveries through a client that refuses to connect
+// to addresses guard does not permit. Proxies are not used, since the
+// guard could then only check the proxy's address.
+func NewDispatcher(repo *Repository, guard *addressGuard) *Dispatcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: dialTimeout, Control: guard.control}).DialContext
+	return &Dispatcher{
+		repo:   repo,
+		client: &http.Client{Timeout: requestTimeout, Transport: transport},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Wake asks the dispatcher to look for due deliveries now.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.processDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) processDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := time.Now().UTC()
+		due, err := d.repo.ClaimDue(now, now.Add(claimLease), batchSize)
+		if err != nil {
+			slog.Error("failed to load due webhook deliveries", "err", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		for i := range due {
+			// The rest of the batch stays claimed until the lease lapses;
+			// trying again at once would spin on the same failure.
+			if err := d.attempt(ctx, &due[i]); err != nil {
+				slog.Error("failed to process webhook delivery", "delivery_id", due[i].ID, "err", err)
+				return
+			}
+		}
+	}
+}
+
+// attempt sends a delivery and records the outcome. It returns an error only
+// if the webhook cannot be loaded or the outcome cannot be saved; a failed
+// send is recorded and scheduled for a retry.
+func (d *Dispatcher) attempt(ctx context.Context, del *Delivery) error {
+	wh, err := d.repo.FindByID(del.WebhookID)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook %d: %w", del.WebhookID, err)
+	}
+
+	del.Attempts++
+	del.LastStatusCode = 0
+	del.LastError = ""
+
+	if wh == nil || !wh.Active {
+		del.Status = StatusFailed
+		del.NextAttemptAt = nil
+		del.LastError = "webhook deleted or inactive"
+	} else if code, err := d.send(ctx, wh, del); err == nil {
+		now := time.Now().UTC()
+		del.Status = StatusSucceeded
+		del.NextAttemptAt = nil
+		del.DeliveredAt = &now
+		del.LastStatusCode = code
+	} else {
+		del.LastStatusCode = code
+		del.LastError = truncate(err.Error(), maxErrorLength)
+		if del.Attempts >= maxAttempts {
+			del.Status = StatusFailed
+			del.NextAttemptAt = nil
+		} else {
+			next := time.Now().UTC().Add(backoff(del.Attempts))
+			del.NextAttemptAt = &next
+		}
+	}
+
+	if err := d.repo.SaveAttempt(del); err != nil {
+		return fmt.Errorf("failed to record attempt: %w", err)
+	}
+	return nil
+}
+
+// send posts the payload and returns the response status code. Any non-2xx
+// response is an error.
+func (d *Dispatcher) send(ctx context.Context, wh *Webhook, del *Delivery) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "webhook.deliver", tracing.KindClient)
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", code))
+		tracing.SetError(span, err)
+		span.End()
+	}()
+	span.SetAttributes(attribute.Int("webhook.id", wh.ID), attribute.Int("webhook.delivery_id", del.ID))
+
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "secretlane-webhooks/1")
+	req.Header.Set("X-Secretlane-Event", del.EventType)
+	req.Header.Set("X-Secretlane-Delivery", strconv.Itoa(del.ID))
+	_, signSpan := tracing.Start(ctx, "webhook.sign", tracing.KindInternal)
+	req.Header.Set("X-Secretlane-Signature", "sha256="+Sign(wh.Secret, body))
+	signSpan.End()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed with the webhook secret.
+// Receivers compare it to the X-Secretlane-Signature header (after "sha256=").
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func backoff(attempts int) time.Duration {
+	d := baseBackoff << (attempts - 1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
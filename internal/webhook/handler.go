@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{service: s}
+}
+
+// POST /webhooks
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var body CreateRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	logging.SetWorkspaceID(r.Context(), body.WorkspaceID)
+	wh, err := h.service.Create(r.Context(), body.WorkspaceID, body.URL, body.Events, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, wh)
+}
+
+// GET /webhooks?workspace_id=N&limit=&cursor=&sort=&name=
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	wsID, err := strconv.Atoi(r.URL.Query().Get("workspace_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Field("workspace_id", "query parameter is required"))
+		return
+	}
+	logging.SetWorkspaceID(r.Context(), wsID)
+	p, err := pagination.Parse(r, Sorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.List(r.Context(), wsID, auth.GetUserID(r), p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GET /webhooks/{id}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid webhook id")
+	if !ok {
+		return
+	}
+
+	wh, err := h.service.Get(r.Context(), id, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// DELETE /webhooks/{id}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid webhook id")
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "webhook deleted"})
+}
+
+// GET /webhooks/{id}/deliveries?limit=&cursor=&sort= (delivery log)
+func (h *Handler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid webhook id")
+	if !ok {
+		return
+	}
+	p, err := pagination.Parse(r, DeliverySorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.Deliveries(r.Context(), id, auth.GetUserID(r), p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// POST /webhooks/{id}/deliveries/{deliveryID}/redeliver
+func (h *Handler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id", "invalid webhook id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(w, r, "deliveryID", "invalid delivery id")
+	if !ok {
+		return
+	}
+
+	d, err := h.service.Redeliver(r.Context(), id, deliveryID, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+// pathID parses a numeric path value, writing a 400 with msg if it is not one.
+func pathID(w http.ResponseWriter, r *http.Request, name, msg string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(msg))
+		return 0, false
+	}
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import "time"
+
+// Webhook is an endpoint that receives signed change events for a workspace.
+// An empty Events list subscribes to every event type.
+type Webhook struct {
+	ID          int       `json:"id"`
+	WorkspaceID int       `json:"workspace_id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Secret      string    `json:"secret,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Delivery is one event sent (or to be sent) to a webhook, with the outcome
+// of its latest attempt.
+type Delivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// CreateRequest is the body of POST /webhooks.
+type CreateRequest struct {
+	WorkspaceID int      `json:"workspace_id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+}
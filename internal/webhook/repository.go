@@ -0,0 +1,357 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+// Repository encapsulates all DB operations for webhooks and their deliveries.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
+type Repository struct {
+	sqlDB   *sql.DB
+	pgxPool *pgxpool.Pool
+}
+
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
+}
+
+func NewDefaultRepository() *Repository {
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
+}
+
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const (
+	webhookColumns  = `id, workspace_id, url, events, secret, active, created_by, created_at`
+	deliveryColumns = `id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+		last_status_code, last_error, created_at, delivered_at`
+)
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	wh := &Webhook{}
+	var evts string
+	if err := row.Scan(&wh.ID, &wh.WorkspaceID, &wh.URL, &evts, &wh.Secret, &wh.Active, &wh.CreatedBy, &wh.CreatedAt); err != nil {
+		return nil, err
+	}
+	wh.Events = splitEvents(evts)
+	return wh, nil
+}
+
+func scanDelivery(row rowScanner) (*Delivery, error) {
+	d := &Delivery{}
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func splitEvents(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func (r *Repository) Create(wh *Webhook) error {
+	defer metrics.ObserveDB("webhook", "Create")()
+	evts := strings.Join(wh.Events, ",")
+
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			INSERT INTO webhooks (workspace_id, url, events, secret, active, created_by, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, wh.WorkspaceID, wh.URL, evts, wh.Secret, wh.Active, wh.CreatedBy, wh.CreatedAt)
+		return row.Scan(&wh.ID)
+	}
+
+	res, err := r.sqlDB.Exec(`
+		INSERT INTO webhooks (workspace_id, url, events, secret, active, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, wh.WorkspaceID, wh.URL, evts, wh.Secret, wh.Active, wh.CreatedBy, wh.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	wh.ID = int(id)
+	return nil
+}
+
+// FindByID returns the webhook with the given ID, or nil if it does not exist.
+func (r *Repository) FindByID(id int) (*Webhook, error) {
+	defer metrics.ObserveDB("webhook", "FindByID")()
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(),
+			`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+		wh, err := scanWebhook(row)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return wh, err
+	}
+
+	row := r.sqlDB.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+	wh, err := scanWebhook(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return wh, err
+}
+
+func (r *Repository) ListForWorkspace(workspaceID int) ([]Webhook, error) {
+	defer metrics.ObserveDB("webhook", "ListForWorkspace")()
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), `
+		SELECT `+webhookColumns+`
+		FROM webhooks WHERE workspace_id = $1
+		ORDER BY id
+		`, workspaceID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Webhook
+		for rows.Next() {
+			wh, err := scanWebhook(rows)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *wh)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(`
+		SELECT `+webhookColumns+`
+		FROM webhooks WHERE workspace_id = ?
+		ORDER BY id
+	`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Webhook
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *wh)
+	}
+	return list, rows.Err()
+}
+
+// ListPage returns one page of a workspace's webhooks, plus one extra row if
+// there are more (see pagination.NewPage).
+func (r *Repository) ListPage(workspaceID int, p pagination.Params) ([]Webhook, error) {
+	defer metrics.ObserveDB("webhook", "ListPage")()
+	where, tail, args := p.Query([]any{workspaceID}, "url")
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE workspace_id = $1` + where + tail
+
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Webhook
+		for rows.Next() {
+			wh, err := scanWebhook(rows)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *wh)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Webhook
+	for rows.Next() {
+		wh, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *wh)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) Delete(id int) error {
+	defer metrics.ObserveDB("webhook", "Delete")()
+	if config.DBDriver == "postgres" {
+		ctx := context.Background()
+		if _, err := r.pgxPool.Exec(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = $1`, id); err != nil {
+			return err
+		}
+		_, err := r.pgxPool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+		return err
+	}
+
+	if _, err := r.sqlDB.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := r.sqlDB.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	return err
+}
+
+func (r *Repository) CreateDelivery(d *Delivery) error {
+	defer metrics.ObserveDB("webhook", "CreateDelivery")()
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(), `
+			INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, d.WebhookID, d.EventType, d.Payload, d.Status, d.Attempts, d.NextAttemptAt, d.CreatedAt)
+		return row.Scan(&d.ID)
+	}
+
+	res, err := r.sqlDB.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, d.WebhookID, d.EventType, d.Payload, d.Status, d.Attempts, d.NextAttemptAt, d.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	d.ID = int(id)
+	return nil
+}
+
+// FindDelivery returns the delivery with the given ID, or nil if it does not exist.
+func (r *Repository) FindDelivery(id int) (*Delivery, error) {
+	defer metrics.ObserveDB("webhook", "FindDelivery")()
+	if config.DBDriver == "postgres" {
+		row := r.pgxPool.QueryRow(context.Background(),
+			`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id)
+		d, err := scanDelivery(row)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return d, err
+	}
+
+	row := r.sqlDB.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id)
+	d, err := scanDelivery(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// ListDeliveries returns one page of a webhook's deliveries, plus one extra
+// row if there are more (see pagination.NewPage).
+func (r *Repository) ListDeliveries(webhookID int, p pagination.Params) ([]Delivery, error) {
+	defer metrics.ObserveDB("webhook", "ListDeliveries")()
+	where, tail, args := p.Query([]any{webhookID}, "")
+	return r.queryDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = $1`+where+tail, args...)
+}
+
+// ClaimDue claims up to limit pending deliveries whose next attempt is due
+// by moving that attempt to leaseUntil, and returns them. Claiming is one
+// statement, so two dispatchers never get the same delivery; on postgres
+// SKIP LOCKED lets them claim different rows concurrently. A claim whose
+// outcome is never saved lapses at leaseUntil and the delivery is retried.
+func (r *Repository) ClaimDue(now, leaseUntil time.Time, limit int) ([]Delivery, error) {
+	defer metrics.ObserveDB("webhook", "ClaimDue")()
+	lock := ""
+	if config.DBDriver == "postgres" {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	return r.queryDeliveries(`
+		UPDATE webhook_deliveries SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at LIMIT $3`+lock+`
+		)
+		RETURNING `+deliveryColumns, leaseUntil, now, limit)
+}
+
+// queryDeliveries runs a delivery query written with $N placeholders, which
+// both pgx and sqlite accept.
+func (r *Repository) queryDeliveries(query string, args ...any) ([]Delivery, error) {
+	if config.DBDriver == "postgres" {
+		rows, err := r.pgxPool.Query(context.Background(), query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var list []Delivery
+		for rows.Next() {
+			d, err := scanDelivery(rows)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *d)
+		}
+		return list, rows.Err()
+	}
+
+	rows, err := r.sqlDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *d)
+	}
+	return list, rows.Err()
+}
+
+// SaveAttempt records the outcome of a delivery attempt.
+func (r *Repository) SaveAttempt(d *Delivery) error {
+	defer metrics.ObserveDB("webhook", "SaveAttempt")()
+	if config.DBDriver == "postgres" {
+		_, err := r.pgxPool.Exec(context.Background(), `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4,
+		    last_error = $5, delivered_at = $6
+		WHERE id = $7
+		`, d.Status, d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError, d.DeliveredAt, d.ID)
+		return err
+	}
+
+	_, err := r.sqlDB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?,
+		    last_error = ?, delivered_at = ?
+		WHERE id = ?
+	`, d.Status, d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError, d.DeliveredAt, d.ID)
+	return err
+}
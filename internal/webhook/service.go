@@ -0,0 +1,339 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+var (
+	ErrForbidden = apierror.Forbidden("not allowed to manage webhooks in this workspace")
+	ErrNotOwner  = apierror.Forbidden("only owners of the workspace's organization may change webhooks")
+	ErrNotFound  = apierror.NotFound("webhook not found")
+
+	ErrDeliveryNotFound = apierror.NotFound("delivery not found")
+)
+
+// eventQueueSize bounds the events waiting to be turned into deliveries.
+// Publishers block once it is full rather than lose deliveries.
+const eventQueueSize = 1024
+
+// Members of a workspace's organization may see its webhooks and their
+// deliveries; registering, deleting and redelivering need the owner role.
+type Service struct {
+	repo       *Repository
+	workspaces *workspace.Service
+	dispatcher *Dispatcher
+	guard      *addressGuard
+	pending    chan events.Event
+}
+
+// NewService fails if config.Webhook.AllowedNetworks has an invalid CIDR.
+func NewService(workspaces *workspace.Service) (*Service, error) {
+	guard, err := newAddressGuard(config.Webhook.AllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	repo := NewDefaultRepository()
+	return &Service{
+		repo:       repo,
+		workspaces: workspaces,
+		dispatcher: NewDispatcher(repo, guard),
+		guard:      guard,
+		pending:    make(chan events.Event, eventQueueSize),
+	}, nil
+}
+
+// Dispatcher returns the background worker that sends deliveries.
+func (s *Service) Dispatcher() *Dispatcher {
+	return s.dispatcher
+}
+
+// Create registers a webhook. The signing secret is generated here and only
+// returned on the created webhook.
+func (s *Service) Create(ctx context.Context, workspaceID int, rawURL string, evts []string, userID int) (*Webhook, error) {
+	if err := s.requireOwner(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.validateURL(rawURL); err != nil {
+		return nil, err
+	}
+	if evts == nil {
+		evts = []string{}
+	}
+	for _, e := range evts {
+		if !events.IsValidType(e) {
+			return nil, apierror.Field("events", fmt.Sprintf("unknown event type %q", e))
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	wh := &Webhook{
+		WorkspaceID: workspaceID,
+		URL:         rawURL,
+		Events:      evts,
+		Secret:      secret,
+		Active:      true,
+		CreatedBy:   userID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := s.repo.Create(wh); err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+// Sorts are the sort fields of the webhook list; created_at sorts by id.
+// The ?name filter matches the URL.
+var Sorts = pagination.Sorts{
+	Columns: map[string]string{"url": "url", "created_at": "id"},
+	Default: "created_at",
+}
+
+// DeliverySorts: the delivery log is newest first by default.
+var DeliverySorts = pagination.Sorts{
+	Columns: map[string]string{"created_at": "id"},
+	Default: "-created_at",
+}
+
+// List returns a page of the webhooks of a workspace, without their secrets.
+func (s *Service) List(ctx context.Context, workspaceID, userID int, p pagination.Params) (pagination.Page[Webhook], error) {
+	if err := s.requireMember(ctx, workspaceID, userID); err != nil {
+		return pagination.Page[Webhook]{}, err
+	}
+
+	rows, err := s.repo.ListPage(workspaceID, p)
+	if err != nil {
+		return pagination.Page[Webhook]{}, err
+	}
+	page := pagination.NewPage(rows, p, func(wh Webhook) (string, int64) { return wh.URL, int64(wh.ID) })
+	for i := range page.Items {
+		page.Items[i].Secret = ""
+	}
+	return page, nil
+}
+
+// Get returns a webhook without its secret.
+func (s *Service) Get(ctx context.Context, id, userID int) (*Webhook, error) {
+	wh, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	wh.Secret = ""
+	return wh, nil
+}
+
+func (s *Service) Delete(ctx context.Context, id, userID int) error {
+	wh, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireOwner(ctx, wh.WorkspaceID, userID); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+// Deliveries returns a page of the delivery log of a webhook.
+func (s *Service) Deliveries(ctx context.Context, id, userID int, p pagination.Params) (pagination.Page[Delivery], error) {
+	if _, err := s.authorize(ctx, id, userID); err != nil {
+		return pagination.Page[Delivery]{}, err
+	}
+	rows, err := s.repo.ListDeliveries(id, p)
+	if err != nil {
+		return pagination.Page[Delivery]{}, err
+	}
+	return pagination.NewPage(rows, p, func(d Delivery) (string, int64) { return "", int64(d.ID) }), nil
+}
+
+// Redeliver queues a fresh delivery with the payload of an earlier one. The
+// original entry is kept in the log.
+func (s *Service) Redeliver(ctx context.Context, id, deliveryID, userID int) (*Delivery, error) {
+	wh, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwner(ctx, wh.WorkspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	orig, err := s.repo.FindDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if orig == nil || orig.WebhookID != id {
+		return nil, ErrDeliveryNotFound
+	}
+
+	d, err := s.enqueue(id, orig.EventType, orig.Payload)
+	if err != nil {
+		return nil, err
+	}
+	s.dispatcher.Wake()
+	return d, nil
+}
+
+// HandleEvent hands the event to Run, which queues its deliveries. It is
+// registered on the bus and keeps database work off the publisher's request.
+func (s *Service) HandleEvent(e events.Event) {
+	s.pending <- e
+}
+
+// Run queues deliveries for published events until ctx is cancelled, then
+// for the events already handed over.
+func (s *Service) Run(ctx context.Context) {
+	for {
+		select {
+		case e := <-s.pending:
+			s.queueDeliveries(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-s.pending:
+					s.queueDeliveries(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// queueDeliveries queues a delivery for every active webhook of the event's
+// workspace that subscribes to the event type.
+func (s *Service) queueDeliveries(e events.Event) {
+	hooks, err := s.repo.ListForWorkspace(e.WorkspaceID)
+	if err != nil {
+		slog.Error("failed to load webhooks", "workspace_id", e.WorkspaceID, "err", err)
+		return
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("failed to encode event", "type", e.Type, "err", err)
+		return
+	}
+
+	queued := false
+	for _, wh := range hooks {
+		if !wh.Active || !subscribed(wh.Events, e.Type) {
+			continue
+		}
+		if _, err := s.enqueue(wh.ID, e.Type, string(payload)); err != nil {
+			slog.Error("failed to queue webhook delivery", "webhook_id", wh.ID, "err", err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		s.dispatcher.Wake()
+	}
+}
+
+func (s *Service) enqueue(webhookID int, eventType, payload string) (*Delivery, error) {
+	now := time.Now().UTC()
+	d := &Delivery{
+		WebhookID:     webhookID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+	}
+	if err := s.repo.CreateDelivery(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// authorize loads a webhook and checks the user may access its workspace.
+func (s *Service) authorize(ctx context.Context, id, userID int) (*Webhook, error) {
+	wh, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if wh == nil {
+		return nil, ErrNotFound
+	}
+	if err := s.requireMember(ctx, wh.WorkspaceID, userID); err != nil {
+		return nil, err
+	}
+	return wh, nil
+}
+
+func (s *Service) requireMember(ctx context.Context, workspaceID, userID int) error {
+	ok, err := s.workspaces.IsMember(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (s *Service) requireOwner(ctx context.Context, workspaceID, userID int) error {
+	role, err := s.workspaces.Role(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	switch role {
+	case "":
+		return ErrForbidden
+	case org.RoleOwner:
+		return nil
+	default:
+		return ErrNotOwner
+	}
+}
+
+func subscribed(evts []string, eventType string) bool {
+	if len(evts) == 0 {
+		return true
+	}
+	for _, e := range evts {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// validateURL rejects URLs that are not absolute http(s), and ones whose
+// host is an address the dispatcher would refuse. Hostnames are checked
+// when they are dialed, as they may resolve differently by then.
+func (s *Service) validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apierror.Field("url", "must be an absolute http(s) URL")
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !s.guard.permits(addr) {
+		return apierror.Field("url", "must not point at a loopback, private or link-local address")
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(raw), nil
+}
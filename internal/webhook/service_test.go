@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/workspace"
+)
+
+// newTestService returns a webhook service on a fresh sqlite database with
+// one active webhook subscribed to every event of a new workspace.
+func newTestService(t *testing.T) (*Service, *Webhook) {
+	t.Helper()
+	configtest.SQLite(t)
+
+	ctx := context.Background()
+	u, err := auth.NewDefaultRepository().CreateUser(ctx, "owner@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaces := workspace.NewService(org.NewService(), events.NewBus(nil))
+	workspaceID, err := workspaces.Create(ctx, 0, "prod", "", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewService(workspaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh := &Webhook{
+		WorkspaceID: workspaceID,
+		URL:         "https://deploy.example.com/hook",
+		Events:      []string{},
+		Secret:      "whsec",
+		Active:      true,
+		CreatedBy:   u.ID,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := s.repo.Create(wh); err != nil {
+		t.Fatal(err)
+	}
+	return s, wh
+}
+
+func TestClaimDueHandsOutEachDeliveryOnce(t *testing.T) {
+	s, wh := newTestService(t)
+	for i := 0; i < 3; i++ {
+		if _, err := s.enqueue(wh.ID, events.SecretUpdated, "{}"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UTC().Add(time.Second)
+	lease := now.Add(claimLease)
+	first, err := s.repo.ClaimDue(now, lease, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.repo.ClaimDue(now, lease, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || len(second) != 1 {
+		t.Fatalf("claimed %d then %d deliveries, want 2 then 1", len(first), len(second))
+	}
+	if first[0].ID == second[0].ID || first[1].ID == second[0].ID {
+		t.Fatalf("delivery %d was claimed twice", second[0].ID)
+	}
+	if again, err := s.repo.ClaimDue(now, lease, batchSize); err != nil || len(again) != 0 {
+		t.Fatalf("claim while leased = %d deliveries, %v; want none", len(again), err)
+	}
+
+	// A claim whose outcome was never saved lapses with its lease.
+	lapsed, err := s.repo.ClaimDue(lease.Add(time.Second), lease.Add(claimLease), batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lapsed) != 3 {
+		t.Fatalf("claimed %d deliveries after the lease lapsed, want 3", len(lapsed))
+	}
+}
+
+func TestRunQueuesDeliveriesForHandledEvents(t *testing.T) {
+	s, wh := newTestService(t)
+
+	s.HandleEvent(events.Event{Type: events.SecretRotated, WorkspaceID: wh.WorkspaceID, OccurredAt: time.Now().UTC()})
+	s.HandleEvent(events.Event{Type: events.SecretRotated, WorkspaceID: wh.WorkspaceID + 1, OccurredAt: time.Now().UTC()})
+
+	// Run drains the events already handed over before it returns.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx)
+
+	due, err := s.repo.ClaimDue(time.Now().UTC().Add(time.Second), time.Now().UTC().Add(claimLease), batchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].WebhookID != wh.ID || due[0].EventType != events.SecretRotated {
+		t.Fatalf("queued deliveries = %+v, want one secret.rotated for webhook %d", due, wh.ID)
+	}
+}
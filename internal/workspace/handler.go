@@ -2,11 +2,13 @@ package workspace
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/amartya2002/secretlane/internal/apierror"
 	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/pagination"
 )
 
 type Handler struct {
@@ -17,98 +19,242 @@ func NewHandler(s *Service) *Handler {
 	return &Handler{service: s}
 }
 
-// /workspaces -> POST (create), GET (list)
-func (h *Handler) Workspaces(w http.ResponseWriter, r *http.Request) {
-	userID := auth.GetUserID(r)
-
-	switch r.Method {
-
-	case http.MethodPost:
-		var body struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-		}
-		json.NewDecoder(r.Body).Decode(&body)
-
-		id, err := h.service.Create(body.Name, body.Description, userID)
-		if err != nil {
-			log.Println("Workspace create error:", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": err.Error(),
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(struct {
-			ID int `json:"id"`
-		}{ID: id})
-
-	case http.MethodGet:
-		list, err := h.service.ListForUser(userID)
-		if err != nil {
-			http.Error(w, "Failed to load workspaces", 500)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(list)
-
-	default:
-		http.Error(w, "Method not allowed", 405)
-	}
-}
-
-// /workspaces/{id} -> PUT (update), DELETE (delete)
-func (h *Handler) WorkspaceByID(w http.ResponseWriter, r *http.Request) {
-	userID := auth.GetUserID(r)
-
-	idStr := r.URL.Path[len("/workspaces/"):]
-	wsID, _ := strconv.Atoi(idStr)
-
-	switch r.Method {
-
-	case http.MethodPut:
-		var body struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-		}
-		json.NewDecoder(r.Body).Decode(&body)
-
-		err := h.service.Update(wsID, body.Name, body.Description, userID)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": err.Error(),
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "workspace updated",
-		})
-
-	case http.MethodDelete:
-		err := h.service.Delete(wsID, userID)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": err.Error(),
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "workspace deleted",
-		})
-
-	default:
-		http.Error(w, "Method not allowed", 405)
+// Input is the request body for creating or updating a workspace. OrgID is
+// only read on create; 0 creates the workspace in the user's personal
+// organization.
+type Input struct {
+	OrgID       int    `json:"org_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Created is the response to a successful create.
+type Created struct {
+	ID int `json:"id"`
+}
+
+// TransferRequest names the organization to move a workspace to, or a user
+// whose personal organization should receive it.
+type TransferRequest struct {
+	OrgID    int    `json:"org_id,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// PurgeRequest confirms a permanent delete by repeating the workspace name.
+type PurgeRequest struct {
+	ConfirmName string `json:"confirm_name"`
+}
+
+// POST /workspaces
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var body Input
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	id, err := h.service.Create(r.Context(), body.OrgID, body.Name, body.Description, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Created{ID: id})
+}
+
+// GET /workspaces?org_id=&limit=&cursor=&sort=&name=
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := queryOrgID(w, r)
+	if !ok {
+		return
+	}
+	p, err := pagination.Parse(r, Sorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.ListForUser(r.Context(), auth.GetUserID(r), orgID, p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GET /workspaces/{id}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	ws, err := h.service.Get(r.Context(), wsID, auth.GetUserID(r))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws)
+}
+
+// PUT /workspaces/{id}
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var body Input
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := h.service.Update(r.Context(), wsID, body.Name, body.Description, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "workspace updated",
+	})
+}
+
+// DELETE /workspaces/{id}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), wsID, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "workspace moved to trash",
+	})
+}
+
+// GET /workspaces/trash?org_id=&limit=&cursor=&sort=&name=
+func (h *Handler) Trash(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := queryOrgID(w, r)
+	if !ok {
+		return
+	}
+	p, err := pagination.Parse(r, Sorts)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := h.service.ListTrash(r.Context(), auth.GetUserID(r), orgID, p)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// POST /workspaces/{id}/restore
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Restore(r.Context(), wsID, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "workspace restored",
+	})
+}
+
+// POST /workspaces/{id}/transfer
+func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var body TransferRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := h.service.Transfer(r.Context(), wsID, body, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "workspace transferred",
+	})
+}
+
+// POST /workspaces/{id}/purge
+func (h *Handler) Purge(w http.ResponseWriter, r *http.Request) {
+	wsID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var body PurgeRequest
+	if err := apierror.DecodeJSON(r, &body); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := h.service.Purge(r.Context(), wsID, body.ConfirmName, auth.GetUserID(r)); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "workspace permanently deleted",
+	})
+}
+
+// pathID parses {id}, writing a 400 if it is not a number.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid workspace id"))
+		return 0, false
+	}
+	logging.SetWorkspaceID(r.Context(), id)
+	return id, true
+}
+
+// queryOrgID parses the optional ?org_id filter, writing a 400 if it is not
+// a number.
+func queryOrgID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("org_id")
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		apierror.Write(w, r, apierror.Field("org_id", "must be a number"))
+		return 0, false
 	}
+	return id, true
 }
@@ -1,9 +1,15 @@
 package workspace
 
+import "time"
+
+// Workspace belongs to an organization; CreatedBy only records who made it.
 type Workspace struct {
 	ID          int    `json:"id"`
+	OrgID       int    `json:"org_id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	CreatedBy   int    `json:"created_by"`
 	CreatedAt   string `json:"created_at"`
+	// DeletedAt is set while the workspace is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
@@ -0,0 +1,44 @@
+package workspace
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	purgeInterval  = time.Hour
+	purgeBatchSize = 100
+)
+
+// Purger permanently deletes workspaces whose trash retention has expired.
+type Purger struct {
+	service   *Service
+	retention time.Duration
+}
+
+// NewPurger returns a purger for workspaces trashed longer than retention.
+func NewPurger(s *Service, retention time.Duration) *Purger {
+	return &Purger{service: s, retention: retention}
+}
+
+// Run purges expired workspaces every purgeInterval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.service.PurgeExpired(ctx, p.retention)
+		if err != nil {
+			slog.Error("failed to purge expired workspaces", "err", err)
+		} else if n > 0 {
+			slog.Info("purged workspaces from the trash", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
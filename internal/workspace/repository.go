@@ -3,69 +3,98 @@ package workspace
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/metrics"
+	"github.com/amartya2002/secretlane/internal/pagination"
+	"github.com/amartya2002/secretlane/internal/tracing"
 )
 
 // Repository encapsulates all DB operations for workspaces.
-// It works with either sqlite (*sql.DB) or postgres (*pgx.Conn) based on config.DBDriver.
+// It works with either sqlite (*sql.DB) or postgres (*pgxpool.Pool) based on config.DBDriver.
 type Repository struct {
 	sqlDB   *sql.DB
-	pgxConn *pgx.Conn
+	pgxPool *pgxpool.Pool
 }
 
-func NewRepository(sqlDB *sql.DB, pgxConn *pgx.Conn) *Repository {
-	return &Repository{sqlDB: sqlDB, pgxConn: pgxConn}
+func NewRepository(sqlDB *sql.DB, pgxPool *pgxpool.Pool) *Repository {
+	return &Repository{sqlDB: sqlDB, pgxPool: pgxPool}
 }
 
 func NewDefaultRepository() *Repository {
-	return &Repository{sqlDB: config.DB, pgxConn: config.PGXConn}
+	return &Repository{sqlDB: config.DB, pgxPool: config.PGXPool}
 }
 
-func (r *Repository) CountByNameForUser(name string, userID int) (int, error) {
+// rowScanner is satisfied by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const workspaceColumns = `id, org_id, name, description, created_by, created_at, deleted_at`
+
+func scanWorkspace(row rowScanner) (*Workspace, error) {
+	ws := &Workspace{}
+	if err := row.Scan(&ws.ID, &ws.OrgID, &ws.Name, &ws.Description, &ws.CreatedBy, &ws.CreatedAt, &ws.DeletedAt); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// CountByNameInOrg counts the organization's live workspaces with this
+// name other than excludeID (0 excludes none); workspaces in the trash do
+// not count.
+func (r *Repository) CountByNameInOrg(ctx context.Context, name string, orgID, excludeID int) (int, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "CountByNameInOrg")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "CountByNameInOrg")()
 	var count int
 
 	if config.DBDriver == "postgres" {
-		row := r.pgxConn.QueryRow(context.Background(), `
-		SELECT COUNT(*) FROM workspaces WHERE name = $1 AND created_by = $2
-		`, name, userID)
+		row := r.pgxPool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM workspaces WHERE name = $1 AND org_id = $2 AND id <> $3 AND deleted_at IS NULL
+		`, name, orgID, excludeID)
 		if err := row.Scan(&count); err != nil {
 			return 0, err
 		}
 		return count, nil
 	}
 
-	row := r.sqlDB.QueryRow(`
-		SELECT COUNT(*) FROM workspaces WHERE name = ? AND created_by = ?
-	`, name, userID)
+	row := r.sqlDB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM workspaces WHERE name = ? AND org_id = ? AND id <> ? AND deleted_at IS NULL
+	`, name, orgID, excludeID)
 	if err := row.Scan(&count); err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-func (r *Repository) CreateWorkspace(name, description string, userID int) (int, error) {
+func (r *Repository) CreateWorkspace(ctx context.Context, orgID int, name, description string, userID int) (int, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "CreateWorkspace")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "CreateWorkspace")()
 	if config.DBDriver == "postgres" {
-		row := r.pgxConn.QueryRow(context.Background(), `
-			INSERT INTO workspaces (name, description, created_by)
-			VALUES ($1, $2, $3)
+		row := r.pgxPool.QueryRow(ctx, `
+			INSERT INTO workspaces (org_id, name, description, created_by)
+			VALUES ($1, $2, $3, $4)
 			RETURNING id
-		`, name, description, userID)
+		`, orgID, name, description, userID)
 		var id int
 		if err := row.Scan(&id); err != nil {
-			return 0, err
+			return 0, nameTaken(err)
 		}
 		return id, nil
 	}
 
-	res, err := r.sqlDB.Exec(`
-		INSERT INTO workspaces (name, description, created_by)
-		VALUES (?, ?, ?)
-	`, name, description, userID)
+	res, err := r.sqlDB.ExecContext(ctx, `
+		INSERT INTO workspaces (org_id, name, description, created_by)
+		VALUES (?, ?, ?, ?)
+	`, orgID, name, description, userID)
 	if err != nil {
-		return 0, err
+		return 0, nameTaken(err)
 	}
 	lastID, err := res.LastInsertId()
 	if err != nil {
@@ -74,13 +103,47 @@ func (r *Repository) CreateWorkspace(name, description string, userID int) (int,
 	return int(lastID), nil
 }
 
-func (r *Repository) ListForUser(userID int) ([]Workspace, error) {
+// ListForUser returns one page of the workspaces of the organizations the
+// user belongs to, plus one extra row if there are more (see
+// pagination.NewPage). orgID, if not 0, narrows the list to one
+// organization; trashed selects the trash instead of the live workspaces.
+func (r *Repository) ListForUser(ctx context.Context, userID, orgID int, trashed bool, p pagination.Params) ([]Workspace, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "ListForUser")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "ListForUser")()
+	args := []any{userID}
+	filter := ` AND deleted_at IS NULL`
+	if trashed {
+		filter = ` AND deleted_at IS NOT NULL`
+	}
+	if orgID != 0 {
+		args = append(args, orgID)
+		filter += ` AND org_id = $2`
+	}
+	where, tail, args := p.Query(args, "name")
+	return r.query(ctx, `
+		SELECT `+workspaceColumns+` FROM workspaces
+		WHERE org_id IN (SELECT org_id FROM org_members WHERE user_id = $1)`+filter+where+tail, args...)
+}
+
+// ListDeletedBefore returns up to limit workspaces that were moved to the
+// trash before cutoff.
+func (r *Repository) ListDeletedBefore(ctx context.Context, cutoff time.Time, limit int) ([]Workspace, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "ListDeletedBefore")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "ListDeletedBefore")()
+	return r.query(ctx, `
+		SELECT `+workspaceColumns+`
+		FROM workspaces WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		ORDER BY deleted_at LIMIT $2
+	`, cutoff, limit)
+}
+
+// query runs a workspace query written with $N placeholders, which both pgx
+// and sqlite accept.
+func (r *Repository) query(ctx context.Context, query string, args ...any) ([]Workspace, error) {
 	if config.DBDriver == "postgres" {
-		rows, err := r.pgxConn.Query(context.Background(), `
-		SELECT id, name, description, created_by, created_at
-		FROM workspaces WHERE created_by = $1
-		ORDER BY created_at DESC
-		`, userID)
+		rows, err := r.pgxPool.Query(ctx, query, args...)
 		if err != nil {
 			return nil, err
 		}
@@ -88,20 +151,16 @@ func (r *Repository) ListForUser(userID int) ([]Workspace, error) {
 
 		var list []Workspace
 		for rows.Next() {
-			var ws Workspace
-			if err := rows.Scan(&ws.ID, &ws.Name, &ws.Description, &ws.CreatedBy, &ws.CreatedAt); err != nil {
+			ws, err := scanWorkspace(rows)
+			if err != nil {
 				return nil, err
 			}
-			list = append(list, ws)
+			list = append(list, *ws)
 		}
-		return list, nil
+		return list, rows.Err()
 	}
 
-	rows, err := r.sqlDB.Query(`
-		SELECT id, name, description, created_by, created_at
-		FROM workspaces WHERE created_by = ?
-		ORDER BY created_at DESC
-	`, userID)
+	rows, err := r.sqlDB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -109,45 +168,127 @@ func (r *Repository) ListForUser(userID int) ([]Workspace, error) {
 
 	var list []Workspace
 	for rows.Next() {
-		var ws Workspace
-		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Description, &ws.CreatedBy, &ws.CreatedAt); err != nil {
+		ws, err := scanWorkspace(rows)
+		if err != nil {
 			return nil, err
 		}
-		list = append(list, ws)
+		list = append(list, *ws)
 	}
-	return list, nil
+	return list, rows.Err()
 }
 
-func (r *Repository) Update(id int, name, description string, userID int) error {
+// FindByID returns the workspace with the given ID, trashed or not, or nil
+// if it does not exist.
+func (r *Repository) FindByID(ctx context.Context, id int) (*Workspace, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "FindByID")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "FindByID")()
 	if config.DBDriver == "postgres" {
-		_, err := r.pgxConn.Exec(context.Background(), `
-		UPDATE workspaces
-		SET name = $1, description = $2
-		WHERE id = $3 AND created_by = $4
-		`, name, description, id, userID)
-		return err
+		row := r.pgxPool.QueryRow(ctx, `
+		SELECT `+workspaceColumns+`
+		FROM workspaces WHERE id = $1
+		`, id)
+		ws, err := scanWorkspace(row)
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return ws, err
 	}
 
-	_, err := r.sqlDB.Exec(`
+	row := r.sqlDB.QueryRowContext(ctx, `
+		SELECT `+workspaceColumns+`
+		FROM workspaces WHERE id = ?
+	`, id)
+	ws, err := scanWorkspace(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ws, err
+}
+
+// Update reports whether a live workspace was changed.
+func (r *Repository) Update(ctx context.Context, id int, name, description string) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "Update")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "Update")()
+	return r.exec(ctx, `
 		UPDATE workspaces
-		SET name = ?, description = ?
-		WHERE id = ? AND created_by = ?
-	`, name, description, id, userID)
-	return err
+		SET name = $1, description = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`, name, description, id)
+}
+
+// SoftDelete moves a live workspace to the trash and reports whether it did.
+func (r *Repository) SoftDelete(ctx context.Context, id int, now time.Time) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "SoftDelete")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "SoftDelete")()
+	return r.exec(ctx, `
+		UPDATE workspaces SET deleted_at = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`, now, id)
+}
+
+// Restore takes a workspace out of the trash and reports whether it did.
+func (r *Repository) Restore(ctx context.Context, id int) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "Restore")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "Restore")()
+	return r.exec(ctx, `
+		UPDATE workspaces SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, id)
+}
+
+// Transfer moves a live workspace to another organization and reports
+// whether it did.
+func (r *Repository) Transfer(ctx context.Context, id, orgID int) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "Transfer")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "Transfer")()
+	return r.exec(ctx, `
+		UPDATE workspaces SET org_id = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`, orgID, id)
+}
+
+// Purge reports whether a workspace was removed for good. Secrets, agents,
+// join tokens and webhooks go with it through ON DELETE CASCADE.
+func (r *Repository) Purge(ctx context.Context, id int) (bool, error) {
+	ctx, span := tracing.StartDB(ctx, "workspace", "Purge")
+	defer span.End()
+	defer metrics.ObserveDB("workspace", "Purge")()
+	return r.exec(ctx, `DELETE FROM workspaces WHERE id = $1`, id)
 }
 
-func (r *Repository) Delete(id int, userID int) error {
+// exec runs a statement written with $N placeholders and reports whether it
+// affected any row.
+func (r *Repository) exec(ctx context.Context, query string, args ...any) (bool, error) {
 	if config.DBDriver == "postgres" {
-		_, err := r.pgxConn.Exec(context.Background(), `
-		DELETE FROM workspaces
-		WHERE id = $1 AND created_by = $2
-		`, id, userID)
-		return err
+		tag, err := r.pgxPool.Exec(ctx, query, args...)
+		if err != nil {
+			return false, nameTaken(err)
+		}
+		return tag.RowsAffected() > 0, nil
+	}
+
+	res, err := r.sqlDB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, nameTaken(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
 	}
+	return n > 0, nil
+}
 
-	_, err := r.sqlDB.Exec(`
-		DELETE FROM workspaces
-		WHERE id = ? AND created_by = ?
-	`, id, userID)
+// nameTaken turns a violation of the index that keeps live workspace names
+// unique per organization into ErrDuplicateName. The service checks names
+// first; the index settles concurrent requests that both passed the check.
+func nameTaken(err error) error {
+	if config.IsUniqueViolation(err) {
+		return ErrDuplicateName
+	}
 	return err
 }
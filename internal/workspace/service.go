@@ -1,36 +1,400 @@
 package workspace
 
-import "errors"
+import (
+	"context"
+	"strings"
+	"time"
 
+	"github.com/amartya2002/secretlane/internal/apierror"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/pagination"
+)
+
+var (
+	ErrDuplicateName = apierror.Conflict("workspace with this name already exists in the organization")
+	ErrNotFound      = apierror.NotFound("workspace not found")
+	ErrForbidden     = apierror.Forbidden("not allowed to access this workspace")
+	ErrNotOrgOwner   = apierror.Forbidden("only owners of the workspace's organization may do this")
+	ErrNotInTrash    = apierror.Conflict("workspace is not in the trash")
+)
+
+// Workspaces are owned by organizations. Any member of the organization may
+// use and edit them; purging and transferring need the owner role.
 type Service struct {
-	repo *Repository
+	repo   *Repository
+	orgs   *org.Service
+	events *events.Bus
 }
 
-func NewService() *Service {
-	return &Service{repo: NewDefaultRepository()}
+func NewService(orgs *org.Service, bus *events.Bus) *Service {
+	return &Service{repo: NewDefaultRepository(), orgs: orgs, events: bus}
 }
 
-func (s *Service) Create(name, description string, userID int) (int, error) {
-	// Prevent duplicate workspace names per user
-	count, err := s.repo.CountByNameForUser(name, userID)
+// Create makes a workspace in orgID, or in the user's personal organization
+// if orgID is 0. Names are unique within an organization.
+func (s *Service) Create(ctx context.Context, orgID int, name, description string, userID int) (int, error) {
+	if err := validateName(name); err != nil {
+		return 0, err
+	}
+
+	if orgID == 0 {
+		personal, err := s.orgs.PersonalOrg(userID)
+		if err != nil {
+			return 0, err
+		}
+		orgID = personal
+	} else {
+		role, err := s.orgs.Role(orgID, userID)
+		if err != nil {
+			return 0, err
+		}
+		if role == "" {
+			return 0, apierror.Field("org_id", "must be an organization you belong to")
+		}
+	}
+
+	count, err := s.repo.CountByNameInOrg(ctx, name, orgID, 0)
 	if err != nil {
 		return 0, err
 	}
 	if count > 0 {
-		return 0, errors.New("workspace with this name already exists")
+		return 0, ErrDuplicateName
+	}
+
+	id, err := s.repo.CreateWorkspace(ctx, orgID, name, description, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.events.Publish(events.Event{
+		Type:        events.WorkspaceCreated,
+		WorkspaceID: id,
+		ActorID:     userID,
+		Data:        map[string]any{"name": name, "org_id": orgID},
+	})
+	return id, nil
+}
+
+// Sorts are the sort fields of the workspace list. IDs increase with
+// creation time, so created_at sorts by id.
+var Sorts = pagination.Sorts{
+	Columns: map[string]string{"name": "name", "created_at": "id"},
+	Default: "-created_at",
+}
+
+// ListForUser returns a page of the workspaces in the user's organizations,
+// or in orgID alone if it is not 0.
+func (s *Service) ListForUser(ctx context.Context, userID, orgID int, p pagination.Params) (pagination.Page[Workspace], error) {
+	rows, err := s.repo.ListForUser(ctx, userID, orgID, false, p)
+	if err != nil {
+		return pagination.Page[Workspace]{}, err
+	}
+	return pagination.NewPage(rows, p, workspaceKey), nil
+}
+
+// ListTrash returns a page of the deleted, still restorable workspaces in
+// the user's organizations, or in orgID alone if it is not 0.
+func (s *Service) ListTrash(ctx context.Context, userID, orgID int, p pagination.Params) (pagination.Page[Workspace], error) {
+	rows, err := s.repo.ListForUser(ctx, userID, orgID, true, p)
+	if err != nil {
+		return pagination.Page[Workspace]{}, err
+	}
+	return pagination.NewPage(rows, p, workspaceKey), nil
+}
+
+func workspaceKey(ws Workspace) (string, int64) {
+	return ws.Name, int64(ws.ID)
+}
+
+// Get returns the workspace if userID may see it. Workspaces in the trash
+// are not found.
+func (s *Service) Get(ctx context.Context, id int, userID int) (*Workspace, error) {
+	ws, _, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if ws.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return ws, nil
+}
+
+// authorize returns the workspace, trashed or not, and the user's role in
+// its organization if they are a member.
+func (s *Service) authorize(ctx context.Context, id int, userID int) (*Workspace, string, error) {
+	ws, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if ws == nil {
+		return nil, "", ErrNotFound
+	}
+	role, err := s.orgs.Role(ws.OrgID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if role == "" {
+		return nil, "", ErrForbidden
+	}
+	return ws, role, nil
+}
+
+// Update renames the workspace and sets its description. It fails with
+// ErrDuplicateName if another live workspace in its organization has the
+// name.
+func (s *Service) Update(ctx context.Context, id int, name, description string, userID int) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	ws, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.repo.CountByNameInOrg(ctx, name, ws.OrgID, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateName
+	}
+
+	ok, err := s.repo.Update(ctx, id, name, description)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Deleted between the lookup and the update.
+		return ErrNotFound
+	}
+
+	s.events.Publish(events.Event{
+		Type:        events.WorkspaceUpdated,
+		WorkspaceID: id,
+		ActorID:     userID,
+		Data:        map[string]any{"name": name},
+	})
+	return nil
+}
+
+// Delete moves the workspace to the trash, from which it can be restored
+// until it is purged.
+func (s *Service) Delete(ctx context.Context, id int, userID int) error {
+	if _, err := s.Get(ctx, id, userID); err != nil {
+		return err
+	}
+
+	ok, err := s.repo.SoftDelete(ctx, id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	s.events.Publish(events.Event{
+		Type:        events.WorkspaceDeleted,
+		WorkspaceID: id,
+		ActorID:     userID,
+	})
+	return nil
+}
+
+// Restore takes the workspace out of the trash. It fails with
+// ErrDuplicateName if a live workspace has taken its name meanwhile.
+func (s *Service) Restore(ctx context.Context, id int, userID int) error {
+	ws, _, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if ws.DeletedAt == nil {
+		return ErrNotInTrash
+	}
+
+	count, err := s.repo.CountByNameInOrg(ctx, ws.Name, ws.OrgID, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateName
+	}
+
+	ok, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Restored or purged between the lookup and the update.
+		return ErrNotInTrash
 	}
 
-	return s.repo.CreateWorkspace(name, description, userID)
+	s.events.Publish(events.Event{
+		Type:        events.WorkspaceRestored,
+		WorkspaceID: id,
+		ActorID:     userID,
+		Data:        map[string]any{"name": ws.Name},
+	})
+	return nil
 }
 
-func (s *Service) ListForUser(userID int) ([]Workspace, error) {
-	return s.repo.ListForUser(userID)
+// Transfer moves a live workspace to another organization. The user must
+// own the current organization and belong to the target; giving a username
+// instead targets that user's personal organization.
+func (s *Service) Transfer(ctx context.Context, id int, req TransferRequest, userID int) error {
+	ws, role, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if ws.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if role != org.RoleOwner {
+		return ErrNotOrgOwner
+	}
+
+	var target int
+	switch {
+	case req.Username != "" && req.OrgID != 0:
+		return apierror.BadRequest("give either org_id or username, not both")
+	case req.Username != "":
+		if target, err = s.orgs.PersonalOrgOf(req.Username, "username"); err != nil {
+			return err
+		}
+	case req.OrgID != 0:
+		targetRole, err := s.orgs.Role(req.OrgID, userID)
+		if err != nil {
+			return err
+		}
+		if targetRole == "" {
+			return apierror.Field("org_id", "must be an organization you belong to")
+		}
+		target = req.OrgID
+	default:
+		return apierror.Field("org_id", "is required")
+	}
+	if target == ws.OrgID {
+		return apierror.Conflict("workspace already belongs to this organization")
+	}
+
+	count, err := s.repo.CountByNameInOrg(ctx, ws.Name, target, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateName
+	}
+
+	ok, err := s.repo.Transfer(ctx, id, target)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	s.events.Publish(events.Event{
+		Type:        events.WorkspaceTransferred,
+		WorkspaceID: id,
+		ActorID:     userID,
+		Data:        map[string]any{"from_org_id": ws.OrgID, "to_org_id": target},
+	})
+	return nil
+}
+
+// Purge deletes the workspace and everything in it for good, whether or not
+// it is in the trash. Only owners of its organization may, and confirmName
+// must repeat the workspace's name.
+func (s *Service) Purge(ctx context.Context, id int, confirmName string, userID int) error {
+	ws, role, err := s.authorize(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if role != org.RoleOwner {
+		return ErrNotOrgOwner
+	}
+	if confirmName != ws.Name {
+		return apierror.Field("confirm_name", "must match the workspace name")
+	}
+	return s.purge(ctx, ws, userID)
 }
 
-func (s *Service) Update(id int, name, description string, userID int) error {
-	return s.repo.Update(id, name, description, userID)
+// PurgeExpired purges workspaces that have been in the trash longer than
+// retention and returns how many it removed.
+func (s *Service) PurgeExpired(ctx context.Context, retention time.Duration) (int, error) {
+	cutoff := time.Now().UTC().Add(-retention)
+	purged := 0
+	for {
+		expired, err := s.repo.ListDeletedBefore(ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for i := range expired {
+			if err := s.purge(ctx, &expired[i], 0); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(expired) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// purge removes ws; actorID is 0 when the retention job does it.
+func (s *Service) purge(ctx context.Context, ws *Workspace, actorID int) error {
+	ok, err := s.repo.Purge(ctx, ws.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+
+	s.events.Publish(events.Event{
+		Type:        events.WorkspacePurged,
+		WorkspaceID: ws.ID,
+		ActorID:     actorID,
+		Data:        map[string]any{"name": ws.Name},
+	})
+	return nil
 }
 
-func (s *Service) Delete(id int, userID int) error {
-	return s.repo.Delete(id, userID)
+// IsMember reports whether userID belongs to the organization that owns the
+// workspace. A missing or trashed workspace is reported as not accessible.
+func (s *Service) IsMember(ctx context.Context, id int, userID int) (bool, error) {
+	role, err := s.Role(ctx, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return role != "", nil
+}
+
+// Role returns userID's role in the organization that owns the workspace,
+// or "" if they are not a member or the workspace is missing or trashed.
+func (s *Service) Role(ctx context.Context, id int, userID int) (string, error) {
+	ws, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if ws == nil || ws.DeletedAt != nil {
+		return "", nil
+	}
+	return s.orgs.Role(ws.OrgID, userID)
+}
+
+// IsActive reports whether the workspace exists and is not in the trash.
+func (s *Service) IsActive(ctx context.Context, id int) (bool, error) {
+	ws, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return ws != nil && ws.DeletedAt == nil, nil
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return apierror.Field("name", "is required")
+	}
+	return nil
 }
@@ -0,0 +1,162 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amartya2002/secretlane/internal/auth"
+	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/config/configtest"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/org"
+)
+
+func TestNamesAreUniquePerOrganization(t *testing.T) {
+	configtest.SQLite(t)
+
+	ctx := context.Background()
+	u, err := auth.NewDefaultRepository().CreateUser(ctx, "owner@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgs := org.NewService()
+	s := NewService(orgs, events.NewBus(nil))
+	acme, err := orgs.Create("acme", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	personalProd, err := s.Create(ctx, 0, "prod", "", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same name in another organization is fine.
+	acmeProd, err := s.Create(ctx, acme.ID, "prod", "", u.ID)
+	if err != nil {
+		t.Fatalf("create prod in a second org: %v", err)
+	}
+	if _, err := s.Create(ctx, acme.ID, "prod", "", u.ID); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("duplicate create err = %v, want ErrDuplicateName", err)
+	}
+
+	staging, err := s.Create(ctx, acme.ID, "staging", "", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(ctx, staging, "prod", "", u.ID); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("rename to a taken name err = %v, want ErrDuplicateName", err)
+	}
+	// Keeping its own name only changes the description.
+	if err := s.Update(ctx, acmeProd, "prod", "primary", u.ID); err != nil {
+		t.Fatalf("update keeping the name: %v", err)
+	}
+	// Taken in the personal organization only.
+	if err := s.Update(ctx, staging, "qa", "", u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Create(ctx, 0, "qa", "", u.ID); err != nil {
+		t.Fatalf("create qa in the personal org: %v", err)
+	}
+
+	if err := s.Transfer(ctx, personalProd, TransferRequest{OrgID: acme.ID}, u.ID); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("transfer onto a taken name err = %v, want ErrDuplicateName", err)
+	}
+	// A workspace in the trash frees its name.
+	if err := s.Delete(ctx, acmeProd, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Transfer(ctx, personalProd, TransferRequest{OrgID: acme.ID}, u.ID); err != nil {
+		t.Fatalf("transfer after the name was freed: %v", err)
+	}
+	if err := s.Restore(ctx, acmeProd, u.ID); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("restore onto a taken name err = %v, want ErrDuplicateName", err)
+	}
+}
+
+func TestPurgeRemovesWorkspaceContents(t *testing.T) {
+	configtest.SQLite(t)
+
+	ctx := context.Background()
+	u, err := auth.NewDefaultRepository().CreateUser(ctx, "owner@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(org.NewService(), events.NewBus(nil))
+	id, err := s.Create(ctx, 0, "prod", "", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	for _, stmt := range []string{
+		`INSERT INTO secrets (workspace_id, name, value, created_by, created_at, updated_at) VALUES ($1, 'A', 'sealed', $2, $3, $3)`,
+		`INSERT INTO agent_join_tokens (workspace_id, token_hash, created_by, created_at, expires_at) VALUES ($1, 'hash', $2, $3, $3)`,
+		`INSERT INTO agents (workspace_id, name, public_key, created_at) VALUES ($1, 'web-01', 'key-' || $2, $3)`,
+		`INSERT INTO webhooks (workspace_id, url, events, secret, active, created_by, created_at) VALUES ($1, 'https://example.com', '[]', 'whsec', 1, $2, $3)`,
+	} {
+		if _, err := config.DB.Exec(stmt, id, u.ID, now); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	if _, err := config.DB.Exec(`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, created_at, next_attempt_at)
+		SELECT id, 'secret.created', '{}', 'pending', $1, $1 FROM webhooks`, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Purge(ctx, id, "prod", u.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"workspaces", "secrets", "agent_join_tokens", "agents", "webhooks", "webhook_deliveries"} {
+		var n int
+		if err := config.DB.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d rows left in %s after purge", n, table)
+		}
+	}
+}
+
+// The service checks names before writing; the index catches writers that
+// raced past that check.
+func TestNameIndexRejectsDuplicateLiveNames(t *testing.T) {
+	configtest.SQLite(t)
+
+	ctx := context.Background()
+	u, err := auth.NewDefaultRepository().CreateUser(ctx, "owner@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(org.NewService(), events.NewBus(nil))
+	id, err := s.Create(ctx, 0, "prod", "", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.repo.CreateWorkspace(ctx, ws.OrgID, "prod", "", u.ID); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("insert of a taken name err = %v, want ErrDuplicateName", err)
+	}
+	otherID, err := s.repo.CreateWorkspace(ctx, ws.OrgID, "staging", "", u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.repo.Update(ctx, otherID, "prod", ""); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("rename onto a taken name err = %v, want ErrDuplicateName", err)
+	}
+
+	if _, err := s.repo.SoftDelete(ctx, id, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.repo.Update(ctx, otherID, "prod", ""); err != nil {
+		t.Fatalf("rename onto a trashed workspace's name: %v", err)
+	}
+	if _, err := s.repo.Restore(ctx, id); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("restore onto a taken name err = %v, want ErrDuplicateName", err)
+	}
+}
@@ -1,39 +1,250 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/amartya2002/secretlane/internal/agent"
+	"github.com/amartya2002/secretlane/internal/agent/runner"
 	"github.com/amartya2002/secretlane/internal/auth"
 	"github.com/amartya2002/secretlane/internal/config"
+	"github.com/amartya2002/secretlane/internal/events"
+	"github.com/amartya2002/secretlane/internal/health"
+	"github.com/amartya2002/secretlane/internal/logging"
+	"github.com/amartya2002/secretlane/internal/metrics"
 	"github.com/amartya2002/secretlane/internal/middleware"
+	"github.com/amartya2002/secretlane/internal/org"
+	"github.com/amartya2002/secretlane/internal/ratelimit"
+	"github.com/amartya2002/secretlane/internal/requestid"
+	"github.com/amartya2002/secretlane/internal/router"
 	"github.com/amartya2002/secretlane/internal/routes"
+	"github.com/amartya2002/secretlane/internal/secret"
+	"github.com/amartya2002/secretlane/internal/tlsconfig"
+	"github.com/amartya2002/secretlane/internal/tracing"
+	"github.com/amartya2002/secretlane/internal/webhook"
 	"github.com/amartya2002/secretlane/internal/workspace"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// `secretlane agent ...` runs the host agent instead of the server.
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		os.Exit(runner.Main(os.Args[2:]))
+	}
+
 	// Load .env first so config can pick up env overrides.
 	_ = godotenv.Load()
 
 	if err := config.LoadAppConfig(); err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		logging.Fatal("failed to load config", "err", err)
+	}
+	if err := logging.Setup(config.Logging); err != nil {
+		logging.Fatal("failed to set up logging", "err", err)
+	}
+	tracer, err := tracing.Setup(config.Tracing)
+	if err != nil {
+		logging.Fatal("failed to set up tracing", "err", err)
 	}
 	config.InitDatabase()
 	config.RunMigrations()
 	auth.InitJWT()
+	if err := agent.InitIdentity(); err != nil {
+		logging.Fatal("failed to load agent identity", "err", err)
+	}
+	if err := secret.InitKey(); err != nil {
+		logging.Fatal("failed to load secret store key", "err", err)
+	}
 
-	authService := auth.NewAuthService()
-	wsService := workspace.NewService()
+	bus := events.NewBus(events.NewDefaultRepository())
 
-	mux := http.NewServeMux()
+	var limitStore ratelimit.Store
+	switch config.Auth.RateLimitStore {
+	case "memory":
+		limitStore = ratelimit.NewMemoryStore()
+	case "db":
+		limitStore = ratelimit.NewDefaultDBStore()
+	default:
+		logging.Fatal("unknown auth.rate_limit_store (want memory or db)", "rate_limit_store", config.Auth.RateLimitStore)
+	}
+	loginLimiter := ratelimit.NewLimiter(limitStore, config.Auth.LoginRatePerMinute, config.Auth.LoginBurst)
+	lockout := ratelimit.NewLockout(limitStore, config.Auth.LockoutThreshold,
+		time.Duration(config.Auth.LockoutMinutes)*time.Minute, time.Duration(config.Auth.LockoutMaxMinutes)*time.Minute)
 
-	routes.SetupRoutes(mux, authService, wsService)
+	var authenticators []auth.Authenticator
+	for _, backend := range config.Auth.Backends {
+		switch backend {
+		case "local":
+			authenticators = append(authenticators, auth.NewLocalAuthenticator())
+		case "ldap":
+			a, err := auth.NewLDAPAuthenticator(config.LDAP)
+			if err != nil {
+				logging.Fatal("invalid ldap config", "err", err)
+			}
+			authenticators = append(authenticators, a)
+		default:
+			logging.Fatal("unknown auth.backends entry (want local or ldap)", "backend", backend)
+		}
+	}
 
-	handler := middleware.CORS(mux)
-	log.Printf("server running :%s", config.App.Port)
-	err := http.ListenAndServe(":"+config.App.Port, handler)
+	orgService := org.NewService()
+	authService := auth.NewAuthService(lockout, bus, orgService, authenticators)
+	wsService := workspace.NewService(orgService, bus)
+	secretService := secret.NewService(wsService, bus)
+	agentService := agent.NewService(wsService, bus)
+	agentService.SetSecretSource(secretService)
+	webhookService, err := webhook.NewService(wsService)
 	if err != nil {
-		return
+		logging.Fatal("invalid webhook config", "err", err)
+	}
+
+	bus.Subscribe(agentService.HandleEvent)
+	bus.Subscribe(webhookService.HandleEvent)
+
+	// SIGINT/SIGTERM start a graceful shutdown; background workers run until then.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	runWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+
+	if tracer != nil {
+		runWorker(tracer.Run)
+	}
+	runWorker(webhookService.Run)
+	runWorker(webhookService.Dispatcher().Run)
+	if days := config.Workspace.PurgeAfterDays(); days > 0 {
+		retention := time.Duration(days) * 24 * time.Hour
+		runWorker(workspace.NewPurger(wsService, retention).Run)
+	}
+
+	rt := router.New()
+
+	checker := health.NewChecker(
+		health.Check{Name: "database", Critical: true, Run: config.PingDatabase},
+		health.Check{Name: "migrations", Critical: true, Run: config.CheckMigrations},
+		health.Check{Name: "agent_identity_key", Run: agent.CheckIdentity},
+		health.Check{Name: "secret_store_key", Critical: true, Run: secret.CheckKey},
+	)
+	routes.SetupRoutes(rt, authService, loginLimiter, orgService, wsService, secretService, agentService, webhookService, bus, checker)
+
+	handler := requestid.Middleware(middleware.Tracing(middleware.AccessLog(middleware.CORS(config.CORS)(metrics.Middleware(rt)))))
+	server := newServer(":"+config.App.Port, handler)
+	// Shutdown waits for requests to finish, so end the long-lived ones.
+	server.RegisterOnShutdown(func() {
+		bus.Close()
+		agentService.Hub().CloseAll("server shutting down")
+	})
+
+	var servers []*http.Server
+	serveErr := make(chan error, 3)
+	if config.TLS.Enabled() {
+		tlsCfg, certs, err := tlsconfig.Build(config.TLS)
+		if err != nil {
+			logging.Fatal("failed to load TLS config", "err", err)
+		}
+		server.TLSConfig = tlsCfg
+		runWorker(certs.WatchSIGHUP)
+
+		if addr := tlsconfig.RedirectAddr(config.TLS); addr != "" {
+			redirect := newServer(addr, tlsconfig.RedirectHandler(config.App.Port))
+			servers = append(servers, redirect)
+			slog.Info("redirecting HTTP to HTTPS", "addr", addr)
+			go func() { serveErr <- redirect.ListenAndServe() }()
+		}
+		slog.Info("server running", "addr", server.Addr, "tls", true)
+		go func() { serveErr <- server.ListenAndServeTLS("", "") }()
+	} else {
+		slog.Info("server running", "addr", server.Addr, "tls", false)
+		go func() { serveErr <- server.ListenAndServe() }()
+	}
+	servers = append(servers, server)
+
+	if config.Metrics.Enabled != nil && *config.Metrics.Enabled {
+		metrics.NewGaugeFunc("secretlane_active_sessions",
+			"Sessions started on this instance that have not expired or logged out.",
+			func() float64 { return float64(auth.ActiveSessions()) })
+		metrics.NewGaugeFunc("secretlane_connected_agents",
+			"Agents connected to this instance.",
+			func() float64 { return float64(agentService.Hub().Count()) })
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		admin := newServer(net.JoinHostPort(config.Metrics.Host, strconv.Itoa(config.Metrics.Port)), mux)
+		servers = append(servers, admin)
+		slog.Info("serving metrics", "addr", admin.Addr)
+		go func() { serveErr <- admin.ListenAndServe() }()
 	}
+
+	failed := false
+	select {
+	case err := <-serveErr:
+		slog.Error("server failed", "err", err)
+		failed = true
+	case <-ctx.Done():
+		slog.Info("shutting down, draining requests", "timeout_seconds", config.Server.ShutdownTimeoutSeconds)
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), seconds(config.Server.ShutdownTimeoutSeconds))
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutdown incomplete", "addr", s.Addr, "err", err)
+			failed = true
+		}
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		slog.Error("background workers did not stop in time")
+		failed = true
+	}
+
+	if err := config.CloseDatabase(); err != nil {
+		slog.Error("failed to close database", "err", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	slog.Info("server stopped")
+}
+
+// newServer returns an HTTP server with the limits from config.Server.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       seconds(config.Server.ReadTimeoutSeconds),
+		ReadHeaderTimeout: seconds(config.Server.ReadHeaderTimeoutSeconds),
+		WriteTimeout:      seconds(config.Server.WriteTimeoutSeconds),
+		IdleTimeout:       seconds(config.Server.IdleTimeoutSeconds),
+		MaxHeaderBytes:    config.Server.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
 }
@@ -0,0 +1,385 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Signup creates an account and starts a session.
+func (c *Client) Signup(ctx context.Context, username, password string) (*Session, error) {
+	var s Session
+	if err := c.do(ctx, http.MethodPost, "/signup", c.sessionQuery(), credentials{username, password}, &s); err != nil {
+		return nil, err
+	}
+	c.setToken(s.Token)
+	return &s, nil
+}
+
+// Login starts a session. With cookie auth the session cookie is kept in the
+// HTTP client's jar; with bearer auth the returned token is used from now on.
+func (c *Client) Login(ctx context.Context, username, password string) (*Session, error) {
+	var s Session
+	if err := c.do(ctx, http.MethodPost, "/login", c.sessionQuery(), credentials{username, password}, &s); err != nil {
+		return nil, err
+	}
+	c.setToken(s.Token)
+	return &s, nil
+}
+
+// sessionQuery asks signup and login for the token when it is sent as a
+// bearer credential; cookie clients do not need it.
+func (c *Client) sessionQuery() url.Values {
+	if !c.bearer {
+		return nil
+	}
+	return url.Values{"token": {"true"}}
+}
+
+// Logout ends the session and forgets the token.
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.do(ctx, http.MethodPost, "/logout", nil, nil, nil)
+	c.setToken("")
+	return err
+}
+
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	if err := c.do(ctx, http.MethodGet, "/healthz", nil, nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// UnlockAccount clears a username's failed logins and lockout. Only
+// admins may.
+func (c *Client) UnlockAccount(ctx context.Context, username string) error {
+	return c.do(ctx, http.MethodDelete, "/admin/lockouts/"+url.PathEscape(username), nil, nil, nil)
+}
+
+// Organizations
+
+// ListOrgs lists the caller's organizations, including their personal one.
+func (c *Client) ListOrgs(ctx context.Context, opts *ListOptions) (*Page[Organization], error) {
+	var page Page[Organization]
+	if err := c.do(ctx, http.MethodGet, "/orgs", opts.values(nil), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) CreateOrg(ctx context.Context, name string) (*Organization, error) {
+	body := struct {
+		Name string `json:"name"`
+	}{name}
+	var o Organization
+	if err := c.do(ctx, http.MethodPost, "/orgs", nil, body, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (c *Client) GetOrg(ctx context.Context, id int) (*Organization, error) {
+	var o Organization
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/orgs/%d", id), nil, nil, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// ListOrgMembers sorts by "username" or "created_at"; Name filters on the username.
+func (c *Client) ListOrgMembers(ctx context.Context, orgID int, opts *ListOptions) (*Page[Member], error) {
+	var page Page[Member]
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/orgs/%d/members", orgID), opts.values(nil), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+type memberInput struct {
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role"`
+}
+
+// AddOrgMember adds a user as "owner" or "member" ("" means member).
+func (c *Client) AddOrgMember(ctx context.Context, orgID int, username, role string) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/orgs/%d/members", orgID), nil, memberInput{username, role}, nil)
+}
+
+func (c *Client) SetOrgMemberRole(ctx context.Context, orgID, userID int, role string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/orgs/%d/members/%d", orgID, userID), nil, memberInput{Role: role}, nil)
+}
+
+func (c *Client) RemoveOrgMember(ctx context.Context, orgID, userID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/orgs/%d/members/%d", orgID, userID), nil, nil, nil)
+}
+
+// Workspaces
+
+type workspaceInput struct {
+	OrgID       int    `json:"org_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ListWorkspaces sorts by "name" or "created_at" and filters by name.
+func (c *Client) ListWorkspaces(ctx context.Context, opts *ListOptions) (*Page[Workspace], error) {
+	var page Page[Workspace]
+	if err := c.do(ctx, http.MethodGet, "/workspaces", opts.values(nil), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ListOrgWorkspaces is ListWorkspaces for one organization.
+func (c *Client) ListOrgWorkspaces(ctx context.Context, orgID int, opts *ListOptions) (*Page[Workspace], error) {
+	var page Page[Workspace]
+	q := opts.values(url.Values{"org_id": {strconv.Itoa(orgID)}})
+	if err := c.do(ctx, http.MethodGet, "/workspaces", q, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// CreateWorkspace creates a workspace in the caller's personal organization
+// and returns its ID.
+func (c *Client) CreateWorkspace(ctx context.Context, name, description string) (int, error) {
+	return c.CreateOrgWorkspace(ctx, 0, name, description)
+}
+
+// CreateOrgWorkspace creates a workspace in an organization and returns its ID.
+func (c *Client) CreateOrgWorkspace(ctx context.Context, orgID int, name, description string) (int, error) {
+	var out struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/workspaces", nil, workspaceInput{orgID, name, description}, &out); err != nil {
+		return 0, err
+	}
+	return out.ID, nil
+}
+
+func (c *Client) GetWorkspace(ctx context.Context, id int) (*Workspace, error) {
+	var ws Workspace
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/workspaces/%d", id), nil, nil, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+func (c *Client) UpdateWorkspace(ctx context.Context, id int, name, description string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/workspaces/%d", id), nil, workspaceInput{Name: name, Description: description}, nil)
+}
+
+// DeleteWorkspace moves a workspace to the trash.
+func (c *Client) DeleteWorkspace(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/workspaces/%d", id), nil, nil, nil)
+}
+
+// ListTrash lists deleted workspaces that can still be restored.
+func (c *Client) ListTrash(ctx context.Context, opts *ListOptions) (*Page[Workspace], error) {
+	var page Page[Workspace]
+	if err := c.do(ctx, http.MethodGet, "/workspaces/trash", opts.values(nil), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) RestoreWorkspace(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/restore", id), nil, nil, nil)
+}
+
+// TransferWorkspace moves a workspace to another organization.
+func (c *Client) TransferWorkspace(ctx context.Context, id, orgID int) error {
+	body := struct {
+		OrgID int `json:"org_id"`
+	}{orgID}
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/transfer", id), nil, body, nil)
+}
+
+// TransferWorkspaceToUser moves a workspace to a user's personal organization.
+func (c *Client) TransferWorkspaceToUser(ctx context.Context, id int, username string) error {
+	body := struct {
+		Username string `json:"username"`
+	}{username}
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/transfer", id), nil, body, nil)
+}
+
+// PurgeWorkspace permanently deletes a workspace; name must be its current name.
+func (c *Client) PurgeWorkspace(ctx context.Context, id int, name string) error {
+	body := struct {
+		ConfirmName string `json:"confirm_name"`
+	}{name}
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/workspaces/%d/purge", id), nil, body, nil)
+}
+
+// Secrets
+
+// ListSecrets returns names and versions without values. It sorts by "name"
+// or "created_at" and filters by name.
+func (c *Client) ListSecrets(ctx context.Context, workspaceID int, opts *ListOptions) (*Page[Secret], error) {
+	var page Page[Secret]
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/workspaces/%d/secrets", workspaceID), opts.values(nil), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetSecret returns a secret with its value.
+func (c *Client) GetSecret(ctx context.Context, workspaceID int, name string) (*Secret, error) {
+	var sec Secret
+	if err := c.do(ctx, http.MethodGet, secretPath(workspaceID, name), nil, nil, &sec); err != nil {
+		return nil, err
+	}
+	return &sec, nil
+}
+
+// SetSecret creates a secret or replaces its value.
+func (c *Client) SetSecret(ctx context.Context, workspaceID int, name, value string) (*Secret, error) {
+	in := struct {
+		Value string `json:"value"`
+	}{value}
+
+	var sec Secret
+	if err := c.do(ctx, http.MethodPut, secretPath(workspaceID, name), nil, in, &sec); err != nil {
+		return nil, err
+	}
+	return &sec, nil
+}
+
+// RotateSecret replaces a secret's value; an empty value makes the server
+// generate one. The returned Secret carries the new value.
+func (c *Client) RotateSecret(ctx context.Context, workspaceID int, name, value string) (*Secret, error) {
+	in := struct {
+		Value string `json:"value,omitempty"`
+	}{value}
+
+	var sec Secret
+	if err := c.do(ctx, http.MethodPost, secretPath(workspaceID, name)+"/rotate", nil, in, &sec); err != nil {
+		return nil, err
+	}
+	return &sec, nil
+}
+
+func (c *Client) DeleteSecret(ctx context.Context, workspaceID int, name string) error {
+	return c.do(ctx, http.MethodDelete, secretPath(workspaceID, name), nil, nil, nil)
+}
+
+func secretPath(workspaceID int, name string) string {
+	return fmt.Sprintf("/workspaces/%d/secrets/%s", workspaceID, url.PathEscape(name))
+}
+
+// Agents
+
+// ListAgents sorts by "name" or "created_at" and filters by name.
+func (c *Client) ListAgents(ctx context.Context, workspaceID int, opts *ListOptions) (*Page[Agent], error) {
+	var page Page[Agent]
+	if err := c.do(ctx, http.MethodGet, "/agents", opts.values(workspaceQuery(workspaceID)), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// CreateJoinToken issues an enrollment token; ttl 0 uses the server default.
+func (c *Client) CreateJoinToken(ctx context.Context, workspaceID int, ttl time.Duration) (*JoinToken, error) {
+	in := struct {
+		WorkspaceID int `json:"workspace_id"`
+		TTLSeconds  int `json:"ttl_seconds"`
+	}{workspaceID, int(ttl / time.Second)}
+
+	var t JoinToken
+	if err := c.do(ctx, http.MethodPost, "/agents/tokens", nil, in, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (c *Client) RevokeAgent(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/agents/%d", id), nil, nil, nil)
+}
+
+// Enroll exchanges a join token for an agent identity. publicKey is the
+// agent's base64 ed25519 public key. It needs no session.
+func (c *Client) Enroll(ctx context.Context, joinToken, name, publicKey string) (*Enrollment, error) {
+	in := struct {
+		Token     string `json:"token"`
+		Name      string `json:"name"`
+		PublicKey string `json:"public_key"`
+	}{joinToken, name, publicKey}
+
+	var e Enrollment
+	if err := c.do(ctx, http.MethodPost, "/agents/enroll", nil, in, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Webhooks
+
+// ListWebhooks sorts by "url" or "created_at"; Name filters on the URL.
+func (c *Client) ListWebhooks(ctx context.Context, workspaceID int, opts *ListOptions) (*Page[Webhook], error) {
+	var page Page[Webhook]
+	if err := c.do(ctx, http.MethodGet, "/webhooks", opts.values(workspaceQuery(workspaceID)), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// CreateWebhook registers url for events. The returned Secret signs
+// deliveries and is not shown again.
+func (c *Client) CreateWebhook(ctx context.Context, workspaceID int, url string, events []string) (*Webhook, error) {
+	in := struct {
+		WorkspaceID int      `json:"workspace_id"`
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+	}{workspaceID, url, events}
+
+	var wh Webhook
+	if err := c.do(ctx, http.MethodPost, "/webhooks", nil, in, &wh); err != nil {
+		return nil, err
+	}
+	return &wh, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, id int) (*Webhook, error) {
+	var wh Webhook
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/webhooks/%d", id), nil, nil, &wh); err != nil {
+		return nil, err
+	}
+	return &wh, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/webhooks/%d", id), nil, nil, nil)
+}
+
+// ListDeliveries returns the delivery log, newest first by default.
+func (c *Client) ListDeliveries(ctx context.Context, webhookID int, opts *ListOptions) (*Page[Delivery], error) {
+	var page Page[Delivery]
+	path := fmt.Sprintf("/webhooks/%d/deliveries", webhookID)
+	if err := c.do(ctx, http.MethodGet, path, opts.values(nil), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Redeliver queues a delivery for another attempt.
+func (c *Client) Redeliver(ctx context.Context, webhookID, deliveryID int) (*Delivery, error) {
+	var d Delivery
+	path := fmt.Sprintf("/webhooks/%d/deliveries/%d/redeliver", webhookID, deliveryID)
+	if err := c.do(ctx, http.MethodPost, path, nil, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func workspaceQuery(id int) url.Values {
+	return url.Values{"workspace_id": {strconv.Itoa(id)}}
+}
@@ -0,0 +1,228 @@
+// Package client is a Go SDK for the Secretlane REST API (/api/v1).
+//
+//	c, err := client.New("https://secretlane.example.com", client.WithBearerAuth())
+//	if _, err := c.Login(ctx, "alice@example.com", password); err != nil { ... }
+//	page, err := c.ListWorkspaces(ctx, &client.ListOptions{Sort: "name"})
+//
+// Errors returned by the API are *Error values carrying the API error code;
+// compare with errors.Is against ErrNotFound, ErrConflict and friends.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiPrefix          = "/api/v1"
+	defaultMaxRetries  = 3
+	defaultBaseBackoff = 250 * time.Millisecond
+	defaultMaxBackoff  = 10 * time.Second
+)
+
+// Client talks to one Secretlane server. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	http       *http.Client
+	bearer     bool
+	userAgent  string
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the underlying HTTP client. For cookie auth it
+// must have a cookie jar; New adds one when it is missing.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithBearerAuth sends the session token in an Authorization header instead
+// of relying on the cookie. Login and Signup store the token automatically.
+func WithBearerAuth() Option {
+	return func(c *Client) { c.bearer = true }
+}
+
+// WithToken uses an existing session token as a bearer credential.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.bearer = true
+		c.token = token
+	}
+}
+
+// WithRetries sets how many times a request is retried after a 429 or 5xx
+// response, and the initial backoff which doubles on each attempt.
+func WithRetries(max int, base time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max
+		c.baseDelay = base
+	}
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New returns a client for the server at baseURL (scheme and host, e.g.
+// "http://localhost:8080"). Cookie auth is the default.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: base URL must be http(s), got %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		userAgent:  "secretlane-go-client",
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultBaseBackoff,
+		maxDelay:   defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: 30 * time.Second}
+	}
+	if !c.bearer && c.http.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.http.Jar = jar
+	}
+	return c, nil
+}
+
+// Token returns the current bearer token, if any.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// do sends one API call. in is JSON-encoded when non-nil; out is decoded
+// from a 2xx response when non-nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("client: encode request: %w", err)
+		}
+	}
+
+	u := *c.baseURL
+	u.Path += apiPrefix + path
+	u.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, u.String(), body)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				io.Copy(io.Discard, resp.Body)
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("client: decode %s %s response: %w", method, path, err)
+			}
+			return nil
+		}
+
+		apiErr := decodeError(resp)
+		resp.Body.Close()
+		if attempt >= c.maxRetries || !retryable(method, resp.StatusCode) {
+			return apiErr
+		}
+
+		delay := c.backoff(attempt, resp.Header.Get("Retry-After"))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.Token(); c.bearer && token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.http.Do(req)
+}
+
+// retryable: 429 means the request was not processed, so any method may be
+// retried. Server errors are only retried for idempotent methods to avoid
+// creating things twice.
+func retryable(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	if status < 500 || status == http.StatusNotImplemented {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff honours Retry-After (in seconds) and otherwise doubles the base
+// delay per attempt, with jitter, up to maxDelay.
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+		return min(time.Duration(secs)*time.Second, c.maxDelay)
+	}
+	d := c.baseDelay << attempt
+	if d <= 0 || d > c.maxDelay {
+		d = c.maxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// API error codes, as sent in the "code" field of error responses.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+// Sentinels for errors.Is; they match any *Error with the same code.
+var (
+	ErrBadRequest   = &Error{Code: CodeBadRequest}
+	ErrValidation   = &Error{Code: CodeValidation}
+	ErrUnauthorized = &Error{Code: CodeUnauthorized}
+	ErrForbidden    = &Error{Code: CodeForbidden}
+	ErrNotFound     = &Error{Code: CodeNotFound}
+	ErrConflict     = &Error{Code: CodeConflict}
+	ErrRateLimited  = &Error{Code: CodeRateLimited}
+	ErrInternal     = &Error{Code: CodeInternal}
+)
+
+// FieldError points at one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error response from the API.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	Fields     []FieldError
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("secretlane: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+	if e.RequestID != "" {
+		msg += " request_id=" + e.RequestID
+	}
+	return msg
+}
+
+// Is matches sentinels by code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// decodeError reads the error envelope. Responses that aren't one (e.g. from
+// a proxy) still produce an *Error, with a code derived from the status.
+func decodeError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var env struct {
+		Error struct {
+			Code      string       `json:"code"`
+			Message   string       `json:"message"`
+			RequestID string       `json:"request_id"`
+			Fields    []FieldError `json:"fields"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &env) == nil && env.Error.Code != "" {
+		e.Code = env.Error.Code
+		e.Message = env.Error.Message
+		e.Fields = env.Error.Fields
+		if env.Error.RequestID != "" {
+			e.RequestID = env.Error.RequestID
+		}
+		return e
+	}
+
+	e.Code = codeForStatus(resp.StatusCode)
+	e.Message = http.StatusText(resp.StatusCode)
+	return e
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	return CodeInternal
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ListOptions pages through list endpoints. The zero value fetches the first
+// page in the server's default order.
+type ListOptions struct {
+	Limit  int
+	Cursor string
+	// Sort is a field name, prefixed with "-" for descending.
+	Sort string
+	// Name filters by case-insensitive substring where the list supports it.
+	Name string
+}
+
+func (o *ListOptions) values(q url.Values) url.Values {
+	if q == nil {
+		q = url.Values{}
+	}
+	if o == nil {
+		return q
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Name != "" {
+		q.Set("name", o.Name)
+	}
+	return q
+}
+
+// Page is one page of a list. Pass NextCursor as ListOptions.Cursor to get
+// the next one; it is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Session is returned by Signup and Login.
+type Session struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+type Health struct {
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Organization owns workspaces. Role is the caller's role: "owner" or "member".
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Personal  bool      `json:"personal"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role,omitempty"`
+}
+
+type Member struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Workspace struct {
+	ID          int    `json:"id"`
+	OrgID       int    `json:"org_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedBy   int    `json:"created_by"`
+	CreatedAt   string `json:"created_at"`
+	// DeletedAt is set while the workspace is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Secret is a named value in a workspace. Value is empty in lists.
+type Secret struct {
+	ID          int       `json:"id"`
+	WorkspaceID int       `json:"workspace_id"`
+	Name        string    `json:"name"`
+	Value       string    `json:"value,omitempty"`
+	Version     int       `json:"version"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Agent struct {
+	ID          int        `json:"id"`
+	WorkspaceID int        `json:"workspace_id"`
+	Name        string     `json:"name"`
+	PublicKey   string     `json:"public_key"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	Connected   bool       `json:"connected"`
+}
+
+// JoinToken is a single-use agent enrollment token. Token is only ever
+// returned once, at creation.
+type JoinToken struct {
+	Token       string    `json:"token"`
+	WorkspaceID int       `json:"workspace_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type Enrollment struct {
+	Agent           Agent  `json:"agent"`
+	ServerPublicKey string `json:"server_public_key"`
+}
+
+// Webhook.Secret is only set in the response to CreateWebhook.
+type Webhook struct {
+	ID          int       `json:"id"`
+	WorkspaceID int       `json:"workspace_id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Secret      string    `json:"secret,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}